@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"os"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +17,8 @@ import (
 
 	"github.com/d60-Lab/gin-template/internal/cacheperf"
 	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/logger"
 )
 
 type request struct {
@@ -25,6 +28,8 @@ type request struct {
 
 func main() {
 	ctx := context.Background()
+	// 时间线服务在缓存异常时会打日志
+	mustDo(logger.Init("release"))
 
 	// Use PostgreSQL for realistic testing
 	dsn := os.Getenv("DATABASE_URL")
@@ -37,8 +42,10 @@ func main() {
 	// Clean up existing test data
 	mustDo(db.Exec("DROP TABLE IF EXISTS fans CASCADE").Error)
 	mustDo(db.Exec("DROP TABLE IF EXISTS users CASCADE").Error)
+	mustDo(db.Exec("DROP TABLE IF EXISTS inbox CASCADE").Error)
+	mustDo(db.Exec("DROP TABLE IF EXISTS posts CASCADE").Error)
 	
-	mustDo(db.AutoMigrate(&model.User{}, &model.Fan{}))
+	mustDo(db.AutoMigrate(&model.User{}, &model.Fan{}, &model.Post{}, &model.Inbox{}))
 
 	const (
 		userCount     = 20000  // 20k users in system
@@ -171,6 +178,163 @@ func main() {
 		optimized.counters.PageQueries, optimized.counters.IndexLoads, optimized.counters.UserBulkLoad,
 		optimized.cacheKeys, formatBytes(optimized.memoryBytes),
 	)
+
+	runHerdBench(ctx, db, client, user1.ID, ttlMinutes*time.Minute)
+
+	runTimelineBench(ctx, db, client, []string{user1.ID, user2.ID, user3.ID})
+}
+
+// runHerdBench 热点用户的索引过期瞬间大量并发请求同时回源（惊群），
+// 另有一个没有粉丝的用户被持续访问；对比关闭与开启防击穿（合并回源 + 空列表占位）时的 DB 负载
+func runHerdBench(ctx context.Context, db *gorm.DB, client *redis.Client, hotUser string, ttl time.Duration) {
+	const (
+		rounds      = 20
+		concurrency = 200
+		emptyUser   = "user_without_fans"
+	)
+	baseline := cacheperf.NewFollowerService(db, client, ttl, 0).
+		WithCoalescing(false).WithEmptyTTL(0).WithEarlyRefresh(0)
+	protected := cacheperf.NewFollowerService(db, client, ttl, 0)
+
+	fmt.Printf("\nThundering herd (%d rounds x %d concurrent req, index expired before each round)\n", rounds, concurrency)
+	for _, row := range []struct {
+		name string
+		svc  *cacheperf.FollowerService
+	}{{"Unprotected", baseline}, {"Protected", protected}} {
+		res := runHerdScenario(ctx, row.svc, client, []string{hotUser, emptyUser}, rounds, concurrency)
+		fmt.Printf("%-18s avg=%v p95=%v p99=%v db_index=%d db_user_bulk=%d\n",
+			row.name, avg(res.durations), pct(res.durations, 0.95), pct(res.durations, 0.99),
+			res.counters.IndexLoads, res.counters.UserBulkLoad,
+		)
+	}
+}
+
+func runHerdScenario(ctx context.Context, svc *cacheperf.FollowerService, client *redis.Client, users []string, rounds, concurrency int) scenarioResult {
+	client.FlushAll(ctx)
+	svc.ResetCounters()
+
+	fmt.Print("  Running benchmark...")
+	out := make([]time.Duration, 0, rounds*concurrency)
+	for r := 0; r < rounds; r++ {
+		// 模拟热点索引到期；空用户的占位按自身 TTL 过期
+		client.Del(ctx, "followers:index:"+users[0])
+
+		start := make(chan struct{})
+		results := make(chan time.Duration, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(userID string) {
+				defer wg.Done()
+				<-start
+				st := time.Now()
+				if _, err := svc.FetchFollowersOptimized(ctx, userID, 1, 20); err != nil {
+					panic(err)
+				}
+				results <- time.Since(st)
+			}(users[i%len(users)])
+		}
+		close(start)
+		wg.Wait()
+		close(results)
+		for d := range results {
+			out = append(out, d)
+		}
+	}
+	fmt.Println(" done")
+	return scenarioResult{durations: out, counters: svc.Counters()}
+}
+
+// runTimelineBench 对比时间线推模式部分直接读 inbox 与 ZSET 缓存（写穿 + 按需重建）
+func runTimelineBench(ctx context.Context, db *gorm.DB, client *redis.Client, readers []string) {
+	const (
+		postsPerReader = 2000
+		cacheSize      = 800
+	)
+	fmt.Println("\nSetting up timeline data...")
+	base := time.Now().Add(-time.Hour)
+	for _, reader := range readers {
+		posts := make([]model.Post, postsPerReader)
+		inbox := make([]model.Inbox, postsPerReader)
+		for i := range posts {
+			at := base.Add(time.Duration(i) * time.Second)
+			posts[i] = model.Post{ID: uuid.NewString(), AuthorID: fmt.Sprintf("author_%d", i%50), Payload: "hello", CreatedAt: at, UpdatedAt: at}
+			inbox[i] = model.Inbox{ID: uuid.NewString(), UserID: reader, PostID: posts[i].ID, Score: at.UnixNano(), CreatedAt: at}
+		}
+		mustDo(db.CreateInBatches(&posts, 1000).Error)
+		mustDo(db.CreateInBatches(&inbox, 1000).Error)
+	}
+
+	// 70% 首页，其余按游标连续翻页，模拟下拉刷新与向下滚动
+	rnd := rand.New(rand.NewSource(7))
+	reqs := make([]timelineRequest, 0, 9000)
+	for i := 0; i < 9000; i++ {
+		pages := 1
+		if rnd.Float64() > 0.7 {
+			pages = 2 + rnd.Intn(5)
+		}
+		reqs = append(reqs, timelineRequest{userID: readers[i%len(readers)], pages: pages})
+	}
+
+	inbox := runTimelineScenario(ctx, client, reqs, false, service.NewTimelineService(db, nil, nil, 0, nil, nil))
+	cache := service.NewTimelineCache(client, cacheSize, 10*time.Minute)
+	zset := runTimelineScenario(ctx, client, reqs, true, service.NewTimelineService(db, nil, nil, 0, nil, cache))
+
+	fmt.Printf("\nTimeline read latency (9k req across %d readers, %d inbox rows each, page=20)\n", len(readers), postsPerReader)
+	for _, row := range []struct {
+		name string
+		res  scenarioResult
+	}{{"Inbox (no cache)", inbox}, {"ZSET cache", zset}} {
+		fmt.Printf("%-18s avg=%v p95=%v p99=%v cache_keys=%d mem=%s\n",
+			row.name, avg(row.res.durations), pct(row.res.durations, 0.95), pct(row.res.durations, 0.99),
+			row.res.cacheKeys, formatBytes(row.res.memoryBytes),
+		)
+	}
+}
+
+type timelineRequest struct {
+	userID string
+	pages  int // 从首页开始连续读取的页数
+}
+
+func runTimelineScenario(ctx context.Context, client *redis.Client, reqs []timelineRequest, warm bool, svc service.TimelineService) scenarioResult {
+	client.FlushAll(ctx)
+	read := func(r timelineRequest) time.Duration {
+		start := time.Now()
+		cursor := ""
+		for p := 0; p < r.pages; p++ {
+			resp, err := svc.GetTimeline(ctx, r.userID, cursor, 20)
+			if err != nil {
+				panic(err)
+			}
+			if !resp.HasMore {
+				break
+			}
+			cursor = resp.NextCursor
+		}
+		return time.Since(start)
+	}
+	if warm {
+		fmt.Print("  Warming cache...")
+		for _, r := range reqs[:len(reqs)/10] {
+			read(r)
+		}
+		fmt.Println(" done")
+	}
+
+	fmt.Print("  Running benchmark...")
+	out := make([]time.Duration, 0, len(reqs))
+	for _, r := range reqs {
+		out = append(out, read(r))
+	}
+	fmt.Println(" done")
+
+	keys, _ := client.Keys(ctx, "*").Result()
+	var memBytes int64
+	if info, err := client.Info(ctx, "memory").Result(); err == nil {
+		memBytes = parseRedisMemory(info)
+	}
+	return scenarioResult{durations: out, cacheKeys: len(keys), memoryBytes: memBytes}
 }
 
 type scenarioResult struct {
@@ -0,0 +1,75 @@
+// inboxcompact 按保留策略一次性压缩 inbox，输出 JSON 报告。策略默认取自配置中的 retention，可用参数覆盖。
+//
+// 用法:
+//
+//	go run ./cmd/inboxcompact                         # 按配置执行一轮
+//	go run ./cmd/inboxcompact -max=500 -ttl=168h      # 每人最多保留 500 条，删除 7 天前的条目
+//	go run ./cmd/inboxcompact -rate=0                 # 不限速（维护窗口内使用）
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/d60-Lab/gin-template/config"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/database"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	policy := service.RetentionPolicyFromConfig(cfg.Retention)
+	maxPerUser := flag.Int("max", policy.MaxPerUser, "每个用户最多保留的最新条数，0 表示不限")
+	ttl := flag.Duration("ttl", policy.TTL, "删除发布时间早于该时长的条目，0 表示不限")
+	batch := flag.Int("batch", cfg.Retention.BatchSize, "单条 DELETE 的最大行数")
+	rate := flag.Int("rate", cfg.Retention.MaxDeletesPerSecond, "每秒删除行数上限，0 表示不限速")
+	flag.Parse()
+
+	policy = service.RetentionPolicy{MaxPerUser: *maxPerUser, TTL: *ttl}
+	if !policy.Enabled() {
+		fail(fmt.Errorf("retention policy is empty: set -max or -ttl"))
+	}
+
+	// stdout 只输出 JSON 报告，关闭 SQL 日志
+	cfg.Server.Mode = "release"
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		fail(err)
+	}
+	db = db.Session(&gorm.Session{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+
+	// Ctrl-C 中断时已删除的批次保留，输出已完成部分的报告
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	retention := service.NewInboxRetention(repository.NewInboxRepository(db), policy, time.Hour, *batch).
+		WithRateLimit(*rate)
+	report, runErr := retention.RunOnce(ctx)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fail(err)
+	}
+	if runErr != nil {
+		fail(runErr)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, `{"error": %q}`+"\n", err.Error())
+	os.Exit(1)
+}
@@ -27,9 +27,9 @@ func main() {
     // repositories & services
     followRepo := repository.NewFollowRepository(db)
     fanRepo := repository.NewFanRepository(db)
-    replicator := service.NewFanReplicator(fanRepo, 100000)
+    replicator := service.NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, fanRepo, 512, 0, 20*time.Millisecond)
     stop := replicator.Start(8)
-    relSvc := service.NewRelationshipService(followRepo, fanRepo, replicator)
+    relSvc := service.NewRelationshipService(followRepo, fanRepo, replicator, nil, nil, nil, nil)
 
     ctx := context.Background()
 
@@ -148,7 +148,9 @@ func main() {
     _, _ = followRepo.ListFollowings(ctx, celeb.ID, 0, PAGE)
     follDur := time.Since(q1)
 
-    // stop replicator (will wait queue to drain internally)
+    // wait for the durable event queue to drain, then stop replicator
+    drainDeadline := time.Now().Add(2 * time.Minute)
+    for replicator.QueueLen() > 0 && time.Now().Before(drainDeadline) { time.Sleep(50 * time.Millisecond) }
     _ = stop(context.Background())
     drainDur := time.Since(drainStart)
     close(doneRep)
@@ -0,0 +1,77 @@
+// relcheck 比对 follows 与 fans 冗余表，输出 JSON 报告，可选幂等修复。
+//
+// 用法:
+//
+//	go run ./cmd/relcheck                 # 全量校验
+//	go run ./cmd/relcheck -user=<id>      # 只校验某个用户
+//	go run ./cmd/relcheck -repair         # 校验并修复
+//
+// 发现漂移时退出码为 2，便于接入定时任务告警。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/d60-Lab/gin-template/config"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/database"
+)
+
+func main() {
+	userID := flag.String("user", "", "只校验该用户相关的关系；为空则全量校验")
+	repair := flag.Bool("repair", false, "修复缺失/孤儿的 fans 记录")
+	batch := flag.Int("batch", 1000, "每批扫描的行数")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	// stdout 只输出 JSON 报告，关闭 SQL 日志
+	cfg.Server.Mode = "release"
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		fail(err)
+	}
+	db = db.Session(&gorm.Session{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+
+	checker := service.NewRelationChecker(db,
+		repository.NewFollowRepository(db),
+		repository.NewFanRepository(db),
+		repository.NewRelationEventRepository(db),
+		*batch,
+	)
+
+	ctx := context.Background()
+	var report *service.RelationCheckReport
+	if *userID != "" {
+		report, err = checker.CheckUser(ctx, *userID, *repair)
+	} else {
+		report, err = checker.CheckAll(ctx, *repair)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fail(err)
+	}
+	if report.Drift() > 0 {
+		os.Exit(2)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, `{"error": %q}`+"\n", err.Error())
+	os.Exit(1)
+}
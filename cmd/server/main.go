@@ -17,9 +17,13 @@ import (
 	"github.com/d60-Lab/gin-template/internal/api/handler"
 	"github.com/d60-Lab/gin-template/internal/api/middleware"
 	"github.com/d60-Lab/gin-template/internal/api/router"
+	"github.com/d60-Lab/gin-template/internal/cacheperf"
 	"github.com/d60-Lab/gin-template/internal/repository"
 	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/cache"
 	"github.com/d60-Lab/gin-template/pkg/database"
+	"github.com/d60-Lab/gin-template/pkg/eventbus"
+	"github.com/d60-Lab/gin-template/pkg/idgen"
 	"github.com/d60-Lab/gin-template/pkg/logger"
 	"github.com/d60-Lab/gin-template/pkg/validator"
 )
@@ -105,21 +109,141 @@ func main() {
 		logger.Fatal("Failed to init database", zap.Error(err))
 	}
 
+	// 初始化 Redis（不可用时计数直接读库）
+	rdb, err := cache.InitRedis(cfg)
+	if err != nil {
+		logger.Warn("Redis unavailable, relation counts will bypass cache", zap.Error(err))
+	} else {
+		defer rdb.Close()
+	}
+
+	// 分布式 ID：帖子与 inbox 主键按时间递增，多实例部署时 worker_id 各不相同
+	workerID, err := cfg.IDGen.Worker()
+	if err != nil {
+		logger.Fatal("Worker id is required", zap.Error(err))
+	}
+	ids, err := idgen.New(idgen.DefaultLayout, workerID)
+	if err != nil {
+		logger.Fatal("Failed to init id generator", zap.Error(err))
+	}
+	ids.WithMaxBackward(time.Duration(cfg.IDGen.MaxBackwardMs) * time.Millisecond)
+
 	// 初始化仓储层
 	userRepo := repository.NewUserRepository(db)
 	followRepo := repository.NewFollowRepository(db)
 	fanRepo := repository.NewFanRepository(db)
+	relEventRepo := repository.NewRelationEventRepository(db)
+	countRepo := repository.NewRelationCountRepository(db)
+	blockRepo := repository.NewBlockRepository(db)
+	muteRepo := repository.NewMuteRepository(db)
 
-	// 初始化异步冗余执行器
-	replicator := service.NewFanReplicator(fanRepo, 10000)
-	stopReplicator := replicator.Start(4)
+	// 关注数/粉丝数：缓存读取 + 定期对账
+	countService := service.NewRelationCountService(countRepo, rdb,
+		time.Duration(cfg.Counts.CacheTTLSeconds)*time.Second)
+	reconciler := service.NewRelationCountReconciler(db, countRepo, countService,
+		time.Duration(cfg.Counts.ReconcileIntervalSeconds)*time.Second,
+		cfg.Counts.ReconcileBatch,
+	)
+	stopReconciler := reconciler.Start()
+
+	// 时间线 ZSET 缓存（需要 Redis）：扇出与回填写穿，读时按需重建
+	var timelineCache *service.TimelineCache
+	if rdb != nil && cfg.Timeline.CacheSize > 0 {
+		timelineCache = service.NewTimelineCache(rdb, cfg.Timeline.CacheSize,
+			time.Duration(cfg.Timeline.CacheTTLSeconds)*time.Second)
+	}
+
+	// 初始化异步冗余执行器（消费 relation_events 外发盒）
+	replicator := service.NewFanReplicator(relEventRepo, followRepo, fanRepo,
+		cfg.Replicator.BatchSize,
+		cfg.Replicator.MaxAttempts,
+		time.Duration(cfg.Replicator.PollIntervalMs)*time.Millisecond,
+	).WithCounts(countService).
+		WithRetention(time.Duration(cfg.Replicator.DoneRetentionHours) * time.Hour).
+		WithIDGenerator(ids)
+	if cfg.Replicator.TimelineSync {
+		replicator.WithTimeline(repository.NewInboxRepository(db), repository.NewPostRepository(db),
+			cfg.Replicator.BackfillPosts, cfg.Fanout.CelebrityThreshold).
+			WithTimelineCache(timelineCache)
+	}
+	stopReplicator := replicator.Start(cfg.Replicator.Workers)
+
+	// 初始化时间线扇出 worker
+	fanoutWorker := service.NewFanoutWorker(db, fanRepo,
+		cfg.Fanout.Workers,
+		cfg.Fanout.BatchSize,
+		cfg.Fanout.ClaimLimit,
+		time.Duration(cfg.Fanout.PollIntervalMs)*time.Millisecond,
+	).WithCelebrityThreshold(cfg.Fanout.CelebrityThreshold).
+		WithMutes(muteRepo).
+		WithRetryPolicy(cfg.Fanout.MaxAttempts, time.Duration(cfg.Fanout.LeaseSeconds)*time.Second).
+		WithSharding(cfg.Fanout.ShardSize).
+		WithTimelineCache(timelineCache).
+		WithIDGenerator(ids)
+
+	// 扇出传输：直接轮询 outbox，或经 relay 转发到 Redis Streams 由消费组写 inbox
+	var stopFanout func(context.Context) error
+	wakeFanout := fanoutWorker.Notify
+	if cfg.Fanout.Transport == config.FanoutTransportRedisStreams && rdb != nil {
+		bus := eventbus.NewRedisStreams(rdb, "").WithMaxLen(cfg.Fanout.StreamMaxLen)
+		relay := service.NewOutboxRelay(db, bus,
+			cfg.Fanout.ClaimLimit,
+			time.Duration(cfg.Fanout.PollIntervalMs)*time.Millisecond,
+		).WithRetryPolicy(cfg.Fanout.MaxAttempts, time.Duration(cfg.Fanout.LeaseSeconds)*time.Second)
+		stopRelay := relay.Start()
+		stopConsumers := fanoutWorker.StartConsumers(bus, service.FanoutTopic, service.FanoutConsumerGroup)
+		stopFanout = func(ctx context.Context) error {
+			if err := stopRelay(ctx); err != nil {
+				return err
+			}
+			return stopConsumers(ctx)
+		}
+		wakeFanout = relay.Notify
+	} else {
+		if cfg.Fanout.Transport == config.FanoutTransportRedisStreams {
+			logger.Warn("Redis unavailable, fanout falls back to polling outbox")
+		}
+		stopFanout = fanoutWorker.Start()
+	}
+
+	// LISTEN 新 outbox 通知即时唤醒扇出
+	listenCtx, stopListen := context.WithCancel(context.Background())
+	defer stopListen()
+	if cfg.Fanout.Notify {
+		go database.Listen(listenCtx, database.DSN(cfg), service.FanoutNotifyChannel, func(string) { wakeFanout() })
+	}
+
+	// inbox 保留策略：后台限速清理
+	stopRetention := func(context.Context) error { return nil }
+	if policy := service.RetentionPolicyFromConfig(cfg.Retention); policy.Enabled() {
+		stopRetention = service.NewInboxRetention(repository.NewInboxRepository(db), policy,
+			time.Duration(cfg.Retention.IntervalSeconds)*time.Second,
+			cfg.Retention.BatchSize,
+		).WithRateLimit(cfg.Retention.MaxDeletesPerSecond).WithTimelineCache(timelineCache).Start()
+	}
+
+	// 粉丝列表缓存（需要 Redis）：关注变化与资料变更时增量维护
+	var followerCache service.FollowerCache
+	if rdb != nil && cfg.Followers.CacheTTLSeconds > 0 {
+		followerCache = cacheperf.NewFollowerService(db, rdb,
+			time.Duration(cfg.Followers.CacheTTLSeconds)*time.Second, 0,
+		).WithEmptyTTL(time.Duration(cfg.Followers.EmptyTTLSeconds) * time.Second).
+			WithEarlyRefresh(cfg.Followers.EarlyRefreshBeta).
+			WithIndexSize(cfg.Followers.IndexSize)
+	}
 
 	// 初始化服务层
-	userService := service.NewUserService(userRepo, cfg)
-	relService := service.NewRelationshipService(followRepo, fanRepo, replicator)
+	userService := service.NewUserService(userRepo, countService, cfg, followerCache)
+	relService := service.NewRelationshipService(followRepo, fanRepo, replicator, countService, blockRepo, muteRepo, followerCache)
+	timelineService := service.NewTimelineService(db, followRepo, countRepo, cfg.Fanout.CelebrityThreshold, muteRepo, timelineCache)
+	publisher := service.NewPublisher(db).WithIDGenerator(ids)
+	if cfg.Fanout.Notify {
+		publisher.WithNotify(service.FanoutNotifyChannel)
+	}
+	outboxService := service.NewOutboxService(repository.NewOutboxRepository(db))
 
 	// 初始化处理器
-	h := handler.NewHandler(userService, relService)
+	h := handler.NewHandler(userService, relService, timelineService, publisher, outboxService)
 
 	// 设置 Gin 模式
 	gin.SetMode(cfg.Server.Mode)
@@ -161,8 +285,20 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
-	// 停止异步冗余
-	_ = stopReplicator(ctx)
+	// 停止异步冗余与时间线扇出
+	stopListen()
+	if err := stopReplicator(ctx); err != nil {
+		logger.Error("Replicator did not stop in time", zap.Error(err))
+	}
+	if err := stopFanout(ctx); err != nil {
+		logger.Error("Fanout worker did not stop in time", zap.Error(err))
+	}
+	if err := stopReconciler(ctx); err != nil {
+		logger.Error("Count reconciler did not stop in time", zap.Error(err))
+	}
+	if err := stopRetention(ctx); err != nil {
+		logger.Error("Inbox retention did not stop in time", zap.Error(err))
+	}
 
 	logger.Info("Server exited")
 }
@@ -14,8 +14,10 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"github.com/d60-Lab/gin-template/config"
 	"github.com/d60-Lab/gin-template/internal/model"
 	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/database"
 )
 
 const (
@@ -25,9 +27,8 @@ const (
 	BenchDuration   = 30      // 查询压测时长（秒）
 	ConcurrentLevel = 100     // 并发数
 	
-	// 数据库连接参数
+	// 单库连接参数；分库连接取自配置的 sharding.dsns
 	SingleDBPort = 5434
-	ShardDBStartPort = 5440
 )
 
 type BenchResult struct {
@@ -77,6 +78,9 @@ func main() {
 		fmt.Printf("⚠️  警告：有 %d 个插入失败，查询测试可能不准确\n", singleInsertResult.FailedRequests)
 	}
 	
+	fmt.Println("\n===== 单库 - 路由一致性校验 =====")
+	verifyRouting(ctx, singleRepo, singleOrders)
+	
 	time.Sleep(1 * time.Second)
 	
 	fmt.Println("\n===== 单库压测 - 按订单ID查询 =====")
@@ -112,6 +116,9 @@ func main() {
 		fmt.Printf("⚠️  警告：有 %d 个插入失败，查询测试可能不准确\n", shardedInsertResult.FailedRequests)
 	}
 	
+	fmt.Println("\n===== 分库分表 - 路由一致性校验 =====")
+	verifyRouting(ctx, shardedRepo, shardedOrders)
+	
 	time.Sleep(1 * time.Second)
 	
 	fmt.Println("\n===== 分库分表压测 - 按订单ID查询 =====")
@@ -163,38 +170,30 @@ func prepareSingleDB() repository.OrderRepository {
 	return repo
 }
 
-// prepareShardedDB 准备分库分表环境
+// prepareShardedDB 准备分库分表环境，拓扑取自配置的 sharding 段
 func prepareShardedDB() repository.OrderRepository {
-	var dbs []*gorm.DB
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("加载配置失败: %v\n", err)
+		return nil
+	}
+	cfg.Server.Mode = "release"
+	dbs, err := database.InitShards(cfg)
+	if err != nil {
+		fmt.Printf("连接分片数据库失败: %v\n", err)
+		return nil
+	}
+	fmt.Printf("分片拓扑: %d 个库 x 每库 %d 张表\n", len(dbs), cfg.Sharding.TablesPerDB)
 	
-	for i := 0; i < repository.ShardCount; i++ {
-		port := ShardDBStartPort + i
-		dbName := fmt.Sprintf("orders_shard_%d", i)
-		dsn := fmt.Sprintf("host=localhost user=postgres password=postgres dbname=%s port=%d sslmode=disable", dbName, port)
-		
-		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Silent),
-		})
-		if err != nil {
-			fmt.Printf("连接分片数据库 %d 失败: %v\n", i, err)
-			return nil
-		}
-		
-		// 设置连接池
-		sqlDB, _ := db.DB()
-		sqlDB.SetMaxOpenConns(150)
-		sqlDB.SetMaxIdleConns(30)
-		
-		dbs = append(dbs, db)
-		
+	for _, db := range dbs {
 		// 清理旧数据
-		for j := 0; j < repository.TableCount; j++ {
+		for j := 0; j < cfg.Sharding.TablesPerDB; j++ {
 			tableName := fmt.Sprintf("orders_%d", j)
 			db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName))
 		}
 	}
 	
-	repo, err := repository.NewShardedOrderRepository(dbs)
+	repo, err := repository.NewShardedOrderRepository(dbs, cfg.Sharding.TablesPerDB)
 	if err != nil {
 		fmt.Printf("创建分库分表仓储失败: %v\n", err)
 		return nil
@@ -214,10 +213,13 @@ func prepareShardedDB() repository.OrderRepository {
 func generateTestOrders() []*model.Order {
 	orders := make([]*model.Order, 0, UserCount*OrdersPerUser)
 	baseTime := time.Now().Add(-30 * 24 * time.Hour) // 从30天前开始
+	idGen, err := repository.NewOrderIDGenerator(0)
+	must(err)
 	
 	for userID := int64(1); userID <= UserCount; userID++ {
 		for i := 0; i < OrdersPerUser; i++ {
-			orderID := userID*1000 + int64(i) // 简单的订单ID生成规则
+			orderID, err := idGen.Next(userID) // 低位携带用户基因，按订单ID与按用户ID路由到同一张表
+			must(err)
 			order := &model.Order{
 				OrderID:   orderID,
 				UserID:    userID,
@@ -319,6 +321,37 @@ func benchInsert(ctx context.Context, repo repository.OrderRepository, orders []
 	return calculateResult(name, duration, totalRequests, successRequests, failedRequests, latencies)
 }
 
+// verifyRouting 校验每个已插入的订单都能按订单ID查到，并出现在其用户的订单列表中
+func verifyRouting(ctx context.Context, repo repository.OrderRepository, orders []*model.Order) {
+	var byIDMiss, byUserMiss int
+	userOrders := make(map[int64]map[int64]bool)
+	for _, order := range orders {
+		if _, err := repo.GetByOrderID(ctx, order.OrderID); err != nil {
+			byIDMiss++
+			continue
+		}
+		ids, ok := userOrders[order.UserID]
+		if !ok {
+			list, err := repo.GetByUserID(ctx, order.UserID, OrdersPerUser)
+			if err != nil {
+				fmt.Printf("按用户查询失败: %v (user_id=%d)\n", err, order.UserID)
+			}
+			ids = make(map[int64]bool, len(list))
+			for _, o := range list {
+				ids[o.OrderID] = true
+			}
+			userOrders[order.UserID] = ids
+		}
+		if !ids[order.OrderID] {
+			byUserMiss++
+		}
+	}
+	fmt.Printf("校验订单: %d | 按订单ID未命中: %d | 按用户ID未命中: %d\n", len(orders), byIDMiss, byUserMiss)
+	if byIDMiss > 0 || byUserMiss > 0 {
+		fmt.Println("⚠️  警告：按订单ID与按用户ID的路由不一致")
+	}
+}
+
 // benchQueryByOrderID 压测按订单ID查询
 func benchQueryByOrderID(ctx context.Context, repo repository.OrderRepository, orders []*model.Order, name string) *BenchResult {
 	var (
@@ -49,9 +49,23 @@ func main() {
     if s := os.Getenv("WORKERS"); s != "" { if v, e := strconv.Atoi(s); e == nil && v > 0 { WORKERS = v } }
     if s := os.Getenv("BATCH"); s != "" { if v, e := strconv.Atoi(s); e == nil && v > 0 { BATCH = v } }
     if s := os.Getenv("CLAIM"); s != "" { if v, e := strconv.Atoi(s); e == nil && v > 0 { CLAIM = v } }
+    // MODE=push: 全部写扇出；MODE=hybrid: 粉丝数 >= THRESHOLD 的作者走读时拉取
+    MODE := "push"
+    THRESHOLD := int64(10000)
+    if s := os.Getenv("MODE"); s == "hybrid" { MODE = s }
+    if s := os.Getenv("THRESHOLD"); s != "" { if v, e := strconv.ParseInt(s, 10, 64); e == nil && v > 0 { THRESHOLD = v } }
+    if MODE == "push" { THRESHOLD = 0 }
+    // SHARD>0: 粉丝数超过 SHARD 的帖子切分为分片并行扇出
+    SHARD := 0
+    if s := os.Getenv("SHARD"); s != "" { if v, e := strconv.Atoi(s); e == nil && v > 0 { SHARD = v } }
+    // NOTIFY=1: 发布时 NOTIFY、worker LISTEN 唤醒，对比落地延迟；POLL_MS 为轮询间隔（开启 NOTIFY 时即兜底间隔）
+    NOTIFY := os.Getenv("NOTIFY") == "1"
+    POLL := 20
+    if NOTIFY { POLL = 1000 }
+    if s := os.Getenv("POLL_MS"); s != "" { if v, e := strconv.Atoi(s); e == nil && v > 0 { POLL = v } }
 
     // clean tables for a reproducible run (ok for local bench)
-    _ = db.Exec("TRUNCATE TABLE inbox, outbox, posts, fans, follows, users RESTART IDENTITY CASCADE").Error
+    _ = db.Exec("TRUNCATE TABLE inbox, fanout_shards, outbox, posts, fans, follows, relation_counts, users RESTART IDENTITY CASCADE").Error
 
     // fix composite unique index for inbox (user_id, post_id)
     _ = db.Exec("DROP INDEX IF EXISTS ux_inbox_user_post").Error
@@ -71,9 +85,17 @@ func main() {
     for i := 0; i < N; i++ { _ = fanRepo.Create(context.Background(), author.ID, users[i].ID) }
 
     // start fanout workers
-    worker := service.NewFanoutWorker(db, fanRepo, WORKERS, BATCH, CLAIM, 20*time.Millisecond)
+    worker := service.NewFanoutWorker(db, fanRepo, WORKERS, BATCH, CLAIM, time.Duration(POLL)*time.Millisecond).WithCelebrityThreshold(THRESHOLD).WithSharding(SHARD)
     stop := worker.Start()
     defer stop(context.Background())
+    if NOTIFY {
+        publisher.WithNotify(service.FanoutNotifyChannel)
+        listenCtx, cancelListen := context.WithCancel(context.Background())
+        defer cancelListen()
+        go database.Listen(listenCtx, database.DSN(cfg), service.FanoutNotifyChannel, func(string) { worker.Notify() })
+        // 等监听连接建立，避免首批通知丢失后只能靠兜底轮询
+        time.Sleep(200 * time.Millisecond)
+    }
 
     // publish POSTS
     pubDurations := make([]time.Duration, 0, POSTS)
@@ -101,17 +123,26 @@ PRINT:
     // output
     var pubSum time.Duration
     for _, d := range pubDurations { pubSum += d }
-    fmt.Printf("N=%d POSTS=%d WORKERS=%d BATCH=%d CLAIM=%d\n", N, POSTS, WORKERS, BATCH, CLAIM)
+    fmt.Printf("NOTIFY=%v POLL_MS=%d\n", NOTIFY, POLL)
+    fmt.Printf("MODE=%s THRESHOLD=%d SHARD=%d N=%d POSTS=%d WORKERS=%d BATCH=%d CLAIM=%d\n", MODE, THRESHOLD, SHARD, N, POSTS, WORKERS, BATCH, CLAIM)
     fmt.Printf("Publish tx latency: avg=%v p95=%v p99=%v\n", pubSum/time.Duration(len(pubDurations)), pct(pubDurations, 0.95), pct(pubDurations, 0.99))
     var landSum time.Duration
     for _, d := range land { landSum += d }
     fmt.Printf("Fanout landing (outbox->done): samples=%d avg=%v p95=%v p99=%v\n", len(land), landSum/time.Duration(len(land)), pct(land, 0.95), pct(land, 0.99))
+    var inboxRows int64
+    _ = db.Model(&model.Inbox{}).Count(&inboxRows).Error
+    fmt.Printf("Inbox rows written: %d (write amplification per post: %.1f)\n", inboxRows, float64(inboxRows)/float64(POSTS))
 
-    // measure one user's timeline read (seek first page)
+    // measure one user's timeline read (seek first page + second page via cursor)
     if len(users) > 0 {
+        timeline := service.NewTimelineService(db, followRepo, repository.NewRelationCountRepository(db), THRESHOLD, nil, nil)
         st := time.Now()
-        var rows []model.Inbox
-        _ = db.Where("user_id = ?", users[0].ID).Order("score DESC, id DESC").Limit(50).Find(&rows).Error
-        fmt.Printf("Timeline read (user0, limit=50): %v, rows=%d\n", time.Since(st), len(rows))
+        first := must(timeline.GetTimeline(context.Background(), users[0].ID, "", 50))
+        fmt.Printf("Timeline read (user0, limit=50): %v, rows=%d\n", time.Since(st), len(first.List))
+        if first.NextCursor != "" {
+            st = time.Now()
+            second := must(timeline.GetTimeline(context.Background(), users[0].ID, first.NextCursor, 50))
+            fmt.Printf("Timeline read (user0, page 2 via cursor): %v, rows=%d\n", time.Since(st), len(second.List))
+        }
     }
 }
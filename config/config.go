@@ -1,18 +1,31 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/viper"
+
+	"github.com/d60-Lab/gin-template/pkg/idgen"
 )
 
 // Config 配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Pprof    PprofConfig    `mapstructure:"pprof"`
-	Sentry   SentryConfig   `mapstructure:"sentry"`
-	Tracing  TracingConfig  `mapstructure:"tracing"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	JWT        JWTConfig        `mapstructure:"jwt"`
+	Pprof      PprofConfig      `mapstructure:"pprof"`
+	Sentry     SentryConfig     `mapstructure:"sentry"`
+	Tracing    TracingConfig    `mapstructure:"tracing"`
+	Fanout     FanoutConfig     `mapstructure:"fanout"`
+	Replicator ReplicatorConfig `mapstructure:"replicator"`
+	Counts     CountsConfig     `mapstructure:"counts"`
+	Retention  RetentionConfig  `mapstructure:"retention"`
+	Timeline   TimelineConfig   `mapstructure:"timeline"`
+	Followers  FollowersConfig  `mapstructure:"followers"`
+	Sharding   ShardingConfig   `mapstructure:"sharding"`
+	IDGen      IDGenConfig      `mapstructure:"idgen"`
 }
 
 // ServerConfig 服务器配置
@@ -71,6 +84,184 @@ type TracingConfig struct {
 	JaegerEndpoint string `mapstructure:"jaeger_endpoint"`
 }
 
+// FanoutConfig 时间线扇出 worker 配置
+type FanoutConfig struct {
+	Workers        int `mapstructure:"workers"`
+	BatchSize      int `mapstructure:"batch_size"`
+	ClaimLimit     int `mapstructure:"claim_limit"`
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	// CelebrityThreshold 粉丝数达到该值的作者不再推送 inbox，改为读时拉取；0 表示全部推送
+	CelebrityThreshold int64 `mapstructure:"celebrity_threshold"`
+	// MaxAttempts 单条 outbox 最多尝试次数，超过后置为 failed；LeaseSeconds 处理租约，过期未完成的会被放回 pending
+	MaxAttempts  int `mapstructure:"max_attempts"`
+	LeaseSeconds int `mapstructure:"lease_seconds"`
+	// ShardSize 粉丝数超过该值的帖子按粉丝区间切分为多个分片并行扇出，0 表示不切分
+	ShardSize int `mapstructure:"shard_size"`
+	// Notify 发布时 NOTIFY、worker LISTEN 即时唤醒；开启后 PollIntervalMs 只作为慢速兜底轮询
+	Notify bool `mapstructure:"notify"`
+	// Transport 扇出事件传输："db" 为 worker 直接轮询 outbox；"redis_streams" 由 relay 把 outbox 转发到
+	// Redis Streams，worker 作为消费组成员写 inbox（不切分，ShardSize 不生效）。Redis 不可用时回退到 db
+	Transport string `mapstructure:"transport"`
+	// StreamMaxLen stream 近似最大长度，0 使用默认值
+	StreamMaxLen int64 `mapstructure:"stream_max_len"`
+}
+
+// 扇出事件传输方式
+const (
+	FanoutTransportDB           = "db"
+	FanoutTransportRedisStreams = "redis_streams"
+)
+
+// ReplicatorConfig fans 冗余复制（relation_events 消费）配置
+type ReplicatorConfig struct {
+	Workers        int `mapstructure:"workers"`
+	BatchSize      int `mapstructure:"batch_size"`
+	MaxAttempts    int `mapstructure:"max_attempts"`
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	// TimelineSync 关注后回填作者最近 BackfillPosts 条帖子到关注者 inbox，取关后清理该作者的条目
+	TimelineSync  bool `mapstructure:"timeline_sync"`
+	BackfillPosts int  `mapstructure:"backfill_posts"`
+	// DoneRetentionHours 已完成的 relation_events 保留时长，0 表示不清理
+	DoneRetentionHours int `mapstructure:"done_retention_hours"`
+}
+
+// CountsConfig 关注数/粉丝数缓存与对账配置
+type CountsConfig struct {
+	CacheTTLSeconds          int `mapstructure:"cache_ttl_seconds"`
+	ReconcileIntervalSeconds int `mapstructure:"reconcile_interval_seconds"`
+	ReconcileBatch           int `mapstructure:"reconcile_batch"`
+}
+
+// RetentionConfig inbox 保留策略；MaxPerUser 与 TTLHours 均为 0 时不启动清理
+type RetentionConfig struct {
+	// MaxPerUser 每个用户最多保留的最新 inbox 条数，0 表示不限
+	MaxPerUser int `mapstructure:"max_per_user"`
+	// TTLHours 帖子发布超过该时长的 inbox 条目被删除，0 表示不限
+	TTLHours        int `mapstructure:"ttl_hours"`
+	IntervalSeconds int `mapstructure:"interval_seconds"`
+	// BatchSize 单条 DELETE 的最大行数；MaxDeletesPerSecond 每秒删除行数上限，0 表示不限速
+	BatchSize           int `mapstructure:"batch_size"`
+	MaxDeletesPerSecond int `mapstructure:"max_deletes_per_second"`
+}
+
+// TimelineConfig 时间线读取配置
+type TimelineConfig struct {
+	// CacheSize 每个用户在 Redis ZSET 中缓存的最新条数，0 表示不启用缓存；inbox 保留清理时缓存同步裁剪到 retention.max_per_user
+	CacheSize       int `mapstructure:"cache_size"`
+	CacheTTLSeconds int `mapstructure:"cache_ttl_seconds"`
+}
+
+// FollowersConfig 粉丝列表缓存（Redis list 索引 + 用户快照）配置，需要 Redis
+type FollowersConfig struct {
+	// CacheTTLSeconds 为 0 时不启用缓存，粉丝列表直接读 fans 表
+	CacheTTLSeconds int `mapstructure:"cache_ttl_seconds"`
+	// EmptyTTLSeconds 没有粉丝的用户缓存空列表占位的时长，0 表示不缓存
+	EmptyTTLSeconds int `mapstructure:"empty_ttl_seconds"`
+	// EarlyRefreshBeta 概率提前刷新（XFetch）系数，越大越早刷新，0 表示关闭
+	EarlyRefreshBeta float64 `mapstructure:"early_refresh_beta"`
+	// IndexSize 每个用户缓存的最新粉丝数，超出部分的分页直接读 fans 表；0 使用默认值
+	IndexSize int `mapstructure:"index_size"`
+}
+
+// shardGenes 订单 ID 低 10 位携带的用户基因取值数，库数 × 分表数与桶数都不能超过它
+const shardGenes = 1 << 10
+
+// ShardingConfig 分库分表拓扑，驱动分片仓储的路由与建表；DSNs 为空表示不分片
+type ShardingConfig struct {
+	// DSNs 各分库的 Postgres 连接串，下标即库序号；上线后增删或调整顺序都会改变路由
+	DSNs []string `mapstructure:"dsns"`
+	// TablesPerDB 每个库的分表数，同样参与路由
+	TablesPerDB  int `mapstructure:"tables_per_db"`
+	MaxOpenConns int `mapstructure:"max_open_conns"`
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// Buckets 订单虚拟桶数（2 的幂），大于 0 时按桶路由（映射表 shard_buckets 在主库），上线后不可修改；0 表示按库表路由
+	Buckets int `mapstructure:"buckets"`
+	// BucketRefreshSeconds 各进程重新加载桶映射的间隔，迁移工具每次切换后至少等待两倍该时长
+	BucketRefreshSeconds int `mapstructure:"bucket_refresh_seconds"`
+}
+
+// Enabled 是否配置了分库
+func (c ShardingConfig) Enabled() bool {
+	return len(c.DSNs) > 0
+}
+
+// Validate 校验分片拓扑，未启用时不校验
+func (c ShardingConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.TablesPerDB <= 0 {
+		return fmt.Errorf("sharding.tables_per_db must be positive, got %d", c.TablesPerDB)
+	}
+	if len(c.DSNs)*c.TablesPerDB > shardGenes {
+		return fmt.Errorf("sharding.dsns (%d) x sharding.tables_per_db (%d) must not exceed %d", len(c.DSNs), c.TablesPerDB, shardGenes)
+	}
+	seen := make(map[string]int, len(c.DSNs))
+	for i, dsn := range c.DSNs {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			return fmt.Errorf("sharding.dsns[%d] is empty", i)
+		}
+		if j, ok := seen[dsn]; ok {
+			return fmt.Errorf("sharding.dsns[%d] duplicates sharding.dsns[%d]", i, j)
+		}
+		seen[dsn] = i
+	}
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return fmt.Errorf("sharding.max_open_conns and sharding.max_idle_conns must not be negative")
+	}
+	if c.Buckets < 0 {
+		return fmt.Errorf("sharding.buckets must not be negative, got %d", c.Buckets)
+	}
+	if c.Buckets > 0 {
+		if c.Buckets < len(c.DSNs) {
+			return fmt.Errorf("sharding.buckets (%d) must be at least the number of sharding.dsns (%d)", c.Buckets, len(c.DSNs))
+		}
+		if c.Buckets&(c.Buckets-1) != 0 || c.Buckets > shardGenes {
+			return fmt.Errorf("sharding.buckets must be a power of two no greater than %d, got %d", shardGenes, c.Buckets)
+		}
+		if c.BucketRefreshSeconds <= 0 {
+			return fmt.Errorf("sharding.bucket_refresh_seconds must be positive when sharding.buckets is set")
+		}
+	}
+	return nil
+}
+
+// IDGenConfig 分布式 ID 生成（订单、帖子、inbox 的主键）
+type IDGenConfig struct {
+	// WorkerID 本进程的 worker ID，多实例部署时必须各不相同；不设默认值，由部署按实例指定（环境变量 IDGEN_WORKER_ID）
+	WorkerID *int64 `mapstructure:"worker_id"`
+	// MaxBackwardMs 容忍的时钟回拨毫秒数，回拨不超过该值时等待时钟追上，超过则生成失败；0 表示回拨即失败
+	MaxBackwardMs int `mapstructure:"max_backward_ms"`
+}
+
+// Validate 校验 worker ID 范围；未设置时不报错，只有生成 ID 的进程需要（见 Worker）
+func (c IDGenConfig) Validate() error {
+	if c.WorkerID != nil && (*c.WorkerID < 0 || *c.WorkerID >= 1<<idgen.DefaultWorkerBits) {
+		return fmt.Errorf("idgen.worker_id must be in [0, %d), got %d", 1<<idgen.DefaultWorkerBits, *c.WorkerID)
+	}
+	if c.MaxBackwardMs < 0 {
+		return fmt.Errorf("idgen.max_backward_ms must not be negative, got %d", c.MaxBackwardMs)
+	}
+	return nil
+}
+
+// Worker 返回显式指定的 worker ID。多个实例共用同一个 worker ID 会生成重复的主键，因此未设置时报错而不是默认为 0
+func (c IDGenConfig) Worker() (int64, error) {
+	if c.WorkerID == nil {
+		return 0, fmt.Errorf("idgen.worker_id is not set; assign a unique id per instance via config or IDGEN_WORKER_ID")
+	}
+	return *c.WorkerID, nil
+}
+
+// Validate 启动时校验配置
+func (c *Config) Validate() error {
+	if err := c.Sharding.Validate(); err != nil {
+		return err
+	}
+	return c.IDGen.Validate()
+}
+
 // Load 加载配置
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
@@ -80,6 +271,10 @@ func Load() (*Config, error) {
 
 	// 支持环境变量覆盖
 	viper.AutomaticEnv()
+	// worker ID 按实例分配，通常由编排系统注入（如 StatefulSet 序号）
+	if err := viper.BindEnv("idgen.worker_id", "IDGEN_WORKER_ID"); err != nil {
+		return nil, err
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -89,6 +284,9 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return &config, nil
 }
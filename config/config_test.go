@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardingConfigValidate(t *testing.T) {
+	assert.NoError(t, ShardingConfig{}.Validate())
+
+	valid := ShardingConfig{DSNs: []string{"dbname=s0", "dbname=s1"}, TablesPerDB: 4}
+	assert.NoError(t, valid.Validate())
+
+	cases := map[string]ShardingConfig{
+		"sharding.tables_per_db must be positive, got 0":                                {DSNs: []string{"dbname=s0"}},
+		"sharding.dsns[1] is empty":                                                     {DSNs: []string{"dbname=s0", " "}, TablesPerDB: 4},
+		"sharding.dsns[2] duplicates sharding.dsns[0]":                                  {DSNs: []string{"dbname=s0", "dbname=s1", "dbname=s0"}, TablesPerDB: 4},
+		"sharding.max_open_conns and sharding.max_idle_conns must not be negative":      {DSNs: []string{"dbname=s0"}, TablesPerDB: 4, MaxOpenConns: -1},
+		"sharding.buckets (1) must be at least the number of sharding.dsns (2)":         {DSNs: []string{"dbname=s0", "dbname=s1"}, TablesPerDB: 4, Buckets: 1, BucketRefreshSeconds: 10},
+		"sharding.bucket_refresh_seconds must be positive when sharding.buckets is set": {DSNs: []string{"dbname=s0"}, TablesPerDB: 4, Buckets: 64},
+		"sharding.buckets must be a power of two no greater than 1024, got 48":          {DSNs: []string{"dbname=s0"}, TablesPerDB: 4, Buckets: 48, BucketRefreshSeconds: 10},
+		"sharding.dsns (2) x sharding.tables_per_db (600) must not exceed 1024":         {DSNs: []string{"dbname=s0", "dbname=s1"}, TablesPerDB: 600},
+	}
+	for msg, cfg := range cases {
+		assert.EqualError(t, cfg.Validate(), msg)
+	}
+}
+
+func TestIDGenConfigValidate(t *testing.T) {
+	worker := func(id int64) *int64 { return &id }
+	assert.NoError(t, IDGenConfig{WorkerID: worker(31), MaxBackwardMs: 10}.Validate())
+	assert.EqualError(t, IDGenConfig{WorkerID: worker(32)}.Validate(), "idgen.worker_id must be in [0, 32), got 32")
+	assert.EqualError(t, IDGenConfig{MaxBackwardMs: -1}.Validate(), "idgen.max_backward_ms must not be negative, got -1")
+
+	// 未指定 worker ID 时不能静默地使用 0
+	assert.NoError(t, IDGenConfig{}.Validate())
+	_, err := IDGenConfig{}.Worker()
+	assert.Error(t, err)
+	id, err := IDGenConfig{WorkerID: worker(0)}.Worker()
+	assert.NoError(t, err)
+	assert.Zero(t, id)
+}
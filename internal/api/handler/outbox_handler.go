@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/response"
+)
+
+// ListFailedOutbox 查看扇出失败的外发盒记录
+// @Summary 列出 failed 状态的 outbox（管理员）
+// @Tags 管理
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，最多 100" default(20)
+// @Param cursor query string false "seek 游标，首页不传"
+// @Success 200 {object} response.Response{data=dto.OutboxListResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/admin/outbox/failed [get]
+func (h *Handler) ListFailedOutbox(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	resp, err := h.outboxService.ListFailed(c.Request.Context(), c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	response.Success(c, resp)
+}
+
+// RequeueOutbox 重新入队
+// @Summary 把 failed 状态的 outbox 重置为 pending 重新扇出（管理员）
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body dto.RequeueOutboxRequest true "outbox id 列表，最多 100 个"
+// @Success 200 {object} response.Response{data=dto.RequeueOutboxResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/admin/outbox/requeue [post]
+func (h *Handler) RequeueOutbox(c *gin.Context) {
+	var req dto.RequeueOutboxRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	n, err := h.outboxService.Requeue(c.Request.Context(), req.IDs)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.Success(c, &dto.RequeueOutboxResponse{Requeued: n})
+}
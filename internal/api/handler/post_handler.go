@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/response"
+)
+
+// CreatePost 发布内容
+// @Summary 发布内容（写 posts + outbox，异步扇出到粉丝时间线）
+// @Tags 时间线
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body dto.CreatePostRequest true "内容"
+// @Success 200 {object} response.Response{data=dto.CreatePostResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/posts [post]
+func (h *Handler) CreatePost(c *gin.Context) {
+	var req dto.CreatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	// 作者取自 JWT，不信任请求体
+	authorID := c.GetString("userID")
+	if authorID == "" {
+		response.Unauthorized(c)
+		return
+	}
+
+	postID, err := h.publisher.Publish(c.Request.Context(), authorID, req.Payload)
+	if err != nil {
+		response.InternalError(c, err)
+		return
+	}
+	response.Success(c, &dto.CreatePostResponse{PostID: postID})
+}
+
+// UpdatePost 编辑内容
+// @Summary 编辑内容（仅作者；时间线读取时即为新内容）
+// @Tags 时间线
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "帖子ID"
+// @Param request body dto.UpdatePostRequest true "内容"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/posts/{id} [put]
+func (h *Handler) UpdatePost(c *gin.Context) {
+	var req dto.UpdatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	authorID := c.GetString("userID")
+	if authorID == "" {
+		response.Unauthorized(c)
+		return
+	}
+	if err := h.publisher.Edit(c.Request.Context(), authorID, c.Param("id"), req.Payload); err != nil {
+		respondPostError(c, err)
+		return
+	}
+	response.Success(c, nil)
+}
+
+// DeletePost 删除内容
+// @Summary 删除内容（仅作者；立即从时间线隐藏，inbox 由扇出 worker 异步清理）
+// @Tags 时间线
+// @Produce json
+// @Security Bearer
+// @Param id path string true "帖子ID"
+// @Success 200 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/posts/{id} [delete]
+func (h *Handler) DeletePost(c *gin.Context) {
+	authorID := c.GetString("userID")
+	if authorID == "" {
+		response.Unauthorized(c)
+		return
+	}
+	if err := h.publisher.Retract(c.Request.Context(), authorID, c.Param("id")); err != nil {
+		respondPostError(c, err)
+		return
+	}
+	response.Success(c, nil)
+}
+
+func respondPostError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPostNotFound):
+		response.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrNotPostAuthor):
+		response.Forbidden(c, err.Error())
+	default:
+		response.InternalError(c, err)
+	}
+}
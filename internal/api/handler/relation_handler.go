@@ -1,16 +1,21 @@
 package handler
 
 import (
+    "context"
+    "errors"
+    "net/http"
     "strconv"
+    "strings"
 
     "github.com/gin-gonic/gin"
 
+    "github.com/d60-Lab/gin-template/internal/service"
     "github.com/d60-Lab/gin-template/pkg/response"
 )
 
-type followRequest struct {
-    FromUserID string `json:"from_user_id" binding:"required"`
-    ToUserID   string `json:"to_user_id" binding:"required"`
+// relationTargetRequest 关注/拉黑/屏蔽类操作的目标，操作者取自 JWT
+type relationTargetRequest struct {
+    ToUserID string `json:"to_user_id" binding:"required"`
 }
 
 // Follow 建立关注（异步写粉丝表）
@@ -18,22 +23,16 @@ type followRequest struct {
 // @Tags 关系链
 // @Accept json
 // @Produce json
-// @Param request body followRequest true "关注信息"
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户关注 to_user_id"
 // @Success 200 {object} response.Response
 // @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/relations/follow [post]
 func (h *Handler) Follow(c *gin.Context) {
-    var req followRequest
-    if err := c.ShouldBindJSON(&req); err != nil {
-        response.BadRequest(c, err.Error())
-        return
-    }
-    if err := h.relService.Follow(c.Request.Context(), req.FromUserID, req.ToUserID); err != nil {
-        response.BadRequest(c, err.Error())
-        return
-    }
-    response.Success(c, nil)
+    h.bindRelationAction(c, h.relService.Follow)
 }
 
 // Unfollow 取消关注
@@ -41,36 +40,142 @@ func (h *Handler) Follow(c *gin.Context) {
 // @Tags 关系链
 // @Accept json
 // @Produce json
-// @Param request body followRequest true "取消关注信息"
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户取消关注 to_user_id"
 // @Success 200 {object} response.Response
 // @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/relations/unfollow [post]
 func (h *Handler) Unfollow(c *gin.Context) {
-    var req followRequest
+    h.bindRelationAction(c, h.relService.Unfollow)
+}
+
+// Block 拉黑用户
+// @Summary 拉黑用户（同时解除双方关注，之后双方都不能关注对方）
+// @Tags 关系链
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户拉黑 to_user_id"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /api/v1/relations/block [post]
+func (h *Handler) Block(c *gin.Context) {
+    h.bindRelationAction(c, h.relService.Block)
+}
+
+// Unblock 取消拉黑
+// @Summary 取消拉黑
+// @Tags 关系链
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户取消拉黑 to_user_id"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /api/v1/relations/unblock [post]
+func (h *Handler) Unblock(c *gin.Context) {
+    h.bindRelationAction(c, h.relService.Unblock)
+}
+
+// Mute 屏蔽用户
+// @Summary 屏蔽用户（保留关注，但时间线不再出现其帖子）
+// @Tags 关系链
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户屏蔽 to_user_id"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /api/v1/relations/mute [post]
+func (h *Handler) Mute(c *gin.Context) {
+    h.bindRelationAction(c, h.relService.Mute)
+}
+
+// Unmute 取消屏蔽
+// @Summary 取消屏蔽
+// @Tags 关系链
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body relationTargetRequest true "当前用户取消屏蔽 to_user_id"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /api/v1/relations/unmute [post]
+func (h *Handler) Unmute(c *gin.Context) {
+    h.bindRelationAction(c, h.relService.Unmute)
+}
+
+// bindRelationAction 解析 relationTargetRequest 并以 JWT 中的用户执行 -> to 的关系操作
+func (h *Handler) bindRelationAction(c *gin.Context, action func(ctx context.Context, from, to string) error) {
+    var req relationTargetRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         response.BadRequest(c, err.Error())
         return
     }
-    if err := h.relService.Unfollow(c.Request.Context(), req.FromUserID, req.ToUserID); err != nil {
-        response.BadRequest(c, err.Error())
+    // 操作者取自 JWT，不信任请求体
+    userID := c.GetString("userID")
+    if userID == "" {
+        response.Unauthorized(c)
+        return
+    }
+    if err := action(c.Request.Context(), userID, req.ToUserID); err != nil {
+        respondRelationActionError(c, err)
         return
     }
     response.Success(c, nil)
 }
 
+func respondRelationActionError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, service.ErrFollowSelf), errors.Is(err, service.ErrBlockSelf), errors.Is(err, service.ErrMuteSelf), errors.Is(err, service.ErrTooManyMutes):
+        response.BadRequest(c, err.Error())
+    case errors.Is(err, service.ErrBlocked):
+        response.Forbidden(c, err.Error())
+    case errors.Is(err, service.ErrBlockMuteUnavailable):
+        response.Error(c, http.StatusServiceUnavailable, err.Error())
+    default:
+        response.InternalError(c, err)
+    }
+}
+
 // ListFollowing 查询某用户关注的人
 // @Summary 查询关注列表
 // @Tags 关系链
 // @Param user_id path string true "用户ID"
-// @Param page query int false "页码" default(1)
-// @Param page_size query int false "每页数量" default(10)
+// @Param page query int false "页码（旧版 offset 分页）" default(1)
+// @Param page_size query int false "每页数量；游标分页时最多 100，响应中回显实际生效的值" default(10)
+// @Param cursor query string false "seek 游标；携带该参数（首页传空）即切换为游标分页，返回 next_cursor"
 // @Success 200 {object} response.Response{data=map[string]interface{}}
+// @Failure 400 {object} response.Response
 // @Router /api/v1/relations/{user_id}/following [get]
 func (h *Handler) ListFollowing(c *gin.Context) {
     userID := c.Param("user_id")
-    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
     pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+    if cursor, ok := c.GetQuery("cursor"); ok {
+        pageSize = service.ClampRelationLimit(pageSize)
+        list, next, err := h.relService.ListFollowingByCursor(c.Request.Context(), userID, cursor, pageSize)
+        if err != nil {
+            h.relationListError(c, err)
+            return
+        }
+        response.Success(c, gin.H{"page_size": pageSize, "list": list, "next_cursor": next})
+        return
+    }
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
     list, err := h.relService.ListFollowing(c.Request.Context(), userID, page, pageSize)
     if err != nil {
         response.InternalError(c, err)
@@ -83,14 +188,26 @@ func (h *Handler) ListFollowing(c *gin.Context) {
 // @Summary 查询粉丝列表（来自冗余表）
 // @Tags 关系链
 // @Param user_id path string true "用户ID"
-// @Param page query int false "页码" default(1)
-// @Param page_size query int false "每页数量" default(10)
+// @Param page query int false "页码（旧版 offset 分页）" default(1)
+// @Param page_size query int false "每页数量；游标分页时最多 100，响应中回显实际生效的值" default(10)
+// @Param cursor query string false "seek 游标；携带该参数（首页传空）即切换为游标分页，返回 next_cursor"
 // @Success 200 {object} response.Response{data=map[string]interface{}}
+// @Failure 400 {object} response.Response
 // @Router /api/v1/relations/{user_id}/fans [get]
 func (h *Handler) ListFans(c *gin.Context) {
     userID := c.Param("user_id")
-    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
     pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+    if cursor, ok := c.GetQuery("cursor"); ok {
+        pageSize = service.ClampRelationLimit(pageSize)
+        list, next, err := h.relService.ListFansByCursor(c.Request.Context(), userID, cursor, pageSize)
+        if err != nil {
+            h.relationListError(c, err)
+            return
+        }
+        response.Success(c, gin.H{"page_size": pageSize, "list": list, "next_cursor": next})
+        return
+    }
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
     list, err := h.relService.ListFans(c.Request.Context(), userID, page, pageSize)
     if err != nil {
         response.InternalError(c, err)
@@ -98,3 +215,127 @@ func (h *Handler) ListFans(c *gin.Context) {
     }
     response.Success(c, gin.H{"page": page, "page_size": pageSize, "list": list})
 }
+
+// GetRelationStatus 查询关系状态
+// @Summary 查询 user_id 与 targets 的关注关系（是否关注、是否被关注、是否互关）
+// @Tags 关系链
+// @Produce json
+// @Param user_id path string true "查看者用户ID"
+// @Param targets query string true "目标用户ID，逗号分隔，最多 100 个"
+// @Success 200 {object} response.Response{data=[]dto.RelationStatus}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/relations/{user_id}/status [get]
+func (h *Handler) GetRelationStatus(c *gin.Context) {
+    viewer := c.Param("user_id")
+    var targets []string
+    for _, t := range strings.Split(c.Query("targets"), ",") {
+        if t = strings.TrimSpace(t); t != "" { targets = append(targets, t) }
+    }
+    if len(targets) == 0 {
+        response.BadRequest(c, "targets is required")
+        return
+    }
+    list, err := h.relService.BatchGetRelations(c.Request.Context(), viewer, targets)
+    if err != nil {
+        if errors.Is(err, service.ErrTooManyTargets) {
+            response.BadRequest(c, err.Error())
+            return
+        }
+        response.InternalError(c, err)
+        return
+    }
+    response.Success(c, list)
+}
+
+// GetRelationCounts 查询关注数与粉丝数
+// @Summary 查询用户的关注数与粉丝数（Redis 缓存，定期与明细表对账）
+// @Tags 关系链
+// @Produce json
+// @Param user_id path string true "用户ID"
+// @Success 200 {object} response.Response{data=dto.RelationCounts}
+// @Failure 500 {object} response.Response
+// @Router /api/v1/relations/{user_id}/counts [get]
+func (h *Handler) GetRelationCounts(c *gin.Context) {
+    counts, err := h.relService.GetCounts(c.Request.Context(), c.Param("user_id"))
+    if err != nil {
+        response.InternalError(c, err)
+        return
+    }
+    response.Success(c, counts)
+}
+
+// ListMutuals 查询共同关注
+// @Summary 查询 user_id 与 target 共同关注的人
+// @Tags 关系链
+// @Produce json
+// @Param user_id path string true "用户ID"
+// @Param target query string true "另一个用户ID"
+// @Param limit query int false "返回数量，最多 100" default(20)
+// @Success 200 {object} response.Response{data=[]string}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/relations/{user_id}/mutuals [get]
+func (h *Handler) ListMutuals(c *gin.Context) {
+    target := c.Query("target")
+    if target == "" {
+        response.BadRequest(c, "target is required")
+        return
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    list, err := h.relService.ListMutuals(c.Request.Context(), c.Param("user_id"), target, limit)
+    if err != nil {
+        response.InternalError(c, err)
+        return
+    }
+    response.Success(c, list)
+}
+
+// ListFriends 查询互关好友
+// @Summary 查询互相关注的好友（游标分页）
+// @Tags 关系链
+// @Produce json
+// @Param user_id path string true "用户ID"
+// @Param limit query int false "每页数量，最多 100" default(20)
+// @Param cursor query string false "seek 游标，首页不传"
+// @Success 200 {object} response.Response{data=map[string]interface{}}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/relations/{user_id}/friends [get]
+func (h *Handler) ListFriends(c *gin.Context) {
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    list, next, err := h.relService.ListFriends(c.Request.Context(), c.Param("user_id"), c.Query("cursor"), limit)
+    if err != nil {
+        h.relationListError(c, err)
+        return
+    }
+    response.Success(c, gin.H{"list": list, "next_cursor": next})
+}
+
+// RecommendUsers 可能认识的人
+// @Summary 基于二度关注推荐用户，按重合度降序
+// @Tags 关系链
+// @Produce json
+// @Param user_id path string true "用户ID"
+// @Param limit query int false "返回数量，最多 100" default(20)
+// @Success 200 {object} response.Response{data=[]dto.RecommendedUser}
+// @Failure 500 {object} response.Response
+// @Router /api/v1/relations/{user_id}/recommendations [get]
+func (h *Handler) RecommendUsers(c *gin.Context) {
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    list, err := h.relService.RecommendUsers(c.Request.Context(), c.Param("user_id"), limit)
+    if err != nil {
+        response.InternalError(c, err)
+        return
+    }
+    response.Success(c, list)
+}
+
+// relationListError 游标非法返回 400，其余按内部错误处理
+func (h *Handler) relationListError(c *gin.Context, err error) {
+    if errors.Is(err, service.ErrInvalidCursor) {
+        response.BadRequest(c, err.Error())
+        return
+    }
+    response.InternalError(c, err)
+}
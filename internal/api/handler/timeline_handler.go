@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/d60-Lab/gin-template/internal/service"
+	"github.com/d60-Lab/gin-template/pkg/response"
+)
+
+// GetTimeline 查询用户时间线
+// @Summary 查询时间线（seek 游标分页）
+// @Tags 时间线
+// @Produce json
+// @Param user_id path string true "用户ID"
+// @Param cursor query string false "上一页返回的 next_cursor"
+// @Param limit query int false "每页数量" default(20)
+// @Success 200 {object} response.Response{data=dto.TimelineResponse}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/timeline/{user_id} [get]
+func (h *Handler) GetTimeline(c *gin.Context) {
+	userID := c.Param("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	resp, err := h.timelineService.GetTimeline(c.Request.Context(), userID, c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		response.InternalError(c, err)
+		return
+	}
+	response.Success(c, resp)
+}
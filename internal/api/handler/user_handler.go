@@ -12,15 +12,21 @@ import (
 
 // Handler 处理器结构
 type Handler struct {
-	userService service.UserService
-    relService  service.RelationshipService
+	userService     service.UserService
+	relService      service.RelationshipService
+	timelineService service.TimelineService
+	publisher       *service.Publisher
+	outboxService   service.OutboxService
 }
 
 // NewHandler 创建处理器实例
-func NewHandler(userService service.UserService, relService service.RelationshipService) *Handler {
+func NewHandler(userService service.UserService, relService service.RelationshipService, timelineService service.TimelineService, publisher *service.Publisher, outboxService service.OutboxService) *Handler {
 	return &Handler{
-        userService: userService,
-        relService:  relService,
+		userService:     userService,
+		relService:      relService,
+		timelineService: timelineService,
+		publisher:       publisher,
+		outboxService:   outboxService,
 	}
 }
 
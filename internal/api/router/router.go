@@ -64,10 +64,40 @@ func Setup(r *gin.Engine, h *handler.Handler, cfg *config.Config) {
 		// 关系链模块
 		relations := v1.Group("/relations")
 		{
-			relations.POST("/follow", h.Follow)
-			relations.POST("/unfollow", h.Unfollow)
+			relations.POST("/follow", middleware.Auth(cfg), h.Follow)
+			relations.POST("/unfollow", middleware.Auth(cfg), h.Unfollow)
+			relations.POST("/block", middleware.Auth(cfg), h.Block)
+			relations.POST("/unblock", middleware.Auth(cfg), h.Unblock)
+			relations.POST("/mute", middleware.Auth(cfg), h.Mute)
+			relations.POST("/unmute", middleware.Auth(cfg), h.Unmute)
 			relations.GET("/:user_id/following", h.ListFollowing)
 			relations.GET("/:user_id/fans", h.ListFans)
+			relations.GET("/:user_id/status", h.GetRelationStatus)
+			relations.GET("/:user_id/counts", h.GetRelationCounts)
+			relations.GET("/:user_id/mutuals", h.ListMutuals)
+			relations.GET("/:user_id/friends", h.ListFriends)
+			relations.GET("/:user_id/recommendations", h.RecommendUsers)
+		}
+
+		// 时间线模块
+		timeline := v1.Group("/timeline")
+		{
+			timeline.GET("/:user_id", h.GetTimeline)
+		}
+
+		// 内容发布模块
+		posts := v1.Group("/posts")
+		{
+			posts.POST("", middleware.Auth(cfg), h.CreatePost)
+			posts.PUT("/:id", middleware.Auth(cfg), h.UpdatePost)
+			posts.DELETE("/:id", middleware.Auth(cfg), h.DeletePost)
+		}
+
+		// 管理端
+		admin := v1.Group("/admin", middleware.Auth(cfg), middleware.AdminOnly())
+		{
+			admin.GET("/outbox/failed", h.ListFailedOutbox)
+			admin.POST("/outbox/requeue", h.RequeueOutbox)
 		}
 	}
 }
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/rand"
 	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 
 	"github.com/d60-Lab/gin-template/internal/model"
@@ -22,21 +25,85 @@ type FollowerSnapshot struct {
 }
 
 // FollowerService demonstrates different caching strategies for follower list reads.
+// The optimized strategy (Redis list index + per-user snapshots) also backs the /fans
+// endpoint; follow changes and profile updates maintain it through OnFollow/OnUnfollow
+// and InvalidateUser.
+//
+// The index only holds the newest indexSize fans; pages past that window are read from
+// the fans table directly, so a user with millions of fans is never loaded in full.
+//
+// Index rebuilds are protected against stampedes: concurrent misses for the same user
+// share one load, hot indexes are refreshed in the background shortly before they
+// expire, and users without fans are cached as a short-lived empty sentinel.
 type FollowerService struct {
 	db      *gorm.DB
 	cache   *redis.Client
 	ttl     time.Duration
 	dbDelay time.Duration
 
-	pageQueries  atomic.Int64
-	indexLoads   atomic.Int64
-	userBulkLoad atomic.Int64
+	coalesce  bool
+	beta      float64
+	emptyTTL  time.Duration
+	indexSize int
+	group     singleflight.Group
+
+	pageQueries    atomic.Int64
+	indexLoads     atomic.Int64
+	userBulkLoad   atomic.Int64
+	earlyRefreshes atomic.Int64
 }
 
-// NewFollowerService builds a demo service using the provided DB + Redis client.
-// dbDelay simulates the round-trip cost of hitting the primary store.
+const (
+	defaultEarlyRefreshBeta = 1.0
+	defaultEmptyTTL         = 30 * time.Second
+	defaultIndexSize        = 5000
+
+	// followersEndMarker terminates an index that holds all of the user's fans; an index
+	// without it was cut at indexSize. A user without fans is cached as the marker alone.
+	followersEndMarker = "$end"
+)
+
+// NewFollowerService builds the service using the provided DB + Redis client.
+// dbDelay simulates the round-trip cost of hitting the primary store (0 outside benchmarks).
 func NewFollowerService(db *gorm.DB, cache *redis.Client, ttl, dbDelay time.Duration) *FollowerService {
-	return &FollowerService{db: db, cache: cache, ttl: ttl, dbDelay: dbDelay}
+	return &FollowerService{
+		db:        db,
+		cache:     cache,
+		ttl:       ttl,
+		dbDelay:   dbDelay,
+		coalesce:  true,
+		beta:      defaultEarlyRefreshBeta,
+		emptyTTL:  defaultEmptyTTL,
+		indexSize: defaultIndexSize,
+	}
+}
+
+// WithCoalescing toggles sharing one index load between concurrent misses of the same user.
+func (s *FollowerService) WithCoalescing(enabled bool) *FollowerService {
+	s.coalesce = enabled
+	return s
+}
+
+// WithEarlyRefresh sets the beta of probabilistic early refresh (XFetch): a hit refreshes the
+// index in the background when the user's last load time * beta * -ln(rand) exceeds its remaining TTL.
+// Larger values refresh earlier; 0 disables it.
+func (s *FollowerService) WithEarlyRefresh(beta float64) *FollowerService {
+	s.beta = beta
+	return s
+}
+
+// WithEmptyTTL sets how long a user without fans stays cached; 0 disables the sentinel.
+func (s *FollowerService) WithEmptyTTL(ttl time.Duration) *FollowerService {
+	s.emptyTTL = ttl
+	return s
+}
+
+// WithIndexSize caps how many of the newest fans the index holds; values below 1 keep the default.
+func (s *FollowerService) WithIndexSize(n int) *FollowerService {
+	if n > 0 {
+		s.indexSize = n
+	}
+	return s
 }
 
 func (s *FollowerService) FetchFollowersNoCache(ctx context.Context, userID string, page, size int) ([]FollowerSnapshot, error) {
@@ -63,69 +130,229 @@ func (s *FollowerService) FetchFollowersNaiveCache(ctx context.Context, userID s
 }
 
 func (s *FollowerService) FetchFollowersOptimized(ctx context.Context, userID string, page, size int) ([]FollowerSnapshot, error) {
-	key := fmt.Sprintf("followers:index:%s", userID)
-	
-	// Calculate range
+	ids, err := s.FetchFollowerIDs(ctx, userID, page, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadUsers(ctx, ids)
+}
+
+// FetchFollowerIDs pages follower IDs (newest first) from the Redis list index, rebuilding
+// the index from the newest fans when it is absent. Pages that run past a truncated index
+// are read from the fans table.
+func (s *FollowerService) FetchFollowerIDs(ctx context.Context, userID string, page, size int) ([]string, error) {
+	if page < 1 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 20
+	}
 	start := (page - 1) * size
 	end := start + size - 1
-	
-	// Try to get IDs directly from Redis List with range query
-	exists, _ := s.cache.Exists(ctx, key).Result()
-	var ids []string
-	
-	if exists > 0 {
-		// Use LRANGE to get only the needed IDs (efficient!)
-		ids, _ = s.cache.LRange(ctx, key, int64(start), int64(end)).Result()
-	}
-	
-	// If cache miss, load all IDs and cache them
-	if len(ids) == 0 {
-		allIDs, err := s.loadFollowerIDsAndCache(ctx, userID)
-		if err != nil {
-			return nil, err
-		}
-		
-		if start >= len(allIDs) {
-			return []FollowerSnapshot{}, nil
+
+	// An existing index is authoritative within its window, and past its end when complete
+	key := followerIndexKey(userID)
+	var pttl *redis.DurationCmd
+	var ids *redis.StringSliceCmd
+	var delta *redis.StringCmd
+	if _, err := s.cache.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pttl = pipe.PTTL(ctx, key)
+		ids = pipe.LRange(ctx, key, int64(start), int64(end))
+		delta = pipe.Get(ctx, followerLoadKey(userID))
+		return nil
+	}); (err == nil || err == redis.Nil) && pttl.Val() != -2 {
+		loadTime, _ := delta.Int64()
+		if s.shouldRefreshEarly(time.Duration(loadTime), pttl.Val()) {
+			s.refreshInBackground(ctx, userID)
 		}
-		endIdx := start + size
-		if endIdx > len(allIDs) {
-			endIdx = len(allIDs)
+		if page, ok := pageFromIndex(ids.Val(), size); ok {
+			return page, nil
 		}
-		ids = allIDs[start:endIdx]
+		return s.queryFollowerIDs(ctx, userID, start, size)
 	}
 
-	snapshots, err := s.loadUsers(ctx, ids)
+	// Cache miss: load the newest fans and cache them
+	index, err := s.loadFollowerIDs(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	return snapshots, nil
+	if start+size > len(index.ids) && !index.complete {
+		return s.queryFollowerIDs(ctx, userID, start, size)
+	}
+	if start >= len(index.ids) {
+		return []string{}, nil
+	}
+	endIdx := start + size
+	if endIdx > len(index.ids) {
+		endIdx = len(index.ids)
+	}
+	return index.ids[start:endIdx], nil
+}
+
+// followerIndex is the newest fans of a user as cached; complete reports whether it holds all of them.
+type followerIndex struct {
+	ids      []string
+	complete bool
 }
 
-func (s *FollowerService) loadFollowerIDsAndCache(ctx context.Context, userID string) ([]string, error) {
+// loadFollowerIDs rebuilds the index, sharing the load between concurrent callers
+// when coalescing is on. The shared load is detached from the caller's cancellation
+// so one aborted request does not fail the others.
+func (s *FollowerService) loadFollowerIDs(ctx context.Context, userID string) (followerIndex, error) {
+	if !s.coalesce {
+		return s.loadFollowerIDsAndCache(ctx, userID)
+	}
+	v, err, _ := s.group.Do(userID, func() (interface{}, error) {
+		return s.loadFollowerIDsAndCache(context.WithoutCancel(ctx), userID)
+	})
+	if err != nil {
+		return followerIndex{}, err
+	}
+	return v.(followerIndex), nil
+}
+
+// shouldRefreshEarly implements XFetch: the closer the index is to expiry and the
+// slower it is to rebuild (delta, the last load time of this user's index), the more
+// likely a hit triggers a refresh. An unknown delta never refreshes early.
+func (s *FollowerService) shouldRefreshEarly(delta, remaining time.Duration) bool {
+	if s.beta <= 0 || remaining <= 0 || delta <= 0 {
+		return false
+	}
+	return float64(delta)*s.beta*-math.Log(rand.Float64()) >= float64(remaining)
+}
+
+// refreshInBackground reloads the index without blocking the hit that triggered it;
+// at most one refresh per user runs at a time.
+func (s *FollowerService) refreshInBackground(ctx context.Context, userID string) {
+	s.earlyRefreshes.Add(1)
+	ctx = context.WithoutCancel(ctx)
+	s.group.DoChan(userID, func() (interface{}, error) {
+		return s.loadFollowerIDsAndCache(ctx, userID)
+	})
+}
+
+// pageFromIndex returns the page read from the index, or false when the page runs past
+// the end of a truncated index and must be read from the fans table.
+func pageFromIndex(ids []string, size int) ([]string, bool) {
+	if n := len(ids); n > 0 && ids[n-1] == followersEndMarker {
+		return ids[:n-1], true
+	}
+	return ids, len(ids) == size
+}
+
+// followerPushScript moves fanID to the head of an existing index, keeping its TTL, and
+// trims the index back to ARGV[3] fans; a complete index that overflows loses its end
+// marker and becomes truncated. A missing index is left alone and rebuilt from the fans
+// table on the next read.
+var followerPushScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local ttl = redis.call('PTTL', KEYS[1])
+local size = tonumber(ARGV[3])
+redis.call('LREM', KEYS[1], 0, ARGV[1])
+redis.call('LPUSH', KEYS[1], ARGV[1])
+local n = redis.call('LLEN', KEYS[1])
+if n > size + 1 or (n > size and redis.call('LINDEX', KEYS[1], -1) ~= ARGV[2]) then
+  redis.call('LTRIM', KEYS[1], 0, size - 1)
+end
+if ttl > 0 then redis.call('PEXPIRE', KEYS[1], ttl) end
+return 1
+`)
+
+// OnFollow records a new follower of userID in the cached index.
+func (s *FollowerService) OnFollow(ctx context.Context, userID, fanID string) error {
+	return followerPushScript.Run(ctx, s.cache, []string{followerIndexKey(userID)}, fanID, followersEndMarker, s.indexSize).Err()
+}
+
+// OnUnfollow removes fanID from the cached index of userID.
+func (s *FollowerService) OnUnfollow(ctx context.Context, userID, fanID string) error {
+	return s.cache.LRem(ctx, followerIndexKey(userID), 0, fanID).Err()
+}
+
+// InvalidateUser drops the cached snapshot of a user after a profile change.
+func (s *FollowerService) InvalidateUser(ctx context.Context, userID string) error {
+	return s.cache.Del(ctx, userSnapshotKey(userID)).Err()
+}
+
+// InvalidateFollowers drops the follower index of a user.
+func (s *FollowerService) InvalidateFollowers(ctx context.Context, userID string) error {
+	return s.cache.Del(ctx, followerIndexKey(userID), followerLoadKey(userID)).Err()
+}
+
+func followerIndexKey(userID string) string { return fmt.Sprintf("followers:index:%s", userID) }
+
+// followerLoadKey holds how long the last rebuild of the user's index took (ns), with the
+// same TTL as the index, so early refresh is driven by each user's own rebuild cost.
+func followerLoadKey(userID string) string { return fmt.Sprintf("followers:load:%s", userID) }
+
+func userSnapshotKey(userID string) string { return fmt.Sprintf("user:%s", userID) }
+
+func (s *FollowerService) loadFollowerIDsAndCache(ctx context.Context, userID string) (followerIndex, error) {
+	started := time.Now()
 	time.Sleep(s.dbDelay)
 	s.indexLoads.Add(1)
 
+	// One extra row tells whether the window holds every fan
 	var ids []string
 	if err := s.db.WithContext(ctx).
 		Table("fans").
 		Select("fan_id").
 		Where("user_id = ?", userID).
-		Order("created_at DESC").
+		Order("created_at DESC, id DESC").
+		Limit(s.indexSize + 1).
 		Scan(&ids).Error; err != nil {
-		return nil, err
+		return followerIndex{}, err
+	}
+	index := followerIndex{ids: ids, complete: len(ids) <= s.indexSize}
+	if !index.complete {
+		index.ids = ids[:s.indexSize]
+	}
+
+	loadTime := time.Since(started)
+
+	// Store as Redis List; DEL + RPUSH in one transaction so readers never see a partial list.
+	// A complete index ends with the end marker; no fans is stored as the marker alone with
+	// a short TTL so the next reads do not miss again.
+	key := followerIndexKey(userID)
+	members, ttl := interfaceSlice(index.ids), s.ttl
+	if index.complete {
+		members = append(members, followersEndMarker)
 	}
+	if len(index.ids) == 0 {
+		ttl = s.emptyTTL
+	}
+	if ttl > 0 {
+		_, _ = s.cache.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.RPush(ctx, key, members...)
+			pipe.Expire(ctx, key, ttl)
+			pipe.Set(ctx, followerLoadKey(userID), int64(loadTime), ttl)
+			return nil
+		})
+	}
+
+	if index.ids == nil {
+		index.ids = []string{}
+	}
+	return index, nil
+}
 
-	// Store as Redis List
-	key := fmt.Sprintf("followers:index:%s", userID)
-	if len(ids) > 0 {
-		pipe := s.cache.Pipeline()
-		pipe.Del(ctx, key)
-		pipe.RPush(ctx, key, interfaceSlice(ids)...)
-		pipe.Expire(ctx, key, s.ttl)
-		pipe.Exec(ctx)
+// queryFollowerIDs reads one page of follower IDs (newest first) from the fans table,
+// for pages outside the cached window.
+func (s *FollowerService) queryFollowerIDs(ctx context.Context, userID string, offset, limit int) ([]string, error) {
+	time.Sleep(s.dbDelay)
+	s.pageQueries.Add(1)
+
+	ids := []string{}
+	if err := s.db.WithContext(ctx).
+		Table("fans").
+		Select("fan_id").
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&ids).Error; err != nil {
+		return nil, err
 	}
-	
 	return ids, nil
 }
 
@@ -174,7 +401,7 @@ func (s *FollowerService) loadUsers(ctx context.Context, ids []string) ([]Follow
 
 	keys := make([]string, len(ids))
 	for i, id := range ids {
-		keys[i] = fmt.Sprintf("user:%s", id)
+		keys[i] = userSnapshotKey(id)
 	}
 
 	cached := make(map[string]FollowerSnapshot, len(ids))
@@ -217,7 +444,7 @@ func (s *FollowerService) loadUsers(ctx context.Context, ids []string) ([]Follow
 			}
 			cached[u.ID] = snap
 			if payload, err := json.Marshal(snap); err == nil {
-				_ = s.cache.Set(ctx, fmt.Sprintf("user:%s", u.ID), payload, s.ttl).Err()
+				_ = s.cache.Set(ctx, userSnapshotKey(u.ID), payload, s.ttl).Err()
 			}
 		}
 	}
@@ -236,6 +463,7 @@ func (s *FollowerService) ResetCounters() {
 	s.pageQueries.Store(0)
 	s.indexLoads.Store(0)
 	s.userBulkLoad.Store(0)
+	s.earlyRefreshes.Store(0)
 }
 
 // Counters reports how many underlying DB loads were executed.
@@ -244,6 +472,7 @@ func (s *FollowerService) Counters() FollowerDBCounters {
 		PageQueries:  s.pageQueries.Load(),
 		IndexLoads:   s.indexLoads.Load(),
 		UserBulkLoad: s.userBulkLoad.Load(),
+		EarlyRefresh: s.earlyRefreshes.Load(),
 	}
 }
 
@@ -252,4 +481,5 @@ type FollowerDBCounters struct {
 	PageQueries  int64
 	IndexLoads   int64
 	UserBulkLoad int64
+	EarlyRefresh int64 // background refreshes triggered by hits close to expiry
 }
@@ -0,0 +1,29 @@
+package dto
+
+// OutboxItem 外发盒记录（管理端查看）
+type OutboxItem struct {
+	ID            string `json:"id"`
+	PostID        string `json:"post_id"`
+	AuthorID      string `json:"author_id"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error"`
+	CreatedAt     string `json:"created_at"`
+	NextAttemptAt string `json:"next_attempt_at"`
+}
+
+// OutboxListResponse 外发盒分页结果
+type OutboxListResponse struct {
+	List       []*OutboxItem `json:"list"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// RequeueOutboxRequest 重新入队请求
+type RequeueOutboxRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// RequeueOutboxResponse 重新入队结果
+type RequeueOutboxResponse struct {
+	Requeued int64 `json:"requeued"`
+}
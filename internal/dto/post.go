@@ -0,0 +1,16 @@
+package dto
+
+// CreatePostRequest 发布内容请求
+type CreatePostRequest struct {
+	Payload string `json:"payload" binding:"required,max=5000"`
+}
+
+// CreatePostResponse 发布内容响应
+type CreatePostResponse struct {
+	PostID string `json:"post_id"`
+}
+
+// UpdatePostRequest 编辑内容请求
+type UpdatePostRequest struct {
+	Payload string `json:"payload" binding:"required,max=5000"`
+}
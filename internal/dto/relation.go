@@ -0,0 +1,22 @@
+package dto
+
+// RelationStatus 查看者与目标用户之间的关系
+type RelationStatus struct {
+	UserID     string `json:"user_id"`     // 目标用户
+	Following  bool   `json:"following"`   // 查看者关注了目标
+	FollowedBy bool   `json:"followed_by"` // 目标关注了查看者
+	Mutual     bool   `json:"mutual"`      // 互相关注
+}
+
+// RelationCounts 关注数与粉丝数
+type RelationCounts struct {
+	UserID         string `json:"user_id"`
+	FollowingCount int64  `json:"following_count"`
+	FollowerCount  int64  `json:"follower_count"`
+}
+
+// RecommendedUser 可能认识的人：被查看者关注的人中有 Overlap 个也关注了该用户
+type RecommendedUser struct {
+	UserID  string `json:"user_id"`
+	Overlap int64  `json:"overlap"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+// TimelineItem 时间线条目（inbox 行 + post 内容）
+type TimelineItem struct {
+	PostID    string `json:"post_id"`
+	AuthorID  string `json:"author_id"`
+	Payload   string `json:"payload"`
+	Score     int64  `json:"score"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TimelineResponse 时间线分页响应
+type TimelineResponse struct {
+	List       []*TimelineItem `json:"list"`
+	NextCursor string          `json:"next_cursor"`
+	HasMore    bool            `json:"has_more"`
+}
@@ -30,10 +30,12 @@ type LoginResponse struct {
 
 // UserResponse 用户响应
 type UserResponse struct {
-	ID        string `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Age       int    `json:"age"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Age            int    `json:"age"`
+	FollowingCount int64  `json:"following_count"`
+	FollowerCount  int64  `json:"follower_count"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Block 拉黑关系（Blocker 拉黑 Blocked），存在时双方都不能再关注对方
+type Block struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	BlockerID string `gorm:"type:varchar(36);not null;index:idx_block_pair,unique"`
+	BlockedID string `gorm:"type:varchar(36);not null;index:idx_block_pair,unique;index:idx_block_blocked"`
+	CreatedAt time.Time
+}
+
+func (Block) TableName() string { return "blocks" }
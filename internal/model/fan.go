@@ -4,10 +4,11 @@ import "time"
 
 // Fan 粉丝关系（B 的粉丝是 A）冗余自 Follow
 type Fan struct {
-    ID     string    `gorm:"primaryKey;type:varchar(36)"`
-    UserID string    `gorm:"type:varchar(36);index:idx_fan_user;index:idx_fan_pair,unique;not null"`
+    ID     string    `gorm:"primaryKey;type:varchar(36);index:idx_fan_user_seek,priority:3"`
+    UserID string    `gorm:"type:varchar(36);index:idx_fan_user;index:idx_fan_pair,unique;index:idx_fan_user_seek,priority:1;not null"`
     FanID  string    `gorm:"type:varchar(36);not null;index:idx_fan_pair,unique"`
-    CreatedAt time.Time
+    // seek 分页索引 idx_fan_user_seek = (user_id, created_at, id)
+    CreatedAt time.Time `gorm:"index:idx_fan_user_seek,priority:2"`
     UpdatedAt time.Time
 }
 
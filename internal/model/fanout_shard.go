@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// FanoutShard 大V帖子扇出的一个分片：负责粉丝 (created_at, id) 区间 (Lower, Upper]，
+// 状态与重试语义同 Outbox（pending -> processing -> done / failed），可被任意 worker 领取并从断点继续
+type FanoutShard struct {
+	ID       string `gorm:"primaryKey;type:varchar(36)"`
+	OutboxID string `gorm:"type:varchar(36);not null;index:idx_shard_outbox_seq,unique,priority:1"`
+	Seq      int    `gorm:"not null;index:idx_shard_outbox_seq,unique,priority:2"`
+	PostID   string `gorm:"type:varchar(36);not null"`
+	AuthorID string `gorm:"type:varchar(36);not null"`
+	Score    int64  // inbox.score，取帖子发布时间
+	// 区间下界（不含）与上界（含），为空表示不设界
+	LowerAt *time.Time
+	LowerID string `gorm:"type:varchar(36)"`
+	UpperAt *time.Time
+	UpperID string `gorm:"type:varchar(36)"`
+	// 断点与已写入行数
+	CursorAt    *time.Time
+	CursorID    string `gorm:"type:varchar(36)"`
+	FanoutCount int64
+
+	Status        string `gorm:"type:varchar(16);not null;index:idx_shard_status_next,priority:1"`
+	Attempts      int
+	NextAttemptAt time.Time  `gorm:"index:idx_shard_status_next,priority:2"`
+	LeaseUntil    *time.Time `gorm:"index"`
+	LastError     string     `gorm:"type:text"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (FanoutShard) TableName() string { return "fanout_shards" }
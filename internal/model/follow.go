@@ -6,12 +6,13 @@ import (
 
 // Follow 关注关系（A 关注 B）
 type Follow struct {
-    ID         string    `gorm:"primaryKey;type:varchar(36)"`
-    FollowerID string    `gorm:"type:varchar(36);index:idx_follow_follower;index:idx_follow_pair,unique;not null"`
+    ID         string    `gorm:"primaryKey;type:varchar(36);index:idx_follow_follower_seek,priority:3"`
+    FollowerID string    `gorm:"type:varchar(36);index:idx_follow_follower;index:idx_follow_pair,unique;index:idx_follow_follower_seek,priority:1;not null"`
     FolloweeID string    `gorm:"type:varchar(36);not null;index:idx_follow_pair,unique"`
     // 复合唯一键，避免重复关注
     // idx_follow_pair = (follower_id, followee_id)
-    CreatedAt  time.Time
+    // seek 分页索引 idx_follow_follower_seek = (follower_id, created_at, id)
+    CreatedAt  time.Time `gorm:"index:idx_follow_follower_seek,priority:2"`
     UpdatedAt  time.Time
 }
 
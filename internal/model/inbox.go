@@ -5,12 +5,13 @@ import "time"
 // Inbox 时间线项（按 user_id 切分）
 type Inbox struct {
     ID        string    `gorm:"primaryKey;type:varchar(36)"`
-    UserID    string    `gorm:"type:varchar(36);index:idx_inbox_user;uniqueIndex:ux_inbox_user_post"`
-    PostID    string    `gorm:"type:varchar(36);index:idx_inbox_post;uniqueIndex:ux_inbox_user_post"`
+    UserID    string    `gorm:"type:varchar(36);index:idx_inbox_user;uniqueIndex:ux_inbox_user_post;index:idx_inbox_user_score_post,priority:1"`
+    PostID    string    `gorm:"type:varchar(36);index:idx_inbox_post;uniqueIndex:ux_inbox_user_post;index:idx_inbox_user_score_post,priority:3"`
     // 复合唯一键，避免重复 (user, post)
     // ux_inbox_user_post = (user_id, post_id)
-    Score     int64     `gorm:"index:idx_inbox_user_score"`
-    CreatedAt time.Time `gorm:"index:idx_inbox_user_score"`
+    // idx_inbox_user_score_post = (user_id, score, post_id)，时间线按 (score, post_id) 倒序 seek 分页
+    Score     int64     `gorm:"index:idx_inbox_user_score_post,priority:2;index:idx_inbox_score"`
+    CreatedAt time.Time
 }
 
 func (Inbox) TableName() string { return "inbox" }
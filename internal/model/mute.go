@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Mute 屏蔽关系（UserID 不再在时间线上看到 MutedID 的帖子），不影响关注关系
+type Mute struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	UserID string `gorm:"type:varchar(36);not null;index:idx_mute_pair,unique;index:idx_mute_author,priority:2"`
+	// idx_mute_author = (muted_id, user_id)，扇出时按作者批量过滤粉丝
+	MutedID   string `gorm:"type:varchar(36);not null;index:idx_mute_pair,unique;index:idx_mute_author,priority:1"`
+	CreatedAt time.Time
+}
+
+func (Mute) TableName() string { return "mutes" }
@@ -2,15 +2,46 @@ package model
 
 import "time"
 
+// outbox 状态
+const (
+    OutboxPending    = "pending"
+    OutboxProcessing = "processing"
+    OutboxDone       = "done"
+    OutboxFailed     = "failed"
+    // OutboxSharded 已切分为多个 FanoutShard 并行处理，全部分片完成后置为 done
+    OutboxSharded = "sharded"
+)
+
+// outbox 事件类型
+const (
+    // OutboxKindPublish 新帖子：扇出到粉丝 inbox
+    OutboxKindPublish = "publish"
+    // OutboxKindRetract 帖子已删除：分批删除引用该帖子的 inbox 行
+    OutboxKindRetract = "retract"
+    // OutboxKindEdit 帖子已编辑：inbox 只引用 post_id，读时回填新内容，无需改写，供下游缓存/订阅者刷新
+    OutboxKindEdit = "edit"
+)
+
 // Outbox 事件外发盒（用于本地 fanout 基准模拟）
 type Outbox struct {
     ID         string    `gorm:"primaryKey;type:varchar(36)"`
-    PostID     string    `gorm:"type:varchar(36);uniqueIndex"`
+    // 同一帖子可能有 publish / edit / retract 多条事件
+    PostID     string    `gorm:"type:varchar(36);index:idx_outbox_post_kind,priority:1"`
+    Kind       string    `gorm:"type:varchar(16);default:publish;index:idx_outbox_post_kind,priority:2"`
     AuthorID   string    `gorm:"type:varchar(36);index:idx_outbox_author"`
     CreatedAt  time.Time `gorm:"index"`
-    Status     string    `gorm:"type:varchar(16);index"` // pending, processing, done
+    Status     string    `gorm:"type:varchar(16);index;index:idx_outbox_status_next,priority:1"` // pending, processing, sharded, done, failed
+    // Attempts 已领取次数（领取时 +1）；NextAttemptAt 之前不会被领取，用于失败退避
+    Attempts      int
+    NextAttemptAt time.Time `gorm:"index:idx_outbox_status_next,priority:2"`
+    // LeaseUntil processing 租约到期时间，过期未完成的行会被放回 pending（worker 崩溃恢复）
+    LeaseUntil  *time.Time `gorm:"index"`
+    LastError   string     `gorm:"type:text"`
     ProcessedAt *time.Time
-    FanoutCount int64
+    // 断点：最后一个已写入 inbox 的粉丝 (created_at, id)，重新领取时从这里继续
+    CursorAt    *time.Time
+    CursorID    string `gorm:"type:varchar(36)"`
+    FanoutCount int64  // 已写入的 inbox 行数，随断点同事务累加
 }
 
 func (Outbox) TableName() string { return "outbox" }
@@ -1,14 +1,21 @@
 package model
 
-import "time"
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
 
 // Post 内容主体（仅示例所需字段）
 type Post struct {
     ID        string    `gorm:"primaryKey;type:varchar(36)"`
-    AuthorID  string    `gorm:"type:varchar(36);index:idx_post_author"`
+    AuthorID  string    `gorm:"type:varchar(36);index:idx_post_author;index:idx_post_author_created,priority:1"`
     Payload   string    `gorm:"type:text"`
-    CreatedAt time.Time
+    // idx_post_author_created = (author_id, created_at)，供大V拉模式按时间倒序读取
+    CreatedAt time.Time `gorm:"index:idx_post_author_created,priority:2"`
     UpdatedAt time.Time
+    // DeletedAt 删除为软删除（墓碑）：读路径自动过滤，inbox 中的残留行由 retract 事件分批清理
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 func (Post) TableName() string { return "posts" }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// RelationCount 关注数/粉丝数的反范式计数
+// following_count 随 follows 同事务维护，follower_count 随 fans 冗余（replicator）维护，定期对账修正
+type RelationCount struct {
+	UserID         string `gorm:"primaryKey;type:varchar(36)"`
+	FollowingCount int64  `gorm:"not null;default:0"`
+	FollowerCount  int64  `gorm:"not null;default:0"`
+	UpdatedAt      time.Time
+}
+
+func (RelationCount) TableName() string { return "relation_counts" }
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// 关系变更事件动作
+const (
+	RelationEventAdd    = "add"
+	RelationEventRemove = "remove"
+)
+
+// 关系变更事件状态
+const (
+	RelationEventPending = "pending"
+	RelationEventDone    = "done"
+	RelationEventDead    = "dead"
+)
+
+// RelationEvent 关系变更外发盒：与 follows 写入同一事务落库，
+// 由 FanReplicator 至少一次地消费并冗余到 fans 表
+type RelationEvent struct {
+	ID     string `gorm:"primaryKey;type:varchar(36)"`
+	Action string `gorm:"type:varchar(16);not null"`                                         // add, remove
+	UserID string `gorm:"type:varchar(36);not null"`                                         // 被关注者，对应 fans.user_id
+	FanID  string `gorm:"type:varchar(36);not null"`                                         // 关注者，对应 fans.fan_id
+	Status string `gorm:"type:varchar(16);not null;index:idx_relevt_status_next,priority:1"` // pending, done, dead
+	// Attempts 已领取次数（领取时 +1）；NextAttemptAt 之前不会被再次领取（兼作领取租约）
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_relevt_status_next,priority:2"`
+	LastError     string    `gorm:"type:text"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (RelationEvent) TableName() string { return "relation_events" }
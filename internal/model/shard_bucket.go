@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ShardBucket 订单虚拟桶到物理分库的映射。ShadowDB 非空表示该桶正在迁移：读走 DBIndex，写同时落到两个库。
+// 迁移依次经过 {src, nil} -> {src, dst}（复制）-> {dst, src}（已切换）-> {dst, nil}，Version 用于乐观并发更新
+type ShardBucket struct {
+	Bucket    int   `gorm:"primaryKey;autoIncrement:false"`
+	DBIndex   int   `gorm:"not null"`
+	ShadowDB  *int  `gorm:"column:shadow_db"`
+	Version   int64 `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+func (ShardBucket) TableName() string { return "shard_buckets" }
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrBlocked 双方之间存在拉黑，不能建立关注
+var ErrBlocked = errors.New("relationship blocked")
+
+// BlockRepository 拉黑关系仓储
+type BlockRepository interface {
+	// Create 幂等写入拉黑关系
+	Create(ctx context.Context, blockerID, blockedID string) error
+	Delete(ctx context.Context, blockerID, blockedID string) error
+	// IsBlocked a 与 b 之间任一方向存在拉黑即返回 true
+	IsBlocked(ctx context.Context, a, b string) (bool, error)
+}
+
+type blockRepository struct{ db *gorm.DB }
+
+func NewBlockRepository(db *gorm.DB) BlockRepository { return &blockRepository{db: db} }
+
+func (r *blockRepository) Create(ctx context.Context, blockerID, blockedID string) error {
+	b := &model.Block{ID: uuid.New().String(), BlockerID: blockerID, BlockedID: blockedID}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(b).Error
+}
+
+func (r *blockRepository) Delete(ctx context.Context, blockerID, blockedID string) error {
+	return r.db.WithContext(ctx).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Delete(&model.Block{}).Error
+}
+
+func (r *blockRepository) IsBlocked(ctx context.Context, a, b string) (bool, error) {
+	var cnt int64
+	// 两个分支都走 idx_block_pair
+	err := r.db.WithContext(ctx).Model(&model.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&cnt).Error
+	return cnt > 0, err
+}
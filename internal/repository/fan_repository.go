@@ -2,6 +2,7 @@ package repository
 
 import (
     "context"
+    "time"
 
     "github.com/google/uuid"
     "gorm.io/gorm"
@@ -14,19 +15,39 @@ type FanRepository interface {
     Create(ctx context.Context, userID, fanID string) error
     Delete(ctx context.Context, userID, fanID string) error
     ListFans(ctx context.Context, userID string, offset, limit int) ([]*model.Fan, error)
+    // ListFansAfter 按 (created_at, id) 升序 seek 分页；after 为 nil 表示第一页，返回的 next 为 nil 表示没有更多
+    ListFansAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Fan, *Cursor, error)
+    // ListFansRange 同 ListFansAfter，但只返回 (created_at, id) <= upTo 的粉丝；upTo 为 nil 表示不设上界
+    ListFansRange(ctx context.Context, userID string, after, upTo *Cursor, limit int) ([]*model.Fan, *Cursor, error)
+    // SplitPoints 按 (created_at, id) 顺序每隔 step 个粉丝取一个分割点，最多 maxPoints 个，用于把粉丝区间切成分片
+    SplitPoints(ctx context.Context, userID string, step, maxPoints int) ([]*Cursor, error)
+    // CountFans 统计某用户的粉丝数
+    CountFans(ctx context.Context, userID string) (int64, error)
+    // CountFansBatch 批量统计粉丝数，未出现在结果中的用户粉丝数为 0
+    CountFansBatch(ctx context.Context, userIDs []string) (map[string]int64, error)
 }
 
 type fanRepository struct{ db *gorm.DB }
 
 func NewFanRepository(db *gorm.DB) FanRepository { return &fanRepository{db: db} }
 
+// Create 幂等写入粉丝关系；真正插入时同事务累加粉丝数
 func (r *fanRepository) Create(ctx context.Context, userID, fanID string) error {
     f := &model.Fan{ID: uuid.New().String(), UserID: userID, FanID: fanID}
-    return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(f).Error
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(f)
+        if res.Error != nil || res.RowsAffected == 0 { return res.Error }
+        return incrRelationCount(tx, userID, "follower_count", 1)
+    })
 }
 
+// Delete 删除粉丝关系；真正删除时同事务扣减粉丝数
 func (r *fanRepository) Delete(ctx context.Context, userID, fanID string) error {
-    return r.db.WithContext(ctx).Where("user_id = ? AND fan_id = ?", userID, fanID).Delete(&model.Fan{}).Error
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        res := tx.Where("user_id = ? AND fan_id = ?", userID, fanID).Delete(&model.Fan{})
+        if res.Error != nil || res.RowsAffected == 0 { return res.Error }
+        return incrRelationCount(tx, userID, "follower_count", -1)
+    })
 }
 
 func (r *fanRepository) ListFans(ctx context.Context, userID string, offset, limit int) ([]*model.Fan, error) {
@@ -34,3 +55,70 @@ func (r *fanRepository) ListFans(ctx context.Context, userID string, offset, lim
     err := r.db.WithContext(ctx).Where("user_id = ?", userID).Offset(offset).Limit(limit).Find(&res).Error
     return res, err
 }
+
+func (r *fanRepository) ListFansAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Fan, *Cursor, error) {
+    return r.ListFansRange(ctx, userID, after, nil, limit)
+}
+
+func (r *fanRepository) ListFansRange(ctx context.Context, userID string, after, upTo *Cursor, limit int) ([]*model.Fan, *Cursor, error) {
+    q := r.db.WithContext(ctx).Where("user_id = ?", userID)
+    if after != nil {
+        // 行值比较可直接走 (owner, created_at, id) 复合索引
+        q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+    }
+    if upTo != nil {
+        q = q.Where("(created_at, id) <= (?, ?)", upTo.CreatedAt, upTo.ID)
+    }
+    var res []*model.Fan
+    // 多取一条判断是否还有下一页
+    if err := q.Order("created_at ASC, id ASC").Limit(limit + 1).Find(&res).Error; err != nil {
+        return nil, nil, err
+    }
+    if len(res) <= limit { return res, nil, nil }
+    res = res[:limit]
+    last := res[limit-1]
+    return res, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+func (r *fanRepository) SplitPoints(ctx context.Context, userID string, step, maxPoints int) ([]*Cursor, error) {
+    var res []*Cursor
+    var after *Cursor
+    for len(res) < maxPoints {
+        q := r.db.WithContext(ctx).Model(&model.Fan{}).Select("created_at, id").Where("user_id = ?", userID)
+        if after != nil { q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID) }
+        // 在索引上跳过 step-1 行，只取分割点本身
+        var row struct {
+            CreatedAt time.Time
+            ID        string
+        }
+        tx := q.Order("created_at ASC, id ASC").Offset(step - 1).Limit(1).Scan(&row)
+        if tx.Error != nil { return nil, tx.Error }
+        if tx.RowsAffected == 0 { break }
+        after = &Cursor{CreatedAt: row.CreatedAt, ID: row.ID}
+        res = append(res, after)
+    }
+    return res, nil
+}
+
+func (r *fanRepository) CountFans(ctx context.Context, userID string) (int64, error) {
+    var cnt int64
+    err := r.db.WithContext(ctx).Model(&model.Fan{}).Where("user_id = ?", userID).Count(&cnt).Error
+    return cnt, err
+}
+
+func (r *fanRepository) CountFansBatch(ctx context.Context, userIDs []string) (map[string]int64, error) {
+    res := make(map[string]int64, len(userIDs))
+    if len(userIDs) == 0 { return res, nil }
+    var rows []struct {
+        UserID string
+        Cnt    int64
+    }
+    err := r.db.WithContext(ctx).Model(&model.Fan{}).
+        Select("user_id, COUNT(*) AS cnt").
+        Where("user_id IN ?", userIDs).
+        Group("user_id").
+        Scan(&rows).Error
+    if err != nil { return nil, err }
+    for _, row := range rows { res[row.UserID] = row.Cnt }
+    return res, nil
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// FanoutShardRepository 扇出分片仓储，租约/重试语义与 OutboxRepository 一致：
+// 领取后的更新以 attempts 为凭据，租约已丢失时返回 ErrLeaseLost
+type FanoutShardRepository interface {
+	// CreateForOutbox 在同一事务内写入分片并把本次领取的 outbox（attempts 为领取凭据）置为 sharded
+	CreateForOutbox(ctx context.Context, outboxID string, attempts int, shards []*model.FanoutShard) error
+	CountByOutbox(ctx context.Context, outboxID string) (int64, error)
+	// ResumeOutbox 已切分的 outbox 被再次领取（崩溃恢复或人工重新入队）：失败分片重置为 pending，outbox 置回 sharded
+	ResumeOutbox(ctx context.Context, outboxID string, attempts int) error
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.FanoutShard, error)
+	// ReleaseExpired 回收租约过期的分片；达到 maxAttempts 的置为 failed，并把所属 outbox 置为 failed
+	ReleaseExpired(ctx context.Context, maxAttempts int) (int64, error)
+	SaveProgress(ctx context.Context, id string, attempts int, records []model.Inbox, cursor *Cursor) (int64, error)
+	MarkDone(ctx context.Context, id string, attempts int) error
+	MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error
+	// MarkFailed 分片失败（以 shard.Attempts 为凭据），同时把所属 outbox 置为 failed，便于在管理端发现并重新入队
+	MarkFailed(ctx context.Context, shard *model.FanoutShard, lastErr string) error
+	// CompleteOutbox 所有分片完成时把 outbox 置为 done 并汇总写入行数，返回是否由本次调用完成
+	CompleteOutbox(ctx context.Context, outboxID string) (bool, error)
+}
+
+type fanoutShardRepository struct{ db *gorm.DB }
+
+func NewFanoutShardRepository(db *gorm.DB) FanoutShardRepository {
+	return &fanoutShardRepository{db: db}
+}
+
+func (r *fanoutShardRepository) CreateForOutbox(ctx context.Context, outboxID string, attempts int, shards []*model.FanoutShard) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := leaseHeld(claimedOutbox(tx, outboxID, attempts).
+			Updates(map[string]any{"status": model.OutboxSharded, "lease_until": nil, "last_error": ""})); err != nil {
+			return err
+		}
+		return tx.Create(&shards).Error
+	})
+}
+
+func (r *fanoutShardRepository) CountByOutbox(ctx context.Context, outboxID string) (int64, error) {
+	var cnt int64
+	err := r.db.WithContext(ctx).Model(&model.FanoutShard{}).Where("outbox_id = ?", outboxID).Count(&cnt).Error
+	return cnt, err
+}
+
+func (r *fanoutShardRepository) ResumeOutbox(ctx context.Context, outboxID string, attempts int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := leaseHeld(claimedOutbox(tx, outboxID, attempts).
+			Updates(map[string]any{"status": model.OutboxSharded, "lease_until": nil, "last_error": ""})); err != nil {
+			return err
+		}
+		return tx.Model(&model.FanoutShard{}).
+			Where("outbox_id = ? AND status = ?", outboxID, model.OutboxFailed).
+			Updates(map[string]any{"status": model.OutboxPending, "attempts": 0, "next_attempt_at": time.Now(), "last_error": ""}).Error
+	})
+}
+
+func (r *fanoutShardRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.FanoutShard, error) {
+	var batch []*model.FanoutShard
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Raw(`
+			SELECT *
+			FROM fanout_shards
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY created_at, seq
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		`, model.OutboxPending, now, limit).Scan(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]string, len(batch))
+		leaseUntil := now.Add(lease)
+		for i, s := range batch {
+			ids[i] = s.ID
+			s.Status = model.OutboxProcessing
+			s.Attempts++
+			s.LeaseUntil = &leaseUntil
+		}
+		return tx.Model(&model.FanoutShard{}).
+			Where("id IN ?", ids).
+			Updates(map[string]any{
+				"status":      model.OutboxProcessing,
+				"attempts":    gorm.Expr("attempts + 1"),
+				"lease_until": leaseUntil,
+			}).Error
+	})
+	return batch, err
+}
+
+func (r *fanoutShardRepository) ReleaseExpired(ctx context.Context, maxAttempts int) (int64, error) {
+	now := time.Now()
+	var total int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := func() *gorm.DB {
+			return tx.Model(&model.FanoutShard{}).Where("status = ? AND lease_until < ?", model.OutboxProcessing, now)
+		}
+		var exhausted []string
+		if err := expired().Where("attempts >= ?", maxAttempts).Pluck("outbox_id", &exhausted).Error; err != nil {
+			return err
+		}
+		res := expired().Where("attempts >= ?", maxAttempts).
+			Updates(map[string]any{"status": model.OutboxFailed, "lease_until": nil, "last_error": "lease expired"})
+		if res.Error != nil {
+			return res.Error
+		}
+		total += res.RowsAffected
+		if len(exhausted) > 0 {
+			if err := tx.Model(&model.Outbox{}).
+				Where("id IN ? AND status = ?", exhausted, model.OutboxSharded).
+				Updates(map[string]any{"status": model.OutboxFailed, "last_error": "shard lease expired"}).Error; err != nil {
+				return err
+			}
+		}
+		res = expired().
+			Updates(map[string]any{"status": model.OutboxPending, "lease_until": nil, "next_attempt_at": now, "last_error": "lease expired"})
+		total += res.RowsAffected
+		return res.Error
+	})
+	return total, err
+}
+
+// claimedShard 仍由本次领取持有的分片
+func claimedShard(tx *gorm.DB, id string, attempts int) *gorm.DB {
+	return tx.Model(&model.FanoutShard{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, model.OutboxProcessing, attempts)
+}
+
+func (r *fanoutShardRepository) SaveProgress(ctx context.Context, id string, attempts int, records []model.Inbox, cursor *Cursor) (int64, error) {
+	return saveFanoutProgress(r.db.WithContext(ctx), func(tx *gorm.DB) *gorm.DB { return claimedShard(tx, id, attempts) }, records, cursor)
+}
+
+func (r *fanoutShardRepository) MarkDone(ctx context.Context, id string, attempts int) error {
+	return leaseHeld(claimedShard(r.db.WithContext(ctx), id, attempts).
+		Updates(map[string]any{"status": model.OutboxDone, "lease_until": nil, "last_error": ""}))
+}
+
+func (r *fanoutShardRepository) MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error {
+	return leaseHeld(claimedShard(r.db.WithContext(ctx), id, attempts).
+		Updates(map[string]any{"status": model.OutboxPending, "next_attempt_at": nextAt, "lease_until": nil, "last_error": lastErr}))
+}
+
+func (r *fanoutShardRepository) MarkFailed(ctx context.Context, shard *model.FanoutShard, lastErr string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 分片已不由本次领取持有时不动 outbox：其他 worker 可能正在完成这个分片
+		if err := leaseHeld(claimedShard(tx, shard.ID, shard.Attempts).
+			Updates(map[string]any{"status": model.OutboxFailed, "lease_until": nil, "last_error": lastErr})); err != nil {
+			return err
+		}
+		return tx.Model(&model.Outbox{}).
+			Where("id = ? AND status = ?", shard.OutboxID, model.OutboxSharded).
+			Updates(map[string]any{"status": model.OutboxFailed, "last_error": lastErr}).Error
+	})
+}
+
+func (r *fanoutShardRepository) CompleteOutbox(ctx context.Context, outboxID string) (bool, error) {
+	// 分片的 done 已单独提交，并发完成的最后几个分片中至少有一个能看到全部 done
+	res := r.db.WithContext(ctx).Exec(`
+		UPDATE outbox
+		SET status = ?, processed_at = ?, lease_until = NULL,
+			fanout_count = (SELECT COALESCE(SUM(fanout_count), 0) FROM fanout_shards WHERE outbox_id = ?)
+		WHERE id = ? AND status = ?
+			AND NOT EXISTS (SELECT 1 FROM fanout_shards WHERE outbox_id = ? AND status <> ?)
+	`, model.OutboxDone, time.Now(), outboxID, outboxID, model.OutboxSharded, outboxID, model.OutboxDone)
+	return res.RowsAffected > 0, res.Error
+}
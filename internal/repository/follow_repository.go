@@ -2,10 +2,13 @@ package repository
 
 import (
     "context"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
 
     "github.com/google/uuid"
     "gorm.io/gorm"
-    "gorm.io/gorm/clause"
 
     "github.com/d60-Lab/gin-template/internal/model"
 )
@@ -15,24 +18,83 @@ type FollowRepository interface {
     Delete(ctx context.Context, followerID, followeeID string) error
     Exists(ctx context.Context, followerID, followeeID string) (bool, error)
     ListFollowings(ctx context.Context, followerID string, offset, limit int) ([]*model.Follow, error)
+    // ListFollowingsAfter 按 (created_at, id) 升序 seek 分页；after 为 nil 表示第一页，返回的 next 为 nil 表示没有更多
+    ListFollowingsAfter(ctx context.Context, followerID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error)
+    // ListRecentFollowees followerID 最近关注的 limit 个人，按关注时间倒序
+    ListRecentFollowees(ctx context.Context, followerID string, limit int) ([]string, error)
+    // ListBetween 一次查询取出 userID 与 targets 之间两个方向的关注边
+    ListBetween(ctx context.Context, userID string, targets []string) ([]*model.Follow, error)
+    // ListCommonFollowings a 与 b 共同关注的人，按 followee_id 排序，最多 limit 个
+    ListCommonFollowings(ctx context.Context, a, b string, limit int) ([]string, error)
+    // ListFriendsAfter userID 的互关好友，返回 userID 发出的那条关注边，分页语义同 ListFollowingsAfter；
+    // 分片实现每次调用的扫描量有上限，返回的页可能不足 limit，是否还有更多以 next 是否为 nil 为准
+    ListFriendsAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error)
+    // ListSecondDegree 二度关注：userID 最近关注的 maxSources 个人各自最近关注的 perSource 个人中、userID 尚未关注的用户，
+    // 按被这些人关注的次数（重合度）降序，最多 limit 个
+    ListSecondDegree(ctx context.Context, userID string, maxSources, perSource, limit int) ([]*FollowOverlap, error)
 }
 
+// FollowOverlap 二度关系候选及其重合度
+type FollowOverlap struct {
+    UserID  string
+    Overlap int64
+}
+
+const (
+    // secondDegreeBatch 二度候选按重合度分批过滤已关注者，每批的条数
+    secondDegreeBatch = 200
+    // maxSecondDegreeBatches 最多过滤多少批候选；排在前面的候选几乎都已关注时结果可能不足 limit
+    maxSecondDegreeBatches = 10
+)
+
 type followRepository struct {
     db *gorm.DB
 }
 
 func NewFollowRepository(db *gorm.DB) FollowRepository { return &followRepository{db: db} }
 
+// Create 写入关注关系，并在同一事务内写入 add 事件供 FanReplicator 冗余到 fans、累加关注数。
+// 插入语句本身复查 blocks，双方任一方向存在拉黑时返回 ErrBlocked
 func (r *followRepository) Create(ctx context.Context, followerID, followeeID string) error {
-    f := &model.Follow{ID: uuid.New().String(), FollowerID: followerID, FolloweeID: followeeID}
-    // 幂等：重复关注不报错
-    return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(f).Error
+    now := time.Now()
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        // 幂等：重复关注不报错，也不重复产生事件和计数
+        res := tx.Exec(`
+            INSERT INTO follows (id, follower_id, followee_id, created_at, updated_at)
+            SELECT ?, ?, ?, ?, ?
+            WHERE NOT EXISTS (
+                SELECT 1 FROM blocks
+                WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+            )
+            ON CONFLICT DO NOTHING
+        `, uuid.New().String(), followerID, followeeID, now, now, followerID, followeeID, followeeID, followerID)
+        if res.Error != nil { return res.Error }
+        if res.RowsAffected == 0 { return blockedBetween(tx, followerID, followeeID) }
+        if err := incrRelationCount(tx, followerID, "following_count", 1); err != nil { return err }
+        return tx.Create(newRelationEvent(model.RelationEventAdd, followeeID, followerID)).Error
+    })
+}
+
+// blockedBetween 插入未生效时区分已关注（nil）与被拉黑（ErrBlocked）
+func blockedBetween(tx *gorm.DB, a, b string) error {
+    var cnt int64
+    if err := tx.Model(&model.Block{}).
+        Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+        Count(&cnt).Error; err != nil {
+        return err
+    }
+    if cnt > 0 { return ErrBlocked }
+    return nil
 }
 
+// Delete 删除关注关系，并在同一事务内写入 remove 事件、扣减关注数
 func (r *followRepository) Delete(ctx context.Context, followerID, followeeID string) error {
-    return r.db.WithContext(ctx).
-        Where("follower_id = ? AND followee_id = ?", followerID, followeeID).
-        Delete(&model.Follow{}).Error
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        res := tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&model.Follow{})
+        if res.Error != nil || res.RowsAffected == 0 { return res.Error }
+        if err := incrRelationCount(tx, followerID, "following_count", -1); err != nil { return err }
+        return tx.Create(newRelationEvent(model.RelationEventRemove, followeeID, followerID)).Error
+    })
 }
 
 func (r *followRepository) Exists(ctx context.Context, followerID, followeeID string) (bool, error) {
@@ -51,3 +113,170 @@ func (r *followRepository) ListFollowings(ctx context.Context, followerID string
     err := r.db.WithContext(ctx).Where("follower_id = ?", followerID).Offset(offset).Limit(limit).Find(&res).Error
     return res, err
 }
+
+func (r *followRepository) ListFollowingsAfter(ctx context.Context, followerID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error) {
+    q := r.db.WithContext(ctx).Where("follower_id = ?", followerID)
+    if after != nil {
+        // 行值比较可直接走 (owner, created_at, id) 复合索引
+        q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+    }
+    var res []*model.Follow
+    // 多取一条判断是否还有下一页
+    if err := q.Order("created_at ASC, id ASC").Limit(limit + 1).Find(&res).Error; err != nil {
+        return nil, nil, err
+    }
+    if len(res) <= limit { return res, nil, nil }
+    res = res[:limit]
+    last := res[limit-1]
+    return res, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+func (r *followRepository) ListRecentFollowees(ctx context.Context, followerID string, limit int) ([]string, error) {
+    var res []string
+    err := r.db.WithContext(ctx).Model(&model.Follow{}).
+        Where("follower_id = ?", followerID).
+        Order("created_at DESC, id DESC").
+        Limit(limit).
+        Pluck("followee_id", &res).Error
+    return res, err
+}
+
+func (r *followRepository) ListBetween(ctx context.Context, userID string, targets []string) ([]*model.Follow, error) {
+    var res []*model.Follow
+    if len(targets) == 0 { return res, nil }
+    // 两个分支都能走 idx_follow_pair (follower_id, followee_id)
+    err := r.db.WithContext(ctx).
+        Where("(follower_id = ? AND followee_id IN ?) OR (followee_id = ? AND follower_id IN ?)", userID, targets, userID, targets).
+        Find(&res).Error
+    return res, err
+}
+
+func (r *followRepository) ListCommonFollowings(ctx context.Context, a, b string, limit int) ([]string, error) {
+    var res []string
+    // f2 一侧按 idx_follow_pair 点查，扫描量以 a 的关注数为上界
+    err := r.db.WithContext(ctx).Table("follows AS f1").
+        Joins("JOIN follows AS f2 ON f2.followee_id = f1.followee_id AND f2.follower_id = ?", b).
+        Where("f1.follower_id = ?", a).
+        Order("f1.followee_id").
+        Limit(limit).
+        Pluck("f1.followee_id", &res).Error
+    return res, err
+}
+
+func (r *followRepository) ListFriendsAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error) {
+    q := r.db.WithContext(ctx).Table("follows AS f1").
+        Select("f1.*").
+        Joins("JOIN follows AS f2 ON f2.follower_id = f1.followee_id AND f2.followee_id = f1.follower_id").
+        Where("f1.follower_id = ?", userID)
+    if after != nil {
+        q = q.Where("(f1.created_at, f1.id) > (?, ?)", after.CreatedAt, after.ID)
+    }
+    var res []*model.Follow
+    if err := q.Order("f1.created_at ASC, f1.id ASC").Limit(limit + 1).Find(&res).Error; err != nil {
+        return nil, nil, err
+    }
+    if len(res) <= limit { return res, nil, nil }
+    res = res[:limit]
+    last := res[limit-1]
+    return res, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+func (r *followRepository) ListSecondDegree(ctx context.Context, userID string, maxSources, perSource, limit int) ([]*FollowOverlap, error) {
+    db := r.db.WithContext(ctx)
+    // 一度关系只取最近的 maxSources 个，避免关注数很多的用户触发全表级聚合
+    var sources []string
+    if err := db.Model(&model.Follow{}).
+        Where("follower_id = ?", userID).
+        Order("created_at DESC, id DESC").
+        Limit(maxSources).
+        Pluck("followee_id", &sources).Error; err != nil {
+        return nil, err
+    }
+    overlap := make(map[string]int64)
+    if err := countRecentFollowees(db, "follows", sources, perSource, overlap); err != nil { return nil, err }
+    return topUnfollowed(overlap, userID, limit, func() *gorm.DB { return db.Model(&model.Follow{}) })
+}
+
+// countRecentFollowees 把 sources 各自最近 perSource 条关注按被关注者累加到 into。
+// Postgres 用 LATERAL 让每个来源沿 idx_follow_follower_seek 倒序扫到 perSource 条即停；
+// 不支持 LATERAL 的方言（测试用的 sqlite）逐个来源查询，读取量同样以 len(sources)·perSource 为上界
+func countRecentFollowees(db *gorm.DB, table string, sources []string, perSource int, into map[string]int64) error {
+    if len(sources) == 0 { return nil }
+    if db.Dialector.Name() == "postgres" {
+        args := make([]any, 0, len(sources)+1)
+        for _, src := range sources { args = append(args, src) }
+        args = append(args, perSource)
+        var rows []*FollowOverlap
+        if err := db.Raw(fmt.Sprintf(`
+            SELECT r.followee_id AS user_id, COUNT(*) AS overlap
+            FROM (VALUES %s) AS s(follower_id)
+            CROSS JOIN LATERAL (
+                SELECT f.followee_id FROM %s AS f
+                WHERE f.follower_id = s.follower_id
+                ORDER BY f.created_at DESC, f.id DESC
+                LIMIT ?
+            ) AS r
+            GROUP BY r.followee_id
+        `, strings.TrimSuffix(strings.Repeat("(?),", len(sources)), ","), table), args...).Scan(&rows).Error; err != nil {
+            return err
+        }
+        for _, row := range rows { into[row.UserID] += row.Overlap }
+        return nil
+    }
+    for _, src := range sources {
+        var ids []string
+        if err := db.Table(table).
+            Where("follower_id = ?", src).
+            Order("created_at DESC, id DESC").
+            Limit(perSource).
+            Pluck("followee_id", &ids).Error; err != nil {
+            return err
+        }
+        for _, id := range ids { into[id]++ }
+    }
+    return nil
+}
+
+// topUnfollowed 按重合度降序取 limit 个 userID 尚未关注的候选；聚合结果只排序一次，
+// 已关注者按批点查过滤，最多 maxSecondDegreeBatches 批。follows 每次返回 userID 关注边所在表上的新查询
+func topUnfollowed(overlap map[string]int64, userID string, limit int, follows func() *gorm.DB) ([]*FollowOverlap, error) {
+    delete(overlap, userID)
+    candidates := make([]*FollowOverlap, 0, len(overlap))
+    for id, cnt := range overlap { candidates = append(candidates, &FollowOverlap{UserID: id, Overlap: cnt}) }
+    sort.Slice(candidates, func(i, j int) bool {
+        if candidates[i].Overlap != candidates[j].Overlap { return candidates[i].Overlap > candidates[j].Overlap }
+        return candidates[i].UserID < candidates[j].UserID
+    })
+
+    res := make([]*FollowOverlap, 0, limit)
+    for b := 0; b < maxSecondDegreeBatches && len(res) < limit; b++ {
+        start := b * secondDegreeBatch
+        if start >= len(candidates) { break }
+        end := start + secondDegreeBatch
+        if end > len(candidates) { end = len(candidates) }
+        kept, err := dropFollowed(follows(), userID, candidates[start:end])
+        if err != nil { return nil, err }
+        res = append(res, kept...)
+    }
+    if len(res) > limit { res = res[:limit] }
+    return res, nil
+}
+
+// dropFollowed 去掉一批候选中 userID 已关注的人，保持原有顺序；follows 为 userID 关注边所在的表
+func dropFollowed(follows *gorm.DB, userID string, rows []*FollowOverlap) ([]*FollowOverlap, error) {
+    if len(rows) == 0 { return rows, nil }
+    ids := make([]string, len(rows))
+    for i, row := range rows { ids[i] = row.UserID }
+    var followed []string
+    // 按 idx_follow_pair 点查，只覆盖本批候选
+    if err := follows.Where("follower_id = ? AND followee_id IN ?", userID, ids).Pluck("followee_id", &followed).Error; err != nil {
+        return nil, err
+    }
+    skip := make(map[string]struct{}, len(followed))
+    for _, id := range followed { skip[id] = struct{}{} }
+    kept := rows[:0]
+    for _, row := range rows {
+        if _, ok := skip[row.UserID]; !ok { kept = append(kept, row) }
+    }
+    return kept, nil
+}
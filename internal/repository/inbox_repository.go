@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// InboxRepository 时间线 inbox 维护（扇出写入见 saveFanoutProgress）
+type InboxRepository interface {
+	// DeleteByPost 删除引用 postID 的至多 limit 条 inbox 行，返回删除行数；返回值小于 limit 表示已删完
+	DeleteByPost(ctx context.Context, postID string, limit int) (int64, error)
+	// ListUsers 按 user_id 升序列出有 inbox 的用户（user_id > after），用于分批遍历
+	ListUsers(ctx context.Context, after string, limit int) ([]string, error)
+	// TrimUser 按 (score, post_id) 倒序保留 userID 最新的 keep 条，删除其余中的至多 limit 条，返回删除行数
+	TrimUser(ctx context.Context, userID string, keep, limit int) (int64, error)
+	// DeleteOlderThan 删除 score（帖子发布时间）早于 before 的至多 limit 条，返回删除行数
+	DeleteOlderThan(ctx context.Context, before time.Time, limit int) (int64, error)
+	// Insert 写入 inbox 行，已存在的 (user_id, post_id) 忽略，返回实际新增行数
+	Insert(ctx context.Context, records []model.Inbox) (int64, error)
+	// PurgeAuthor 删除 userID 的 inbox 中 authorID 发布的至多 limit 条，返回删除行数
+	PurgeAuthor(ctx context.Context, userID, authorID string, limit int) (int64, error)
+}
+
+// inboxDedup 只忽略 (user_id, post_id) 已存在的行（唯一索引 ux_inbox_user_post），
+// 主键冲突等其他约束照常报错，不会悄悄丢掉关注者的 inbox 行
+var inboxDedup = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "user_id"}, {Name: "post_id"}},
+	DoNothing: true,
+}
+
+type inboxRepository struct{ db *gorm.DB }
+
+func NewInboxRepository(db *gorm.DB) InboxRepository { return &inboxRepository{db: db} }
+
+func (r *inboxRepository) DeleteByPost(ctx context.Context, postID string, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	ids := db.Model(&model.Inbox{}).Select("id").Where("post_id = ?", postID).Limit(limit)
+	res := db.Where("id IN (?)", ids).Delete(&model.Inbox{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *inboxRepository) ListUsers(ctx context.Context, after string, limit int) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&model.Inbox{}).
+		Distinct("user_id").
+		Where("user_id > ?", after).
+		Order("user_id").
+		Limit(limit).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (r *inboxRepository) TrimUser(ctx context.Context, userID string, keep, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	// 第 keep+1 新的一条即为需要删除的最新一条，没有则无需裁剪
+	var edge []model.Inbox
+	if err := db.Where("user_id = ?", userID).
+		Order("score DESC, post_id DESC").
+		Offset(keep).Limit(1).
+		Find(&edge).Error; err != nil {
+		return 0, err
+	}
+	if len(edge) == 0 {
+		return 0, nil
+	}
+	ids := db.Model(&model.Inbox{}).Select("id").
+		Where("user_id = ? AND (score, post_id) <= (?, ?)", userID, edge[0].Score, edge[0].PostID).
+		Limit(limit)
+	res := db.Where("id IN (?)", ids).Delete(&model.Inbox{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *inboxRepository) DeleteOlderThan(ctx context.Context, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	ids := db.Model(&model.Inbox{}).Select("id").Where("score < ?", before.UnixNano()).Limit(limit)
+	res := db.Where("id IN (?)", ids).Delete(&model.Inbox{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *inboxRepository) Insert(ctx context.Context, records []model.Inbox) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	res := r.db.WithContext(ctx).Clauses(inboxDedup).Create(&records)
+	return res.RowsAffected, res.Error
+}
+
+func (r *inboxRepository) PurgeAuthor(ctx context.Context, userID, authorID string, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	// inbox 不冗余作者，经 posts 关联（含已删除的帖子）
+	ids := db.Table("inbox").Select("inbox.id").
+		Joins("JOIN posts ON posts.id = inbox.post_id").
+		Where("inbox.user_id = ? AND posts.author_id = ?", userID, authorID).
+		Limit(limit)
+	res := db.Where("id IN (?)", ids).Delete(&model.Inbox{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// InboxRepositoryTestSuite inbox 仓储测试套件；ShardedInboxRepositoryTestSuite 以分库分表实现复用全部用例
+type InboxRepositoryTestSuite struct {
+	suite.Suite
+	posts *gorm.DB
+	repo  InboxRepository
+	// inboxPosts 按 (score, post_id) 倒序列出 userID 的 inbox
+	inboxPosts func(userID string) []string
+	cleanup    func()
+}
+
+func (suite *InboxRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), db.AutoMigrate(&model.Post{}, &model.Inbox{}))
+
+	suite.posts = db
+	suite.repo = NewInboxRepository(db)
+	suite.inboxPosts = func(userID string) []string {
+		var ids []string
+		db.Model(&model.Inbox{}).Where("user_id = ?", userID).Order("score DESC, post_id DESC").Pluck("post_id", &ids)
+		return ids
+	}
+	suite.cleanup = func() { db.Exec("DELETE FROM inbox") }
+}
+
+func (suite *InboxRepositoryTestSuite) TearDownTest() {
+	suite.posts.Exec("DELETE FROM posts")
+	suite.cleanup()
+}
+
+// seed 为 users 的每个人写入 author 的 n 条帖子，score 依次递增
+func (suite *InboxRepositoryTestSuite) seed(author string, n int, base time.Time, users ...string) {
+	var records []model.Inbox
+	for i := 0; i < n; i++ {
+		at := base.Add(time.Duration(i) * time.Second)
+		postID := fmt.Sprintf("%s-%d", author, i)
+		assert.NoError(suite.T(), suite.posts.Create(&model.Post{ID: postID, AuthorID: author, Payload: "p", CreatedAt: at, UpdatedAt: at}).Error)
+		for _, u := range users {
+			records = append(records, model.Inbox{ID: u + "/" + postID, UserID: u, PostID: postID, Score: at.UnixNano(), CreatedAt: at})
+		}
+	}
+	inserted, err := suite.repo.Insert(context.Background(), records)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(len(records)), inserted)
+}
+
+func (suite *InboxRepositoryTestSuite) TestInsertIgnoresDuplicates() {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+	suite.seed("x", 2, base, "a", "b")
+
+	dup := []model.Inbox{{ID: "dup", UserID: "a", PostID: "x-0", Score: base.UnixNano(), CreatedAt: base}}
+	inserted, err := suite.repo.Insert(ctx, dup)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), inserted)
+	assert.Equal(suite.T(), []string{"x-1", "x-0"}, suite.inboxPosts("a"))
+
+	// 主键冲突不是重复投递，必须报错而不是悄悄丢行
+	clash := []model.Inbox{{ID: "a/x-0", UserID: "a", PostID: "x-9", Score: base.UnixNano(), CreatedAt: base}}
+	_, err = suite.repo.Insert(ctx, clash)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *InboxRepositoryTestSuite) TestTrimUser() {
+	ctx := context.Background()
+	suite.seed("x", 5, time.Now().Add(-time.Hour), "a", "b")
+
+	deleted, err := suite.repo.TrimUser(ctx, "a", 2, 2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), deleted)
+	deleted, err = suite.repo.TrimUser(ctx, "a", 2, 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), deleted)
+	assert.Equal(suite.T(), []string{"x-4", "x-3"}, suite.inboxPosts("a"))
+	assert.Len(suite.T(), suite.inboxPosts("b"), 5)
+}
+
+func (suite *InboxRepositoryTestSuite) TestDeleteByPostAndOlderThan() {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+	users := []string{"a", "b", "c", "d", "x", "y"}
+	suite.seed("x", 3, base, users...)
+
+	// 合计至多 limit 条，返回值小于 limit 表示已删完
+	deleted, err := suite.repo.DeleteByPost(ctx, "x-0", 4)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(4), deleted)
+	deleted, err = suite.repo.DeleteByPost(ctx, "x-0", 4)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), deleted)
+
+	deleted, err = suite.repo.DeleteOlderThan(ctx, base.Add(1500*time.Millisecond), 100)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(len(users)), deleted)
+	for _, u := range users {
+		assert.Equal(suite.T(), []string{"x-2"}, suite.inboxPosts(u))
+	}
+}
+
+func (suite *InboxRepositoryTestSuite) TestListUsers() {
+	ctx := context.Background()
+	suite.seed("x", 1, time.Now(), "d", "a", "me", "c", "b")
+
+	var got []string
+	after := ""
+	for {
+		page, err := suite.repo.ListUsers(ctx, after, 2)
+		assert.NoError(suite.T(), err)
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, page...)
+		after = page[len(page)-1]
+	}
+	assert.Equal(suite.T(), []string{"a", "b", "c", "d", "me"}, got)
+}
+
+func (suite *InboxRepositoryTestSuite) TestPurgeAuthor() {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour)
+	suite.seed("x", 3, base, "a")
+	suite.seed("y", 2, base.Add(time.Minute), "a")
+	// 已删除的帖子同样清理
+	assert.NoError(suite.T(), suite.posts.Delete(&model.Post{ID: "x-1"}).Error)
+
+	deleted, err := suite.repo.PurgeAuthor(ctx, "a", "x", 2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), deleted)
+	deleted, err = suite.repo.PurgeAuthor(ctx, "a", "x", 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), deleted)
+	assert.Equal(suite.T(), []string{"y-1", "y-0"}, suite.inboxPosts("a"))
+}
+
+func TestInboxRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(InboxRepositoryTestSuite))
+}
+
+// ShardedInboxRepositoryTestSuite 在分库分表实现上运行 InboxRepositoryTestSuite 的全部用例，帖子在单独的库
+type ShardedInboxRepositoryTestSuite struct {
+	InboxRepositoryTestSuite
+}
+
+func (suite *ShardedInboxRepositoryTestSuite) SetupSuite() {
+	posts, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), posts.AutoMigrate(&model.Post{}))
+	dbs := openShardDBs(suite.T())
+	repo, err := NewShardedInboxRepository(dbs, testTablesPerDB, posts)
+	assert.NoError(suite.T(), err)
+	sharded := repo.(*ShardedInboxRepository)
+	assert.NoError(suite.T(), sharded.InitSchema())
+
+	suite.posts = posts
+	suite.repo = repo
+	suite.inboxPosts = func(userID string) []string {
+		db, table := sharded.shards.route(userID, "inbox")
+		var ids []string
+		db.Table(table).Where("user_id = ?", userID).Order("score DESC, post_id DESC").Pluck("post_id", &ids)
+		return ids
+	}
+	suite.cleanup = func() {
+		for _, g := range sharded.shards.all("inbox") {
+			g.db.Exec("DELETE FROM " + g.table)
+		}
+	}
+}
+
+func TestShardedInboxRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(ShardedInboxRepositoryTestSuite))
+}
+
+func TestInboxTimelineSeekUsesIndex(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.Inbox{}))
+
+	// 时间线 seek 分页走 (user_id, score, post_id) 索引，无需额外排序
+	var plan []struct{ Detail string }
+	assert.NoError(t, db.Raw(`EXPLAIN QUERY PLAN SELECT * FROM inbox
+		WHERE user_id = ? AND (score, post_id) < (?, ?)
+		ORDER BY score DESC, post_id DESC LIMIT 20`, "u", 1, "p").Scan(&plan).Error)
+	details := fmt.Sprint(plan)
+	assert.Contains(t, details, "idx_inbox_user_score_post")
+	assert.NotContains(t, details, "TEMP B-TREE")
+}
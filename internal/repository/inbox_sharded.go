@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// inboxShardColumns 分表 inbox_N 的列，与 model.Inbox 一致
+type inboxShardColumns struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	UserID    string `gorm:"type:varchar(36)"`
+	PostID    string `gorm:"type:varchar(36)"`
+	Score     int64
+	CreatedAt time.Time
+}
+
+var inboxShardIndexes = []shardIndex{
+	{suffix: "user_post", unique: true, columns: "user_id, post_id"},
+	{suffix: "user_score", columns: "user_id, score, post_id"},
+	{suffix: "post", columns: "post_id"},
+	{suffix: "score", columns: "score"},
+}
+
+// ShardedInboxRepository 分库分表 inbox 仓储，按 inbox 所属 user_id 路由（与关注/粉丝使用同一路由规则）。
+// 按帖子、按时间的清理与用户遍历没有路由键，需要扫描全部分表
+type ShardedInboxRepository struct {
+	shards userShards
+	// posts 不分片的帖子库，PurgeAuthor 经它确认帖子作者
+	posts *gorm.DB
+}
+
+// NewShardedInboxRepository 创建分库分表 inbox 仓储，库数取 len(dbs)，每库 tablesPerDB 张表，posts 为帖子所在的库
+func NewShardedInboxRepository(dbs []*gorm.DB, tablesPerDB int, posts *gorm.DB) (InboxRepository, error) {
+	shards, err := newUserShards(dbs, tablesPerDB)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedInboxRepository{shards: shards, posts: posts}, nil
+}
+
+// DeleteByPost 依次在各分表删除，合计至多 limit 条
+func (r *ShardedInboxRepository) DeleteByPost(ctx context.Context, postID string, limit int) (int64, error) {
+	return r.deleteEach(ctx, limit, func(q *gorm.DB) *gorm.DB { return q.Where("post_id = ?", postID) })
+}
+
+// DeleteOlderThan 依次在各分表删除，合计至多 limit 条
+func (r *ShardedInboxRepository) DeleteOlderThan(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return r.deleteEach(ctx, limit, func(q *gorm.DB) *gorm.DB { return q.Where("score < ?", before.UnixNano()) })
+}
+
+func (r *ShardedInboxRepository) deleteEach(ctx context.Context, limit int, scope func(*gorm.DB) *gorm.DB) (int64, error) {
+	var total int64
+	for _, g := range r.shards.all("inbox") {
+		remaining := int64(limit) - total
+		if remaining <= 0 {
+			break
+		}
+		db := g.db.WithContext(ctx)
+		ids := scope(db.Table(g.table)).Select("id").Limit(int(remaining))
+		res := db.Table(g.table).Where("id IN (?)", ids).Delete(&model.Inbox{})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
+
+// ListUsers 每张分表各取 limit 个后归并；同一用户只落在一张分表，无需去重
+func (r *ShardedInboxRepository) ListUsers(ctx context.Context, after string, limit int) ([]string, error) {
+	var res []string
+	for _, g := range r.shards.all("inbox") {
+		var ids []string
+		if err := g.db.WithContext(ctx).Table(g.table).
+			Distinct("user_id").
+			Where("user_id > ?", after).
+			Order("user_id").
+			Limit(limit).
+			Pluck("user_id", &ids).Error; err != nil {
+			return nil, err
+		}
+		res = append(res, ids...)
+	}
+	sort.Strings(res)
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (r *ShardedInboxRepository) TrimUser(ctx context.Context, userID string, keep, limit int) (int64, error) {
+	db, table := r.shards.route(userID, "inbox")
+	db = db.WithContext(ctx)
+	var edge []model.Inbox
+	if err := db.Table(table).
+		Where("user_id = ?", userID).
+		Order("score DESC, post_id DESC").
+		Offset(keep).Limit(1).
+		Find(&edge).Error; err != nil {
+		return 0, err
+	}
+	if len(edge) == 0 {
+		return 0, nil
+	}
+	ids := db.Table(table).Select("id").
+		Where("user_id = ? AND (score, post_id) <= (?, ?)", userID, edge[0].Score, edge[0].PostID).
+		Limit(limit)
+	res := db.Table(table).Where("id IN (?)", ids).Delete(&model.Inbox{})
+	return res.RowsAffected, res.Error
+}
+
+// Insert 按用户所在分表分组写入
+func (r *ShardedInboxRepository) Insert(ctx context.Context, records []model.Inbox) (int64, error) {
+	byUser := make(map[string][]model.Inbox)
+	userIDs := make([]string, 0, len(records))
+	for _, rec := range records {
+		if _, ok := byUser[rec.UserID]; !ok {
+			userIDs = append(userIDs, rec.UserID)
+		}
+		byUser[rec.UserID] = append(byUser[rec.UserID], rec)
+	}
+	var total int64
+	for _, g := range r.shards.group("inbox", userIDs) {
+		var rows []model.Inbox
+		for _, id := range g.userIDs {
+			rows = append(rows, byUser[id]...)
+		}
+		res := g.db.WithContext(ctx).Table(g.table).Clauses(inboxDedup).Create(&rows)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
+
+// PurgeAuthor 帖子不在分库中，无法联表：按 id 顺序分批扫描该用户的 inbox，到帖子库确认作者后删除
+func (r *ShardedInboxRepository) PurgeAuthor(ctx context.Context, userID, authorID string, limit int) (int64, error) {
+	db, table := r.shards.route(userID, "inbox")
+	db = db.WithContext(ctx)
+	var total int64
+	lastID := ""
+	for total < int64(limit) {
+		var rows []model.Inbox
+		if err := db.Table(table).
+			Select("id, post_id").
+			Where("user_id = ? AND id > ?", userID, lastID).
+			Order("id").
+			Limit(shardScanBatch).
+			Find(&rows).Error; err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+
+		postIDs := make([]string, len(rows))
+		for i, row := range rows {
+			postIDs[i] = row.PostID
+		}
+		// 含已删除的帖子，与单库实现一致
+		var own []string
+		if err := r.posts.WithContext(ctx).Unscoped().Model(&model.Post{}).
+			Where("id IN ? AND author_id = ?", postIDs, authorID).
+			Pluck("id", &own).Error; err != nil {
+			return total, err
+		}
+		if remaining := int64(limit) - total; int64(len(own)) > remaining {
+			own = own[:remaining]
+		}
+		if len(own) > 0 {
+			res := db.Table(table).Where("user_id = ? AND post_id IN ?", userID, own).Delete(&model.Inbox{})
+			if res.Error != nil {
+				return total, res.Error
+			}
+			total += res.RowsAffected
+		}
+		if len(rows) < shardScanBatch {
+			break
+		}
+	}
+	return total, nil
+}
+
+// InitSchema 初始化所有分片的 inbox 分表
+func (r *ShardedInboxRepository) InitSchema() error {
+	return r.shards.migrateShardTables("inbox", &inboxShardColumns{}, inboxShardIndexes)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// MuteRepository 屏蔽关系仓储
+type MuteRepository interface {
+	// Create 幂等写入屏蔽关系
+	Create(ctx context.Context, userID, mutedID string) error
+	Delete(ctx context.Context, userID, mutedID string) error
+	// Exists userID 是否已屏蔽 mutedID
+	Exists(ctx context.Context, userID, mutedID string) (bool, error)
+	// ListMuted userID 屏蔽的全部作者
+	ListMuted(ctx context.Context, userID string) ([]string, error)
+	// ListMutedBy userIDs 中屏蔽了 authorID 的用户（扇出时批量过滤）
+	ListMutedBy(ctx context.Context, authorID string, userIDs []string) ([]string, error)
+	// Count userID 当前的屏蔽数
+	Count(ctx context.Context, userID string) (int64, error)
+}
+
+type muteRepository struct{ db *gorm.DB }
+
+func NewMuteRepository(db *gorm.DB) MuteRepository { return &muteRepository{db: db} }
+
+func (r *muteRepository) Create(ctx context.Context, userID, mutedID string) error {
+	m := &model.Mute{ID: uuid.New().String(), UserID: userID, MutedID: mutedID}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(m).Error
+}
+
+func (r *muteRepository) Delete(ctx context.Context, userID, mutedID string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND muted_id = ?", userID, mutedID).
+		Delete(&model.Mute{}).Error
+}
+
+func (r *muteRepository) Exists(ctx context.Context, userID, mutedID string) (bool, error) {
+	var cnt int64
+	err := r.db.WithContext(ctx).Model(&model.Mute{}).
+		Where("user_id = ? AND muted_id = ?", userID, mutedID).
+		Count(&cnt).Error
+	return cnt > 0, err
+}
+
+func (r *muteRepository) ListMuted(ctx context.Context, userID string) ([]string, error) {
+	var res []string
+	err := r.db.WithContext(ctx).Model(&model.Mute{}).
+		Where("user_id = ?", userID).
+		Pluck("muted_id", &res).Error
+	return res, err
+}
+
+func (r *muteRepository) ListMutedBy(ctx context.Context, authorID string, userIDs []string) ([]string, error) {
+	var res []string
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	err := r.db.WithContext(ctx).Model(&model.Mute{}).
+		Where("muted_id = ? AND user_id IN ?", authorID, userIDs).
+		Pluck("user_id", &res).Error
+	return res, err
+}
+
+func (r *muteRepository) Count(ctx context.Context, userID string) (int64, error) {
+	var cnt int64
+	err := r.db.WithContext(ctx).Model(&model.Mute{}).Where("user_id = ?", userID).Count(&cnt).Error
+	return cnt, err
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrBucketConflict 桶映射已被其他进程修改（版本不匹配）
+var ErrBucketConflict = errors.New("shard bucket mapping changed concurrently")
+
+// BucketRouter 虚拟桶路由：order_id 对固定的桶数取模得到逻辑桶，桶经持久化的映射表 shard_buckets 对应到物理库。
+// 桶数是不超过基因取值数的 2 的幂，因此订单与其用户（同基因）总在同一个桶。
+// 增加分库时只需迁移部分桶，其余数据不动；桶的表号只由桶号决定（见 tableIndex），迁移前后不变
+type BucketRouter struct {
+	meta    *gorm.DB
+	buckets int
+	dbCount int
+	tables  int
+	mapping atomic.Pointer[bucketMapping]
+}
+
+// bucketMapping 映射表在内存中的快照，shadow 为 -1 表示没有影子库
+type bucketMapping struct {
+	primary []int
+	shadow  []int
+}
+
+// NewBucketRouter 创建桶路由，meta 为存放 shard_buckets 的库（通常是主库）；使用前需 InitSchema 或 Reload
+func NewBucketRouter(meta *gorm.DB, buckets, dbCount, tablesPerDB int) (*BucketRouter, error) {
+	if _, err := NewShardTopology(dbCount, tablesPerDB); err != nil {
+		return nil, err
+	}
+	if buckets < dbCount {
+		return nil, fmt.Errorf("bucket count %d is less than database count %d", buckets, dbCount)
+	}
+	if buckets&(buckets-1) != 0 || buckets > 1<<OrderGeneBits {
+		return nil, fmt.Errorf("bucket count %d must be a power of two no greater than %d", buckets, 1<<OrderGeneBits)
+	}
+	return &BucketRouter{meta: meta, buckets: buckets, dbCount: dbCount, tables: tablesPerDB}, nil
+}
+
+// Buckets 桶数
+func (r *BucketRouter) Buckets() int { return r.buckets }
+
+// DBCount 物理库数
+func (r *BucketRouter) DBCount() int { return r.dbCount }
+
+// BucketOf 订单所在的桶
+func (r *BucketRouter) BucketOf(orderID int64) int {
+	return OrderGene(orderID) % r.buckets
+}
+
+// BucketOfUser 用户订单所在的桶
+func (r *BucketRouter) BucketOfUser(userID int64) int {
+	return OrderGene(userID) % r.buckets
+}
+
+// TableName 桶所在的分表名
+func (r *BucketRouter) TableName(bucket int) string {
+	return getTableName(r.tableIndex(bucket))
+}
+
+// tableIndex 连续的 buckets/tablesPerDB 个桶共用一个表号。初始映射按 bucket % dbCount 定库，
+// 表号取桶号的高位部分，与库号互不相关，每个库的每张表都能分到桶；不依赖库数，扩容迁移后不变
+func (r *BucketRouter) tableIndex(bucket int) int {
+	return bucket * r.tables / r.buckets
+}
+
+// Route 桶当前的主库与影子库，没有影子库时 shadow 为 -1
+func (r *BucketRouter) Route(bucket int) (primary, shadow int) {
+	m := r.mapping.Load()
+	return m.primary[bucket], m.shadow[bucket]
+}
+
+// InitSchema 建映射表，并为缺失的桶写入初始映射 bucket % dbCount（已有映射不变），然后加载
+func (r *BucketRouter) InitSchema(ctx context.Context) error {
+	if err := r.meta.WithContext(ctx).AutoMigrate(&model.ShardBucket{}); err != nil {
+		return err
+	}
+	rows := make([]model.ShardBucket, r.buckets)
+	for b := range rows {
+		rows[b] = model.ShardBucket{Bucket: b, DBIndex: b % r.dbCount}
+	}
+	if err := r.meta.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, 500).Error; err != nil {
+		return err
+	}
+	return r.Reload(ctx)
+}
+
+// Reload 从映射表加载全部桶；映射不完整或引用了不存在的库时报错，保留旧快照。
+// 多进程部署时需定期调用（见 service.StartBucketRefresh），使其他进程的迁移切换生效
+func (r *BucketRouter) Reload(ctx context.Context) error {
+	var rows []model.ShardBucket
+	if err := r.meta.WithContext(ctx).Order("bucket").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) != r.buckets {
+		return fmt.Errorf("shard_buckets has %d buckets, expected %d", len(rows), r.buckets)
+	}
+	m := &bucketMapping{primary: make([]int, r.buckets), shadow: make([]int, r.buckets)}
+	for i, row := range rows {
+		if row.Bucket != i {
+			return fmt.Errorf("shard_buckets is missing bucket %d", i)
+		}
+		if row.DBIndex < 0 || row.DBIndex >= r.dbCount {
+			return fmt.Errorf("bucket %d maps to database %d, only %d configured", i, row.DBIndex, r.dbCount)
+		}
+		m.primary[i], m.shadow[i] = row.DBIndex, -1
+		if row.ShadowDB != nil {
+			if *row.ShadowDB < 0 || *row.ShadowDB >= r.dbCount {
+				return fmt.Errorf("bucket %d shadows to database %d, only %d configured", i, *row.ShadowDB, r.dbCount)
+			}
+			m.shadow[i] = *row.ShadowDB
+		}
+	}
+	r.mapping.Store(m)
+	return nil
+}
+
+// LoadBucket 从映射表读取单个桶的最新映射（不经快照）
+func (r *BucketRouter) LoadBucket(ctx context.Context, bucket int) (*model.ShardBucket, error) {
+	var row model.ShardBucket
+	if err := r.meta.WithContext(ctx).Where("bucket = ?", bucket).First(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// UpdateBucket 以 cur.Version 做乐观锁更新桶映射，成功后刷新本进程快照；版本不匹配返回 ErrBucketConflict
+func (r *BucketRouter) UpdateBucket(ctx context.Context, cur *model.ShardBucket, dbIndex int, shadow *int) error {
+	if dbIndex < 0 || dbIndex >= r.dbCount || (shadow != nil && (*shadow < 0 || *shadow >= r.dbCount)) {
+		return fmt.Errorf("bucket %d: database index out of range [0, %d)", cur.Bucket, r.dbCount)
+	}
+	res := r.meta.WithContext(ctx).Model(&model.ShardBucket{}).
+		Where("bucket = ? AND version = ?", cur.Bucket, cur.Version).
+		Updates(map[string]any{"db_index": dbIndex, "shadow_db": shadow, "version": cur.Version + 1, "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrBucketConflict
+	}
+	cur.DBIndex, cur.ShadowDB, cur.Version = dbIndex, shadow, cur.Version+1
+	return r.Reload(ctx)
+}
+
+// BucketedOrderRepository 按虚拟桶路由的订单仓储：读主库，写主库与影子库，支持在线迁移桶
+type BucketedOrderRepository struct {
+	router *BucketRouter
+	dbs    []*gorm.DB
+}
+
+// NewBucketedOrderRepository 创建按桶路由的订单仓储，dbs 下标与映射表中的库序号一致
+func NewBucketedOrderRepository(dbs []*gorm.DB, router *BucketRouter) (OrderRepository, error) {
+	if len(dbs) != router.dbCount {
+		return nil, fmt.Errorf("expected %d databases, got %d", router.dbCount, len(dbs))
+	}
+	return &BucketedOrderRepository{router: router, dbs: dbs}, nil
+}
+
+// Router 返回仓储使用的桶路由
+func (r *BucketedOrderRepository) Router() *BucketRouter {
+	return r.router
+}
+
+// Create 写入主库；迁移中的桶同时幂等写入影子库（复制可能已带过该行）。订单 ID 须由 NewOrderIDGenerator 的生成器按用户生成
+func (r *BucketedOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	if OrderGene(order.OrderID) != OrderGene(order.UserID) {
+		return ErrOrderGeneMismatch
+	}
+	bucket := r.router.BucketOf(order.OrderID)
+	primary, shadow := r.router.Route(bucket)
+	table := r.router.TableName(bucket)
+	if err := r.dbs[primary].WithContext(ctx).Table(table).Create(order).Error; err != nil {
+		return err
+	}
+	if shadow < 0 {
+		return nil
+	}
+	return r.dbs[shadow].WithContext(ctx).Table(table).Clauses(clause.OnConflict{UpdateAll: true}).Create(order).Error
+}
+
+// GetByOrderID 根据订单ID查询订单 (读主库)
+func (r *BucketedOrderRepository) GetByOrderID(ctx context.Context, orderID int64) (*model.Order, error) {
+	bucket := r.router.BucketOf(orderID)
+	primary, _ := r.router.Route(bucket)
+	var order model.Order
+	err := r.dbs[primary].WithContext(ctx).
+		Table(r.router.TableName(bucket)).
+		Where("order_id = ?", orderID).
+		First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetByUserID 用户的订单都在其所在桶的主库上 (读主库)
+func (r *BucketedOrderRepository) GetByUserID(ctx context.Context, userID int64, limit int) ([]*model.Order, error) {
+	bucket := r.router.BucketOfUser(userID)
+	primary, _ := r.router.Route(bucket)
+	var orders []*model.Order
+	err := r.dbs[primary].WithContext(ctx).
+		Table(r.router.TableName(bucket)).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&orders).Error
+	return orders, err
+}
+
+// UpdateStatus 更新主库，迁移中的桶同时更新影子库
+func (r *BucketedOrderRepository) UpdateStatus(ctx context.Context, orderID int64, status int8) error {
+	bucket := r.router.BucketOf(orderID)
+	primary, shadow := r.router.Route(bucket)
+	table := r.router.TableName(bucket)
+	if err := r.dbs[primary].WithContext(ctx).Table(table).
+		Where("order_id = ?", orderID).
+		Update("status", status).Error; err != nil {
+		return err
+	}
+	if shadow < 0 {
+		return nil
+	}
+	return r.dbs[shadow].WithContext(ctx).Table(table).
+		Where("order_id = ?", orderID).
+		Update("status", status).Error
+}
+
+// Count 每张分表只统计以该库为主库的桶，影子库里的副本与迁移残留不重复计数
+func (r *BucketedOrderRepository) Count(ctx context.Context) (int64, error) {
+	var total atomic.Int64
+	err := r.eachTable(func(dbIdx, tblIdx int, buckets []int) error {
+		var cnt int64
+		if err := r.dbs[dbIdx].WithContext(ctx).
+			Table(getTableName(tblIdx)).
+			Where("order_id % ? IN ?", r.router.buckets, buckets).
+			Count(&cnt).Error; err != nil {
+			return err
+		}
+		total.Add(cnt)
+		return nil
+	})
+	return total.Load(), err
+}
+
+// eachTable 并发地对每张存有主库桶的分表执行 fn，buckets 为该表上以该库为主库的桶；返回第一个错误
+func (r *BucketedOrderRepository) eachTable(fn func(dbIdx, tblIdx int, buckets []int) error) error {
+	owned := make(map[[2]int][]int)
+	m := r.router.mapping.Load()
+	for b, primary := range m.primary {
+		key := [2]int{primary, r.router.tableIndex(b)}
+		owned[key] = append(owned[key], b)
+	}
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(owned))
+	for key, buckets := range owned {
+		wg.Add(1)
+		go func(di, ti int, buckets []int) {
+			defer wg.Done()
+			if err := fn(di, ti, buckets); err != nil {
+				errChan <- err
+			}
+		}(key[0], key[1], buckets)
+	}
+	wg.Wait()
+	close(errChan)
+	return <-errChan
+}
+
+// Close 关闭所有分库连接（不关闭映射表所在的库）
+func (r *BucketedOrderRepository) Close() error {
+	for _, db := range r.dbs {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		if err := sqlDB.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitSchema 初始化所有分库的分表，新加入的空库同样适用
+func (r *BucketedOrderRepository) InitSchema() error {
+	for dbIdx, db := range r.dbs {
+		for tblIdx := 0; tblIdx < r.router.tables; tblIdx++ {
+			tableName := getTableName(tblIdx)
+			if err := migrateShardTable(db, tableName, &orderShardColumns{}, orderShardIndexes); err != nil {
+				return fmt.Errorf("failed to migrate table %s in db %d: %w", tableName, dbIdx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bucketScope 限定到某个桶的行
+func (r *BucketedOrderRepository) bucketScope(ctx context.Context, dbIdx, bucket int) *gorm.DB {
+	return r.dbs[dbIdx].WithContext(ctx).
+		Table(r.router.TableName(bucket)).
+		Where("order_id % ? = ?", r.router.buckets, bucket)
+}
+
+// CopyBucket 按 order_id 顺序把桶在 from 库中 afterID 之后的至多 limit 行幂等复制到 to 库，返回本批行数与最后的 order_id
+func (r *BucketedOrderRepository) CopyBucket(ctx context.Context, bucket, from, to int, afterID int64, limit int) (int, int64, error) {
+	var rows []*model.Order
+	if err := r.bucketScope(ctx, from, bucket).
+		Where("order_id > ?", afterID).
+		Order("order_id").
+		Limit(limit).
+		Find(&rows).Error; err != nil {
+		return 0, afterID, err
+	}
+	if len(rows) == 0 {
+		return 0, afterID, nil
+	}
+	if err := r.dbs[to].WithContext(ctx).Table(r.router.TableName(bucket)).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&rows).Error; err != nil {
+		return 0, afterID, err
+	}
+	return len(rows), rows[len(rows)-1].OrderID, nil
+}
+
+// BucketChecksum 桶在一个库中的行数与校验和（各行规范化后 FNV-64a 哈希求和，与行顺序无关）
+type BucketChecksum struct {
+	Rows int64
+	Sum  uint64
+}
+
+func (c *BucketChecksum) add(orders []*model.Order) {
+	for _, o := range orders {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d|%d|%.2f|%d|%d|%d", o.OrderID, o.UserID, o.Amount, o.Status,
+			o.CreatedAt.UnixMicro(), o.UpdatedAt.UnixMicro())
+		c.Sum += h.Sum64()
+	}
+	c.Rows += int64(len(orders))
+}
+
+// CompareBucket 计算桶在 src 与 dst 两个库中的行数与校验和。按 order_id 分段交替扫描，同一段在两边紧接着读取，
+// 迁移期间的并发双写只会在极短的窗口内造成两边不一致
+func (r *BucketedOrderRepository) CompareBucket(ctx context.Context, bucket, src, dst, batchSize int) (BucketChecksum, BucketChecksum, error) {
+	var (
+		srcSum, dstSum BucketChecksum
+		after          int64 = -1
+	)
+	for {
+		var srcRows []*model.Order
+		if err := r.bucketScope(ctx, src, bucket).
+			Where("order_id > ?", after).
+			Order("order_id").
+			Limit(batchSize).
+			Find(&srcRows).Error; err != nil {
+			return srcSum, dstSum, err
+		}
+		// 最后一段不设上界，目标库多出的行也计入
+		q := r.bucketScope(ctx, dst, bucket).Where("order_id > ?", after)
+		last := len(srcRows) == batchSize
+		if last {
+			q = q.Where("order_id <= ?", srcRows[len(srcRows)-1].OrderID)
+		}
+		var dstRows []*model.Order
+		if err := q.Find(&dstRows).Error; err != nil {
+			return srcSum, dstSum, err
+		}
+		srcSum.add(srcRows)
+		dstSum.add(dstRows)
+		if !last {
+			return srcSum, dstSum, nil
+		}
+		after = srcRows[len(srcRows)-1].OrderID
+	}
+}
+
+// PurgeBucket 删除桶在某个库中的至多 limit 行，用于迁移完成后清理源库或放弃迁移时清理目标库
+func (r *BucketedOrderRepository) PurgeBucket(ctx context.Context, bucket, dbIdx, limit int) (int64, error) {
+	db := r.dbs[dbIdx].WithContext(ctx)
+	ids := r.bucketScope(ctx, dbIdx, bucket).Select("order_id").Limit(limit)
+	res := db.Table(r.router.TableName(bucket)).Where("order_id IN (?)", ids).Delete(&model.Order{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+const testBuckets = 16
+
+func setupBucketedOrders(t *testing.T) (*gorm.DB, []*gorm.DB, *BucketedOrderRepository) {
+	meta, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	dbs := openShardDBs(t)
+	router, err := NewBucketRouter(meta, testBuckets, len(dbs), testTablesPerDB)
+	require.NoError(t, err)
+	require.NoError(t, router.InitSchema(context.Background()))
+	repo, err := NewBucketedOrderRepository(dbs, router)
+	require.NoError(t, err)
+	require.NoError(t, repo.(*BucketedOrderRepository).InitSchema())
+	return meta, dbs, repo.(*BucketedOrderRepository)
+}
+
+func TestBucketRouterMapping(t *testing.T) {
+	meta, dbs, repo := setupBucketedOrders(t)
+	router := repo.Router()
+	ctx := context.Background()
+
+	for b := 0; b < testBuckets; b++ {
+		primary, shadow := router.Route(b)
+		assert.Equal(t, b%len(dbs), primary)
+		assert.Equal(t, -1, shadow)
+	}
+	assert.Equal(t, 5, router.BucketOf(16*7+5))
+	assert.Equal(t, router.BucketOfUser(21), router.BucketOf(nextOrderID(t, newTestOrderIDs(t), 21)))
+	assert.Equal(t, getTableName(1), router.TableName(5))
+
+	// 乐观锁：过期版本更新失败
+	cur, err := router.LoadBucket(ctx, 5)
+	require.NoError(t, err)
+	stale := *cur
+	require.NoError(t, router.UpdateBucket(ctx, cur, 0, nil))
+	assert.ErrorIs(t, router.UpdateBucket(ctx, &stale, 1, nil), ErrBucketConflict)
+
+	// 重复初始化不覆盖已有映射
+	require.NoError(t, router.InitSchema(ctx))
+	primary, _ := router.Route(5)
+	assert.Equal(t, 0, primary)
+
+	// 少配了库时拒绝加载
+	shrunk, err := NewBucketRouter(meta, testBuckets, 1, testTablesPerDB)
+	require.NoError(t, err)
+	assert.Error(t, shrunk.Reload(ctx))
+	_, err = NewBucketRouter(meta, 2, 3, testTablesPerDB)
+	assert.Error(t, err)
+	_, err = NewBucketRouter(meta, 24, 3, testTablesPerDB)
+	assert.Error(t, err)
+}
+
+func TestBucketRouterSpreadsTables(t *testing.T) {
+	for _, c := range []struct{ buckets, dbs, tables int }{
+		{testBuckets, testShardDBs, testTablesPerDB},
+		{64, 8, 8},
+		{1024, 8, 8},
+		{256, 6, 4},
+	} {
+		router, err := NewBucketRouter(nil, c.buckets, c.dbs, c.tables)
+		require.NoError(t, err)
+		// 按初始映射 bucket % dbCount，每个 (库, 表) 至少分到一个桶
+		used := make(map[[2]int]bool)
+		for b := 0; b < c.buckets; b++ {
+			used[[2]int{b % c.dbs, router.tableIndex(b)}] = true
+		}
+		assert.Len(t, used, c.dbs*c.tables, "%d buckets on %d x %d", c.buckets, c.dbs, c.tables)
+	}
+}
+
+func TestBucketedOrderRepositoryDualWrites(t *testing.T) {
+	_, dbs, repo := setupBucketedOrders(t)
+	router := repo.Router()
+	ctx := context.Background()
+
+	// 桶 5 主库为 2，影子库为 0
+	cur, err := router.LoadBucket(ctx, 5)
+	require.NoError(t, err)
+	shadow := 0
+	require.NoError(t, router.UpdateBucket(ctx, cur, 2, &shadow))
+
+	base := time.Now().Add(-time.Hour)
+	// 用户 5 的订单基因为 5，全部落在桶 5
+	for i := int64(0); i < 6; i++ {
+		require.NoError(t, repo.Create(ctx, &model.Order{OrderID: i<<OrderGeneBits | 5, UserID: 5, Amount: 2, CreatedAt: base.Add(time.Duration(i) * time.Second)}))
+	}
+	require.NoError(t, repo.Create(ctx, &model.Order{OrderID: 6, UserID: 6, Amount: 3, CreatedAt: base}))
+	assert.ErrorIs(t, repo.Create(ctx, &model.Order{OrderID: 1<<OrderGeneBits | 6, UserID: 5}), ErrOrderGeneMismatch)
+	require.NoError(t, repo.UpdateStatus(ctx, 5, model.OrderStatusPaid))
+
+	for _, dbIdx := range []int{2, 0} {
+		var order model.Order
+		require.NoError(t, dbs[dbIdx].Table(router.TableName(5)).Where("order_id = ?", 5).First(&order).Error)
+		assert.Equal(t, int8(model.OrderStatusPaid), order.Status)
+	}
+	srcSum, dstSum, err := repo.CompareBucket(ctx, 5, 2, 0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), srcSum.Rows)
+	assert.Equal(t, srcSum, dstSum)
+
+	// 影子库里的副本不重复计数、不重复返回
+	cnt, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), cnt)
+	orders, err := repo.GetByUserID(ctx, 5, 100)
+	require.NoError(t, err)
+	assert.Len(t, orders, 6)
+
+	// 复制只补缺失或覆盖，清理只动该桶
+	purged, err := repo.PurgeBucket(ctx, 5, 0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), purged)
+	srcSum, dstSum, err = repo.CompareBucket(ctx, 5, 2, 0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dstSum.Rows)
+	assert.NotEqual(t, srcSum.Sum, dstSum.Sum)
+	n, last, err := repo.CopyBucket(ctx, 5, 2, 0, -1, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, int64(5<<OrderGeneBits|5), last)
+	purged, err = repo.PurgeBucket(ctx, 5, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), purged)
+	got, err := repo.GetByOrderID(ctx, 6)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, got.Amount)
+}
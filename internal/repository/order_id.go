@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/d60-Lab/gin-template/pkg/idgen"
+)
+
+// OrderGeneBits 订单 ID 低位携带的用户基因位数。
+// 基因取用户 ID 的低 OrderGeneBits 位，订单与其用户按基因路由，落在同一个库的同一张表
+const (
+	OrderGeneBits = 10
+	orderGeneMask = 1<<OrderGeneBits - 1
+)
+
+// OrderIDLayout 订单 ID 布局：41 位毫秒 | 5 位 worker | 7 位序号 | 10 位用户基因
+var OrderIDLayout = idgen.Layout{WorkerBits: idgen.DefaultWorkerBits, ShardBits: OrderGeneBits}
+
+// ErrOrderGeneMismatch 订单 ID 的低位基因与用户不符，按订单 ID 与按用户 ID 会路由到不同的分表
+var ErrOrderGeneMismatch = errors.New("order id does not carry the user's shard gene")
+
+// OrderGene 订单 ID 或用户 ID 的分片基因
+func OrderGene(id int64) int {
+	return int(id & orderGeneMask)
+}
+
+// NewOrderIDGenerator 创建订单 ID 生成器，Next(userID) 生成嵌入该用户基因的订单 ID
+func NewOrderIDGenerator(workerID int64) (*idgen.Generator, error) {
+	return idgen.New(OrderIDLayout, workerID)
+}
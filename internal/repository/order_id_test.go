@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/pkg/idgen"
+)
+
+func newTestOrderIDs(t *testing.T) *idgen.Generator {
+	gen, err := NewOrderIDGenerator(0)
+	require.NoError(t, err)
+	return gen
+}
+
+func nextOrderID(t *testing.T, gen *idgen.Generator, userID int64) int64 {
+	id, err := gen.Next(userID)
+	require.NoError(t, err)
+	return id
+}
+
+func TestOrderIDCarriesUserGene(t *testing.T) {
+	gen, err := NewOrderIDGenerator(3)
+	require.NoError(t, err)
+	var last int64
+	for _, userID := range []int64{0, 7, 1023, 1024, 123456789} {
+		id := nextOrderID(t, gen, userID)
+		assert.Greater(t, id, last)
+		assert.Equal(t, OrderGene(userID), OrderGene(id))
+		parts := OrderIDLayout.Decode(id)
+		assert.Equal(t, int64(OrderGene(userID)), parts.Shard)
+		assert.Equal(t, int64(3), parts.WorkerID)
+		last = id
+	}
+	_, err = NewOrderIDGenerator(1 << idgen.DefaultWorkerBits)
+	assert.Error(t, err)
+}
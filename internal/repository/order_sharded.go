@@ -3,55 +3,78 @@ package repository
 import (
 	"context"
 	"fmt"
-	"sort"
 	"sync"
+	"time"
 
 	"gorm.io/gorm"
 
 	"github.com/d60-Lab/gin-template/internal/model"
 )
 
-const (
-	// ShardCount 分片数量 (8个数据库 x 8张表 = 64个分片)
-	ShardCount = 8
-	TableCount = 8
-)
-
-// ShardedOrderRepository 分库分表订单仓储实现
-type ShardedOrderRepository struct {
-	// shards[dbIndex][tableIndex] = *gorm.DB
-	shards [][]*gorm.DB
+// ShardTopology 分库分表拓扑：DBCount 个库 x 每库 TableCount 张表，由 config.ShardingConfig 决定。
+// 路由只依赖这两个数，上线后修改任意一个都会改变已有数据的位置
+type ShardTopology struct {
+	DBCount    int
+	TableCount int
 }
 
-// NewShardedOrderRepository 创建分库分表订单仓储
-func NewShardedOrderRepository(dbs []*gorm.DB) (OrderRepository, error) {
-	if len(dbs) != ShardCount {
-		return nil, fmt.Errorf("expected %d databases, got %d", ShardCount, len(dbs))
+// NewShardTopology 校验并创建拓扑；分片总数不能超过订单基因的取值数，否则部分分表永远为空
+func NewShardTopology(dbCount, tableCount int) (ShardTopology, error) {
+	if err := validateShardCounts(dbCount, tableCount); err != nil {
+		return ShardTopology{}, err
+	}
+	if dbCount*tableCount > 1<<OrderGeneBits {
+		return ShardTopology{}, fmt.Errorf("shard topology %d x %d exceeds %d order genes", dbCount, tableCount, 1<<OrderGeneBits)
 	}
+	return ShardTopology{DBCount: dbCount, TableCount: tableCount}, nil
+}
 
-	shards := make([][]*gorm.DB, ShardCount)
-	for i := 0; i < ShardCount; i++ {
-		shards[i] = make([]*gorm.DB, TableCount)
-		for j := 0; j < TableCount; j++ {
-			shards[i][j] = dbs[i]
-		}
+// validateShardCounts 库数与每库表数都须为正
+func validateShardCounts(dbCount, tableCount int) error {
+	if dbCount <= 0 {
+		return fmt.Errorf("shard topology needs at least one database, got %d", dbCount)
+	}
+	if tableCount <= 0 {
+		return fmt.Errorf("shard topology needs at least one table per database, got %d", tableCount)
 	}
+	return nil
+}
 
-	return &ShardedOrderRepository{shards: shards}, nil
+// routeGene 基因取模定库，商再取模定表
+func (t ShardTopology) routeGene(gene int) (dbIndex, tableIndex int) {
+	return gene % t.DBCount, gene / t.DBCount % t.TableCount
 }
 
 // RouteByOrderID 根据订单ID路由到对应的分片
-// 规则: 高位确定库，低位确定表
-func RouteByOrderID(orderID int64) (dbIndex, tableIndex int) {
-	// 使用高位和低位分别确定库和表
-	dbIndex = int((orderID >> 8) % ShardCount)
-	tableIndex = int(orderID % TableCount)
-	return
+// 规则: 按订单 ID 低位的用户基因定位，与 RouteByUserID 一致
+func (t ShardTopology) RouteByOrderID(orderID int64) (dbIndex, tableIndex int) {
+	return t.routeGene(OrderGene(orderID))
+}
+
+// RouteByUserID 根据用户ID路由到其订单所在的分片
+func (t ShardTopology) RouteByUserID(userID int64) (dbIndex, tableIndex int) {
+	return t.routeGene(OrderGene(userID))
 }
 
-// RouteByUserID 根据用户ID路由到对应的数据库
-func RouteByUserID(userID int64) int {
-	return int(userID % ShardCount)
+// ShardedOrderRepository 分库分表订单仓储实现
+type ShardedOrderRepository struct {
+	topo ShardTopology
+	// dbs[dbIndex]，每个库上有 topo.TableCount 张分表
+	dbs []*gorm.DB
+}
+
+// NewShardedOrderRepository 创建分库分表订单仓储，库数取 len(dbs)，每库 tablesPerDB 张表
+func NewShardedOrderRepository(dbs []*gorm.DB, tablesPerDB int) (OrderRepository, error) {
+	topo, err := NewShardTopology(len(dbs), tablesPerDB)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedOrderRepository{topo: topo, dbs: dbs}, nil
+}
+
+// Topology 返回仓储使用的拓扑
+func (r *ShardedOrderRepository) Topology() ShardTopology {
+	return r.topo
 }
 
 // getTableName 获取分表名称
@@ -59,23 +82,26 @@ func getTableName(tableIndex int) string {
 	return fmt.Sprintf("orders_%d", tableIndex)
 }
 
-// Create 创建订单
+// Create 创建订单，订单 ID 须由 NewOrderIDGenerator 的生成器按用户生成
 func (r *ShardedOrderRepository) Create(ctx context.Context, order *model.Order) error {
-	dbIdx, tblIdx := RouteByOrderID(order.OrderID)
+	if OrderGene(order.OrderID) != OrderGene(order.UserID) {
+		return ErrOrderGeneMismatch
+	}
+	dbIdx, tblIdx := r.topo.RouteByOrderID(order.OrderID)
 	tableName := getTableName(tblIdx)
 	
-	return r.shards[dbIdx][tblIdx].WithContext(ctx).
+	return r.dbs[dbIdx].WithContext(ctx).
 		Table(tableName).
 		Create(order).Error
 }
 
 // GetByOrderID 根据订单ID查询订单 (精确路由)
 func (r *ShardedOrderRepository) GetByOrderID(ctx context.Context, orderID int64) (*model.Order, error) {
-	dbIdx, tblIdx := RouteByOrderID(orderID)
+	dbIdx, tblIdx := r.topo.RouteByOrderID(orderID)
 	tableName := getTableName(tblIdx)
 	
 	var order model.Order
-	err := r.shards[dbIdx][tblIdx].WithContext(ctx).
+	err := r.dbs[dbIdx].WithContext(ctx).
 		Table(tableName).
 		Where("order_id = ?", orderID).
 		First(&order).Error
@@ -85,72 +111,25 @@ func (r *ShardedOrderRepository) GetByOrderID(ctx context.Context, orderID int64
 	return &order, nil
 }
 
-// GetByUserID 根据用户ID查询订单列表 (需要查询该用户所在库的所有表)
+// GetByUserID 根据用户ID查询订单列表 (用户的订单与用户同基因，只在一张分表上)
 func (r *ShardedOrderRepository) GetByUserID(ctx context.Context, userID int64, limit int) ([]*model.Order, error) {
-	dbIdx := RouteByUserID(userID)
-	
-	// 并发查询该库的所有表
-	var wg sync.WaitGroup
-	resultChan := make(chan []*model.Order, TableCount)
-	errChan := make(chan error, TableCount)
-	
-	for tblIdx := 0; tblIdx < TableCount; tblIdx++ {
-		wg.Add(1)
-		go func(tableIndex int) {
-			defer wg.Done()
-			
-			tableName := getTableName(tableIndex)
-			var orders []*model.Order
-			err := r.shards[dbIdx][tableIndex].WithContext(ctx).
-				Table(tableName).
-				Where("user_id = ?", userID).
-				Order("created_at DESC").
-				Limit(limit * 2). // 多取一些，应用层再排序
-				Find(&orders).Error
-			
-			if err != nil {
-				errChan <- err
-				return
-			}
-			resultChan <- orders
-		}(tblIdx)
-	}
-	
-	// 等待所有查询完成
-	wg.Wait()
-	close(resultChan)
-	close(errChan)
-	
-	// 检查错误
-	if len(errChan) > 0 {
-		return nil, <-errChan
-	}
-	
-	// 合并结果
-	var allOrders []*model.Order
-	for orders := range resultChan {
-		allOrders = append(allOrders, orders...)
-	}
-	
-	// 按创建时间排序
-	sort.Slice(allOrders, func(i, j int) bool {
-		return allOrders[i].CreatedAt.After(allOrders[j].CreatedAt)
-	})
-	
-	// 返回前 limit 条
-	if len(allOrders) > limit {
-		allOrders = allOrders[:limit]
-	}
-	
-	return allOrders, nil
+	dbIdx, tblIdx := r.topo.RouteByUserID(userID)
+	var orders []*model.Order
+	err := r.dbs[dbIdx].WithContext(ctx).
+		Table(getTableName(tblIdx)).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&orders).Error
+	return orders, err
 }
 
 // UpdateStatus 更新订单状态
 func (r *ShardedOrderRepository) UpdateStatus(ctx context.Context, orderID int64, status int8) error {
-	dbIdx, tblIdx := RouteByOrderID(orderID)
+	dbIdx, tblIdx := r.topo.RouteByOrderID(orderID)
 	tableName := getTableName(tblIdx)
 	
-	return r.shards[dbIdx][tblIdx].WithContext(ctx).
+	return r.dbs[dbIdx].WithContext(ctx).
 		Table(tableName).
 		Where("order_id = ?", orderID).
 		Update("status", status).Error
@@ -161,17 +140,17 @@ func (r *ShardedOrderRepository) Count(ctx context.Context) (int64, error) {
 	var totalCount int64
 	var mu sync.Mutex
 	var wg sync.WaitGroup
-	errChan := make(chan error, ShardCount*TableCount)
+	errChan := make(chan error, r.topo.DBCount*r.topo.TableCount)
 	
-	for dbIdx := 0; dbIdx < ShardCount; dbIdx++ {
-		for tblIdx := 0; tblIdx < TableCount; tblIdx++ {
+	for dbIdx := 0; dbIdx < r.topo.DBCount; dbIdx++ {
+		for tblIdx := 0; tblIdx < r.topo.TableCount; tblIdx++ {
 			wg.Add(1)
 			go func(di, ti int) {
 				defer wg.Done()
 				
 				tableName := getTableName(ti)
 				var count int64
-				err := r.shards[di][ti].WithContext(ctx).
+				err := r.dbs[di].WithContext(ctx).
 					Table(tableName).
 					Count(&count).Error
 				
@@ -199,13 +178,7 @@ func (r *ShardedOrderRepository) Count(ctx context.Context) (int64, error) {
 
 // Close 关闭所有数据库连接
 func (r *ShardedOrderRepository) Close() error {
-	// 使用 map 去重，因为同一个数据库被引用了多次
-	dbMap := make(map[*gorm.DB]bool)
-	for i := 0; i < ShardCount; i++ {
-		dbMap[r.shards[i][0]] = true
-	}
-	
-	for db := range dbMap {
+	for _, db := range r.dbs {
 		sqlDB, err := db.DB()
 		if err != nil {
 			return err
@@ -214,25 +187,34 @@ func (r *ShardedOrderRepository) Close() error {
 			return err
 		}
 	}
-	
 	return nil
 }
 
+// orderShardColumns 分表 orders_N 的列，与 model.Order 一致；idx_user_created 改为按表名前缀另建
+type orderShardColumns struct {
+	OrderID   int64     `gorm:"primaryKey;autoIncrement:false"`
+	UserID    int64     `gorm:"not null"`
+	Amount    float64   `gorm:"type:decimal(10,2);not null"`
+	Status    int8      `gorm:"not null;default:0"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+var orderShardIndexes = []shardIndex{
+	{suffix: "user_created", columns: "user_id, created_at"},
+	{suffix: "status", columns: "status"},
+}
+
 // InitSchema 初始化所有分片的表结构
 func (r *ShardedOrderRepository) InitSchema() error {
-	for dbIdx := 0; dbIdx < ShardCount; dbIdx++ {
-		db := r.shards[dbIdx][0]
-		
-		// 为每个数据库创建 8 张分表
-		for tblIdx := 0; tblIdx < TableCount; tblIdx++ {
+	for dbIdx, db := range r.dbs {
+		// 为每个数据库创建 TableCount 张分表
+		for tblIdx := 0; tblIdx < r.topo.TableCount; tblIdx++ {
 			tableName := getTableName(tblIdx)
-			
-			// 创建表
-			if err := db.Table(tableName).AutoMigrate(&model.Order{}); err != nil {
+			if err := migrateShardTable(db, tableName, &orderShardColumns{}, orderShardIndexes); err != nil {
 				return fmt.Errorf("failed to migrate table %s in db %d: %w", tableName, dbIdx, err)
 			}
 		}
 	}
-	
 	return nil
 }
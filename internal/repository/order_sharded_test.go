@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+func TestShardTopologyValidation(t *testing.T) {
+	_, err := NewShardTopology(0, 8)
+	assert.Error(t, err)
+	_, err = NewShardTopology(8, 0)
+	assert.Error(t, err)
+
+	_, err = NewShardTopology(64, 32)
+	assert.Error(t, err)
+
+	topo, err := NewShardTopology(3, 4)
+	require.NoError(t, err)
+	// 基因 7：7 % 3 = 1 号库，7 / 3 % 4 = 2 号表
+	db, tbl := topo.RouteByUserID(7)
+	assert.Equal(t, 1, db)
+	assert.Equal(t, 2, tbl)
+	orderDB, orderTbl := topo.RouteByOrderID(nextOrderID(t, newTestOrderIDs(t), 7))
+	assert.Equal(t, db, orderDB)
+	assert.Equal(t, tbl, orderTbl)
+}
+
+func TestShardedOrderRepositoryFollowsTopology(t *testing.T) {
+	dbs := openShardDBs(t)
+	repo, err := NewShardedOrderRepository(dbs, testTablesPerDB)
+	require.NoError(t, err)
+	sharded := repo.(*ShardedOrderRepository)
+	require.NoError(t, sharded.InitSchema())
+	// 重复执行是幂等的
+	require.NoError(t, sharded.InitSchema())
+	for _, db := range dbs {
+		assert.True(t, db.Migrator().HasTable(getTableName(testTablesPerDB-1)))
+		assert.False(t, db.Migrator().HasTable(getTableName(testTablesPerDB)))
+	}
+
+	ctx := context.Background()
+	gen := newTestOrderIDs(t)
+	base := time.Now().Add(-time.Hour)
+	ids := make([]int64, 40)
+	for i := range ids {
+		ids[i] = nextOrderID(t, gen, int64(i%5))
+		require.NoError(t, repo.Create(ctx, &model.Order{OrderID: ids[i], UserID: int64(i % 5), Amount: 1, CreatedAt: base.Add(time.Duration(i) * time.Second)}))
+	}
+	cnt, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), cnt)
+
+	for _, id := range ids {
+		order, err := repo.GetByOrderID(ctx, id)
+		require.NoError(t, err)
+		dbIdx, tblIdx := sharded.Topology().RouteByOrderID(order.OrderID)
+		var n int64
+		dbs[dbIdx].Table(getTableName(tblIdx)).Where("order_id = ?", order.OrderID).Count(&n)
+		assert.Equal(t, int64(1), n)
+	}
+	for userID := int64(0); userID < 5; userID++ {
+		orders, err := repo.GetByUserID(ctx, userID, 100)
+		require.NoError(t, err)
+		assert.Len(t, orders, 8)
+	}
+
+	// 订单 ID 与用户基因不符时拒绝写入
+	assert.ErrorIs(t, repo.Create(ctx, &model.Order{OrderID: nextOrderID(t, gen, 1), UserID: 2}), ErrOrderGeneMismatch)
+}
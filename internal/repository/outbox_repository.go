@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// ErrLeaseLost 领取后的更新没有匹配到行：租约已过期，行被放回 pending 后由其他 worker 重新领取或已结束
+var ErrLeaseLost = errors.New("fanout lease lost")
+
+// OutboxRepository 帖子扇出外发盒仓储
+type OutboxRepository interface {
+	// Claim 领取一批到期的 pending 行：置为 processing、attempts+1，并设置 lease 租约
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.Outbox, error)
+	// Get 按 id 读取一行，不存在时返回 nil, nil
+	Get(ctx context.Context, id string) (*model.Outbox, error)
+	// ReleaseExpired 租约已过期的 processing 行放回 pending；已达 maxAttempts 的直接置为 failed。返回处理的行数
+	ReleaseExpired(ctx context.Context, maxAttempts int) (int64, error)
+	// SaveProgress、MarkDone、MarkRetry、MarkFailed 以领取时的 attempts 为凭据，只更新仍由本次领取持有的
+	// processing 行；行已被回收、重新领取或已结束时返回 ErrLeaseLost，租约过期的 worker 不会覆盖别人的结果
+	//
+	// SaveProgress 在同一事务内写入一页 inbox 并推进断点，返回实际新增的 inbox 行数
+	SaveProgress(ctx context.Context, id string, attempts int, records []model.Inbox, cursor *Cursor) (int64, error)
+	// MarkDone 扇出完成（fanout_count 已由 SaveProgress 累加）
+	MarkDone(ctx context.Context, id string, attempts int) error
+	// MarkRetry 记录一次失败并放回 pending，nextAt 之前不再领取
+	MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error
+	// MarkFailed 超过最大尝试次数，等待人工处理
+	MarkFailed(ctx context.Context, id string, attempts int, lastErr string) error
+	// ListFailed 按 (created_at, id) 升序 seek 分页列出 failed 行
+	ListFailed(ctx context.Context, after *Cursor, limit int) ([]*model.Outbox, *Cursor, error)
+	// Requeue 把 failed 行重置为 pending（attempts 清零），返回实际重置的行数
+	Requeue(ctx context.Context, ids []string) (int64, error)
+}
+
+type outboxRepository struct{ db *gorm.DB }
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository { return &outboxRepository{db: db} }
+
+func (r *outboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.Outbox, error) {
+	var batch []*model.Outbox
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Raw(`
+			SELECT *
+			FROM outbox
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY created_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		`, model.OutboxPending, now, limit).Scan(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]string, len(batch))
+		leaseUntil := now.Add(lease)
+		for i, b := range batch {
+			ids[i] = b.ID
+			b.Status = model.OutboxProcessing
+			b.Attempts++
+			b.LeaseUntil = &leaseUntil
+		}
+		return tx.Model(&model.Outbox{}).
+			Where("id IN ?", ids).
+			Updates(map[string]any{
+				"status":      model.OutboxProcessing,
+				"attempts":    gorm.Expr("attempts + 1"),
+				"lease_until": leaseUntil,
+			}).Error
+	})
+	return batch, err
+}
+
+func (r *outboxRepository) Get(ctx context.Context, id string) (*model.Outbox, error) {
+	var out model.Outbox
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&out).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (r *outboxRepository) ReleaseExpired(ctx context.Context, maxAttempts int) (int64, error) {
+	now := time.Now()
+	var total int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expired := func() *gorm.DB {
+			return tx.Model(&model.Outbox{}).Where("status = ? AND lease_until < ?", model.OutboxProcessing, now)
+		}
+		res := expired().Where("attempts >= ?", maxAttempts).
+			Updates(map[string]any{"status": model.OutboxFailed, "lease_until": nil, "last_error": "lease expired"})
+		if res.Error != nil {
+			return res.Error
+		}
+		total += res.RowsAffected
+		res = expired().
+			Updates(map[string]any{"status": model.OutboxPending, "lease_until": nil, "next_attempt_at": now, "last_error": "lease expired"})
+		total += res.RowsAffected
+		return res.Error
+	})
+	return total, err
+}
+
+// claimedOutbox 仍由本次领取持有的 outbox 行
+func claimedOutbox(tx *gorm.DB, id string, attempts int) *gorm.DB {
+	return tx.Model(&model.Outbox{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, model.OutboxProcessing, attempts)
+}
+
+func (r *outboxRepository) SaveProgress(ctx context.Context, id string, attempts int, records []model.Inbox, cursor *Cursor) (int64, error) {
+	return saveFanoutProgress(r.db.WithContext(ctx), func(tx *gorm.DB) *gorm.DB { return claimedOutbox(tx, id, attempts) }, records, cursor)
+}
+
+func (r *outboxRepository) MarkDone(ctx context.Context, id string, attempts int) error {
+	now := time.Now()
+	return leaseHeld(claimedOutbox(r.db.WithContext(ctx), id, attempts).
+		Updates(map[string]any{"status": model.OutboxDone, "processed_at": now, "lease_until": nil, "last_error": ""}))
+}
+
+// saveFanoutProgress 写入一页 inbox（重复的 (user_id, post_id) 忽略）并在同一事务内推进 claimed 选中行的断点，
+// 断点与 inbox 同时提交，崩溃后从断点继续既不丢行也不重复计数；行已不由本次领取持有时整页回滚并返回 ErrLeaseLost
+func saveFanoutProgress(db *gorm.DB, claimed func(tx *gorm.DB) *gorm.DB, records []model.Inbox, cursor *Cursor) (int64, error) {
+	var inserted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(records) > 0 {
+			res := tx.Clauses(inboxDedup).Create(&records)
+			if res.Error != nil {
+				return res.Error
+			}
+			inserted = res.RowsAffected
+		}
+		return leaseHeld(claimed(tx).Updates(map[string]any{
+			"cursor_at":    cursor.CreatedAt,
+			"cursor_id":    cursor.ID,
+			"fanout_count": gorm.Expr("fanout_count + ?", inserted),
+		}))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// leaseHeld 把领取后的更新没有匹配到行视为 ErrLeaseLost
+func leaseHeld(res *gorm.DB) error {
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error {
+	return leaseHeld(claimedOutbox(r.db.WithContext(ctx), id, attempts).
+		Updates(map[string]any{"status": model.OutboxPending, "next_attempt_at": nextAt, "lease_until": nil, "last_error": lastErr}))
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id string, attempts int, lastErr string) error {
+	return leaseHeld(claimedOutbox(r.db.WithContext(ctx), id, attempts).
+		Updates(map[string]any{"status": model.OutboxFailed, "lease_until": nil, "last_error": lastErr}))
+}
+
+func (r *outboxRepository) ListFailed(ctx context.Context, after *Cursor, limit int) ([]*model.Outbox, *Cursor, error) {
+	q := r.db.WithContext(ctx).Where("status = ?", model.OutboxFailed)
+	if after != nil {
+		q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+	}
+	var res []*model.Outbox
+	if err := q.Order("created_at ASC, id ASC").Limit(limit + 1).Find(&res).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(res) <= limit {
+		return res, nil, nil
+	}
+	res = res[:limit]
+	last := res[limit-1]
+	return res, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+func (r *outboxRepository) Requeue(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := r.db.WithContext(ctx).Model(&model.Outbox{}).
+		Where("id IN ? AND status = ?", ids, model.OutboxFailed).
+		Updates(map[string]any{"status": model.OutboxPending, "attempts": 0, "next_attempt_at": time.Now(), "last_error": ""})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// OutboxRepositoryTestSuite 外发盒仓储测试套件
+type OutboxRepositoryTestSuite struct {
+	suite.Suite
+	db   *gorm.DB
+	repo OutboxRepository
+}
+
+func (suite *OutboxRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.Require().NoError(err)
+	suite.Require().NoError(db.AutoMigrate(&model.Outbox{}))
+	suite.db = db
+	suite.repo = NewOutboxRepository(db)
+}
+
+func (suite *OutboxRepositoryTestSuite) TearDownTest() {
+	suite.db.Exec("DELETE FROM outbox")
+}
+
+func (suite *OutboxRepositoryTestSuite) seed(id, status string, attempts int, leaseUntil *time.Time, at time.Time) {
+	ob := &model.Outbox{ID: id, PostID: "p-" + id, AuthorID: "a", Status: status, Attempts: attempts, LeaseUntil: leaseUntil, CreatedAt: at, NextAttemptAt: at}
+	suite.Require().NoError(suite.db.Create(ob).Error)
+}
+
+func (suite *OutboxRepositoryTestSuite) load(id string) *model.Outbox {
+	var ob model.Outbox
+	suite.Require().NoError(suite.db.First(&ob, "id = ?", id).Error)
+	return &ob
+}
+
+// TestReleaseExpired 测试过期租约被回收：未达上限回到 pending，达到上限置为 failed，未过期的不动
+func (suite *OutboxRepositoryTestSuite) TestReleaseExpired() {
+	ctx := context.Background()
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	suite.seed("expired", model.OutboxProcessing, 1, &past, now)
+	suite.seed("exhausted", model.OutboxProcessing, 3, &past, now)
+	suite.seed("running", model.OutboxProcessing, 1, &future, now)
+
+	n, err := suite.repo.ReleaseExpired(ctx, 3)
+	suite.NoError(err)
+	suite.Equal(int64(2), n)
+	suite.Equal(model.OutboxPending, suite.load("expired").Status)
+	suite.Nil(suite.load("expired").LeaseUntil)
+	suite.Equal(model.OutboxFailed, suite.load("exhausted").Status)
+	suite.Equal(model.OutboxProcessing, suite.load("running").Status)
+}
+
+// TestStaleClaimCannotUpdate 测试租约被回收并重新领取后，旧领取的更新不生效
+func (suite *OutboxRepositoryTestSuite) TestStaleClaimCannotUpdate() {
+	ctx := context.Background()
+	now := time.Now()
+	lease := now.Add(time.Minute)
+	// 第 1 次领取已过期回收，第 2 次领取由其他 worker 持有
+	suite.seed("o1", model.OutboxProcessing, 2, &lease, now)
+
+	suite.ErrorIs(suite.repo.MarkFailed(ctx, "o1", 1, "stale"), ErrLeaseLost)
+	suite.ErrorIs(suite.repo.MarkRetry(ctx, "o1", 1, now, "stale"), ErrLeaseLost)
+	suite.ErrorIs(suite.repo.MarkDone(ctx, "o1", 1), ErrLeaseLost)
+	_, err := suite.repo.SaveProgress(ctx, "o1", 1, nil, &Cursor{CreatedAt: now, ID: "f1"})
+	suite.ErrorIs(err, ErrLeaseLost)
+	ob := suite.load("o1")
+	suite.Equal(model.OutboxProcessing, ob.Status)
+	suite.Nil(ob.CursorAt)
+
+	suite.NoError(suite.repo.MarkDone(ctx, "o1", 2))
+	suite.Equal(model.OutboxDone, suite.load("o1").Status)
+	// 已完成的行不会被迟到的失败覆盖
+	suite.ErrorIs(suite.repo.MarkFailed(ctx, "o1", 2, "late"), ErrLeaseLost)
+	suite.Equal(model.OutboxDone, suite.load("o1").Status)
+}
+
+// TestListFailedAndRequeue 测试 failed 列表分页与重新入队
+func (suite *OutboxRepositoryTestSuite) TestListFailedAndRequeue() {
+	ctx := context.Background()
+	base := time.Now().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		suite.seed(fmt.Sprintf("f%d", i), model.OutboxFailed, 8, nil, base.Add(time.Duration(i)*time.Second))
+	}
+	suite.seed("done", model.OutboxDone, 1, nil, base)
+
+	var ids []string
+	var after *Cursor
+	for {
+		rows, next, err := suite.repo.ListFailed(ctx, after, 2)
+		suite.NoError(err)
+		for _, r := range rows {
+			ids = append(ids, r.ID)
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	suite.Equal([]string{"f0", "f1", "f2", "f3", "f4"}, ids)
+
+	n, err := suite.repo.Requeue(ctx, []string{"f0", "f1", "done"})
+	suite.NoError(err)
+	suite.Equal(int64(2), n)
+	ob := suite.load("f0")
+	suite.Equal(model.OutboxPending, ob.Status)
+	suite.Equal(0, ob.Attempts)
+	suite.Equal(model.OutboxDone, suite.load("done").Status)
+}
+
+func TestOutboxRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(OutboxRepositoryTestSuite))
+}
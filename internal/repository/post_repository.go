@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// PostRepository 帖子读取（写入在 Publisher 事务内完成）
+type PostRepository interface {
+	// IsRetracted 帖子是否已被作者删除（存在墓碑）；帖子不存在时返回 false
+	IsRetracted(ctx context.Context, id string) (bool, error)
+	// ListRecentByAuthor 按发布时间倒序读取作者最近 limit 条未删除的帖子
+	ListRecentByAuthor(ctx context.Context, authorID string, limit int) ([]*model.Post, error)
+}
+
+type postRepository struct{ db *gorm.DB }
+
+func NewPostRepository(db *gorm.DB) PostRepository { return &postRepository{db: db} }
+
+func (r *postRepository) IsRetracted(ctx context.Context, id string) (bool, error) {
+	var cnt int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&model.Post{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Count(&cnt).Error
+	return cnt > 0, err
+}
+
+func (r *postRepository) ListRecentByAuthor(ctx context.Context, authorID string, limit int) ([]*model.Post, error) {
+	var posts []*model.Post
+	err := r.db.WithContext(ctx).
+		Where("author_id = ?", authorID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&posts).Error
+	return posts, err
+}
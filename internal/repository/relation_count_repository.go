@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// RelationCountRepository 关注数/粉丝数计数仓储
+type RelationCountRepository interface {
+	// BatchGet 批量读取计数，没有记录的用户不出现在结果中（视为 0）
+	BatchGet(ctx context.Context, userIDs []string) (map[string]*model.RelationCount, error)
+	// Recompute 从 follows / fans 重新统计这批用户的计数并覆盖写入，返回实际发生变化的用户。
+	// 统计期间计数被增量更新过的用户不覆盖，重读后重试，最多 maxRecountAttempts 轮，仍冲突的留给下一轮对账；
+	// 仍有 pending 关系事件（fans 冗余未追上 follows）的用户保留当前粉丝数，只修正关注数
+	Recompute(ctx context.Context, userIDs []string) ([]string, error)
+}
+
+// maxRecountAttempts Recompute 对统计期间计数发生变化的用户最多重试的轮数
+const maxRecountAttempts = 3
+
+type relationCountRepository struct{ db *gorm.DB }
+
+func NewRelationCountRepository(db *gorm.DB) RelationCountRepository {
+	return &relationCountRepository{db: db}
+}
+
+// incrRelationCount 在调用方事务内对计数做增量 upsert，column 为 following_count 或 follower_count
+func incrRelationCount(tx *gorm.DB, userID, column string, delta int64) error {
+	row := &model.RelationCount{UserID: userID, UpdatedAt: time.Now()}
+	if column == "following_count" {
+		row.FollowingCount = delta
+	} else {
+		row.FollowerCount = delta
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			column:       gorm.Expr("relation_counts."+column+" + ?", delta),
+			"updated_at": row.UpdatedAt,
+		}),
+	}).Create(row).Error
+}
+
+func (r *relationCountRepository) BatchGet(ctx context.Context, userIDs []string) (map[string]*model.RelationCount, error) {
+	return batchGetCounts(r.db.WithContext(ctx), userIDs)
+}
+
+func (r *relationCountRepository) Recompute(ctx context.Context, userIDs []string) ([]string, error) {
+	db := r.db.WithContext(ctx)
+	return recomputeCounts(db, userIDs, func(ids []string) (*recount, error) {
+		rc := &recount{lagging: make(map[string]bool)}
+		if err := pendingFollowerEvents(db, ids, rc.lagging); err != nil {
+			return nil, err
+		}
+		var err error
+		if rc.following, err = countEdges(db, "follows", "follower_id", ids); err != nil {
+			return nil, err
+		}
+		if rc.followers, err = countEdges(db, "fans", "user_id", ids); err != nil {
+			return nil, err
+		}
+		return rc, nil
+	})
+}
+
+// recount 一轮重新统计的结果；lagging 中的用户还有未冗余到 fans 的关系事件，其粉丝数不可信
+type recount struct {
+	following, followers map[string]int64
+	lagging              map[string]bool
+}
+
+// pendingFollowerEvents 把 userIDs 中作为被关注者仍有 pending 关系事件的用户记入 into
+func pendingFollowerEvents(db *gorm.DB, userIDs []string, into map[string]bool) error {
+	var ids []string
+	if err := db.Model(&model.RelationEvent{}).
+		Where("status = ? AND user_id IN ?", model.RelationEventPending, userIDs).
+		Distinct("user_id").
+		Pluck("user_id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		into[id] = true
+	}
+	return nil
+}
+
+// recomputeCounts 先读当前计数再统计明细，按读到的 updated_at 条件覆盖写入 countDB；
+// 期间提交的 incrRelationCount 会改 updated_at，这些用户不会被旧的统计值覆盖，重读后重试
+func recomputeCounts(countDB *gorm.DB, userIDs []string, count func(ids []string) (*recount, error)) ([]string, error) {
+	var changed []string
+	ids := userIDs
+	for attempt := 0; attempt < maxRecountAttempts && len(ids) > 0; attempt++ {
+		current, err := batchGetCounts(countDB, ids)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := count(ids)
+		if err != nil {
+			return nil, err
+		}
+		part, stale, err := applyRecount(countDB, ids, current, rc)
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, part...)
+		ids = stale
+	}
+	return changed, nil
+}
+
+func batchGetCounts(db *gorm.DB, userIDs []string) (map[string]*model.RelationCount, error) {
+	res := make(map[string]*model.RelationCount, len(userIDs))
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	var rows []*model.RelationCount
+	if err := db.Where("user_id IN ?", userIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.UserID] = row
+	}
+	return res, nil
+}
+
+// countEdges 统计 table 中 column 取值为 userIDs 的行数，没有行的用户不出现在结果中
+func countEdges(db *gorm.DB, table, column string, userIDs []string) (map[string]int64, error) {
+	var rows []struct {
+		ID  string
+		Cnt int64
+	}
+	if err := db.Table(table).
+		Select(column+" AS id, COUNT(*) AS cnt").
+		Where(column+" IN ?", userIDs).
+		Group(column).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		res[row.ID] = row.Cnt
+	}
+	return res, nil
+}
+
+// applyRecount 用重新统计的结果覆盖计数，current 为统计之前读到的计数。
+// 返回实际发生变化的用户，以及 current 之后计数已被改动、本次未写入的用户
+func applyRecount(db *gorm.DB, userIDs []string, current map[string]*model.RelationCount, rc *recount) ([]string, []string, error) {
+	now := time.Now()
+	var changed, stale []string
+	for _, id := range userIDs {
+		w := &model.RelationCount{UserID: id, FollowingCount: rc.following[id], FollowerCount: rc.followers[id], UpdatedAt: now}
+		cur, ok := current[id]
+		if rc.lagging[id] {
+			w.FollowerCount = 0
+			if ok {
+				w.FollowerCount = cur.FollowerCount
+			}
+		}
+		if ok && cur.FollowingCount == w.FollowingCount && cur.FollowerCount == w.FollowerCount {
+			continue
+		}
+		if !ok && w.FollowingCount == 0 && w.FollowerCount == 0 {
+			continue
+		}
+		var res *gorm.DB
+		if ok {
+			res = db.Model(&model.RelationCount{}).
+				Where("user_id = ? AND updated_at = ?", id, cur.UpdatedAt).
+				Updates(map[string]any{"following_count": w.FollowingCount, "follower_count": w.FollowerCount, "updated_at": now})
+		} else {
+			res = db.Clauses(clause.OnConflict{DoNothing: true}).Create(w)
+		}
+		if res.Error != nil {
+			return nil, nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			stale = append(stale, id)
+			continue
+		}
+		changed = append(changed, id)
+	}
+	return changed, stale, nil
+}
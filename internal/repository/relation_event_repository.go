@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// RelationEventRepository 关系变更外发盒仓储
+type RelationEventRepository interface {
+	// Claim 领取一批到期的 pending 事件，attempts +1 并把 next_attempt_at 推后 lease 作为租约；
+	// 处理者崩溃时租约到期后事件会被重新领取（至少一次），崩溃或卡住的次数同样计入 attempts
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.RelationEvent, error)
+	// MarkDone、MarkRetry、MarkDead 以领取时的 attempts 为凭据：事件已被其他 worker 重新领取或已结束时不生效，
+	// 租约过期的 worker 不会覆盖别人的结果
+	MarkDone(ctx context.Context, id string, attempts int) error
+	// MarkRetry 记录一次失败，nextAt 之前不再领取
+	MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error
+	// MarkDead 超过最大尝试次数，转入死信
+	MarkDead(ctx context.Context, id string, attempts int, lastErr string) error
+	CountPending(ctx context.Context) (int64, error)
+	// PurgeDone 删除 before 之前完成的至多 limit 条事件，返回删除行数；死信保留待人工处理
+	PurgeDone(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type relationEventRepository struct{ db *gorm.DB }
+
+func NewRelationEventRepository(db *gorm.DB) RelationEventRepository {
+	return &relationEventRepository{db: db}
+}
+
+// newRelationEvent 构造待写入的事件，由 followRepository 在同一事务内落库
+func newRelationEvent(action, userID, fanID string) *model.RelationEvent {
+	now := time.Now()
+	return &model.RelationEvent{
+		ID:            uuid.New().String(),
+		Action:        action,
+		UserID:        userID,
+		FanID:         fanID,
+		Status:        model.RelationEventPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func (r *relationEventRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.RelationEvent, error) {
+	var batch []*model.RelationEvent
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Raw(`
+			SELECT *
+			FROM relation_events
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY created_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		`, model.RelationEventPending, now, limit).Scan(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]string, len(batch))
+		for i, ev := range batch {
+			ids[i] = ev.ID
+			ev.Attempts++
+		}
+		return tx.Model(&model.RelationEvent{}).
+			Where("id IN ?", ids).
+			Updates(map[string]any{
+				"attempts":        gorm.Expr("attempts + 1"),
+				"next_attempt_at": now.Add(lease),
+			}).Error
+	})
+	return batch, err
+}
+
+// claimed 仍由本次领取持有的事件
+func (r *relationEventRepository) claimed(ctx context.Context, id string, attempts int) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&model.RelationEvent{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, model.RelationEventPending, attempts)
+}
+
+func (r *relationEventRepository) MarkDone(ctx context.Context, id string, attempts int) error {
+	return r.claimed(ctx, id, attempts).
+		Updates(map[string]any{"status": model.RelationEventDone, "last_error": ""}).Error
+}
+
+func (r *relationEventRepository) MarkRetry(ctx context.Context, id string, attempts int, nextAt time.Time, lastErr string) error {
+	return r.claimed(ctx, id, attempts).
+		Updates(map[string]any{"next_attempt_at": nextAt, "last_error": lastErr}).Error
+}
+
+func (r *relationEventRepository) MarkDead(ctx context.Context, id string, attempts int, lastErr string) error {
+	return r.claimed(ctx, id, attempts).
+		Updates(map[string]any{"status": model.RelationEventDead, "last_error": lastErr}).Error
+}
+
+func (r *relationEventRepository) PurgeDone(ctx context.Context, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	ids := db.Model(&model.RelationEvent{}).Select("id").
+		Where("status = ? AND updated_at < ?", model.RelationEventDone, before).
+		Limit(limit)
+	res := db.Where("id IN (?)", ids).Delete(&model.RelationEvent{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *relationEventRepository) CountPending(ctx context.Context) (int64, error) {
+	var cnt int64
+	err := r.db.WithContext(ctx).Model(&model.RelationEvent{}).
+		Where("status = ?", model.RelationEventPending).
+		Count(&cnt).Error
+	return cnt, err
+}
@@ -0,0 +1,471 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// RelationRepositoryTestSuite 关注/粉丝仓储测试套件；ShardedRelationRepositoryTestSuite 以分库分表实现复用全部用例
+type RelationRepositoryTestSuite struct {
+	suite.Suite
+	db         *gorm.DB
+	followRepo FollowRepository
+	fanRepo    FanRepository
+	countRepo  RelationCountRepository
+	// fanTable 返回 userID 的粉丝所在的表，countDB 返回其计数所在的库
+	fanTable func(userID string) *gorm.DB
+	countDB  func(userID string) *gorm.DB
+	// eventDBs 所有存放 relation_events 的库
+	eventDBs []*gorm.DB
+}
+
+// SetupSuite 测试套件初始化
+func (suite *RelationRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(suite.T(), err)
+
+	err = db.AutoMigrate(&model.Follow{}, &model.Block{}, &model.Fan{}, &model.RelationEvent{}, &model.RelationCount{})
+	assert.NoError(suite.T(), err)
+
+	suite.db = db
+	suite.followRepo = NewFollowRepository(db)
+	suite.fanRepo = NewFanRepository(db)
+	suite.countRepo = NewRelationCountRepository(db)
+	suite.fanTable = func(string) *gorm.DB { return db.Table("fans") }
+	suite.countDB = func(string) *gorm.DB { return db }
+	suite.eventDBs = []*gorm.DB{db}
+}
+
+// TearDownTest 每个测试后清理数据
+func (suite *RelationRepositoryTestSuite) TearDownTest() {
+	suite.db.Exec("DELETE FROM follows")
+	suite.db.Exec("DELETE FROM fans")
+	suite.db.Exec("DELETE FROM relation_events")
+	suite.db.Exec("DELETE FROM relation_counts")
+}
+
+// TestListFansAfter 测试粉丝列表游标分页能完整遍历且不重复
+func (suite *RelationRepositoryTestSuite) TestListFansAfter() {
+	ctx := context.Background()
+
+	// 一半的粉丝共用同一个 created_at，验证 id 作为并列时的决胜字段
+	base := time.Now().Truncate(time.Second)
+	for i := 0; i < 25; i++ {
+		at := base.Add(time.Duration(i) * time.Second)
+		if i%2 == 0 {
+			at = base
+		}
+		f := &model.Fan{ID: fmt.Sprintf("f%02d", i), UserID: "u0", FanID: fmt.Sprintf("fan%02d", i), CreatedAt: at}
+		assert.NoError(suite.T(), suite.fanTable(f.UserID).Create(f).Error)
+	}
+
+	seen := make(map[string]bool)
+	var after *Cursor
+	pages := 0
+	for {
+		items, next, err := suite.fanRepo.ListFansAfter(ctx, "u0", after, 10)
+		assert.NoError(suite.T(), err)
+		for _, it := range items {
+			assert.False(suite.T(), seen[it.FanID], "duplicate fan %s", it.FanID)
+			seen[it.FanID] = true
+		}
+		pages++
+		if next == nil {
+			break
+		}
+		// 游标经过编码/解码后仍可用
+		after, err = DecodeCursor(next.Encode())
+		assert.NoError(suite.T(), err)
+	}
+	assert.Len(suite.T(), seen, 25)
+	assert.Equal(suite.T(), 3, pages)
+}
+
+// TestListFollowingsAfter 测试关注列表游标分页
+func (suite *RelationRepositoryTestSuite) TestListFollowingsAfter() {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, "u0", fmt.Sprintf("u%d", i+1)))
+	}
+
+	items, next, err := suite.followRepo.ListFollowingsAfter(ctx, "u0", nil, 5)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), items, 5)
+	assert.Nil(suite.T(), next)
+
+	items, next, err = suite.followRepo.ListFollowingsAfter(ctx, "u0", nil, 3)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), items, 3)
+	assert.NotNil(suite.T(), next)
+
+	rest, next, err := suite.followRepo.ListFollowingsAfter(ctx, "u0", next, 3)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), rest, 2)
+	assert.Nil(suite.T(), next)
+
+	// 最近关注的按关注时间倒序
+	recent, err := suite.followRepo.ListRecentFollowees(ctx, "u0", 2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"u5", "u4"}, recent)
+}
+
+// TestListBetween 测试一次查询取出双向关注边
+func (suite *RelationRepositoryTestSuite) TestListBetween() {
+	ctx := context.Background()
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", "a"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "me"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "b", "me"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", "c"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+
+	edges, err := suite.followRepo.ListBetween(ctx, "me", []string{"a", "b", "d"})
+	assert.NoError(suite.T(), err)
+	got := make(map[string]bool)
+	for _, e := range edges {
+		got[e.FollowerID+"->"+e.FolloweeID] = true
+	}
+	assert.Equal(suite.T(), map[string]bool{"me->a": true, "a->me": true, "b->me": true}, got)
+
+	edges, err = suite.followRepo.ListBetween(ctx, "me", nil)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), edges)
+}
+
+// TestDecodeCursorInvalid 测试非法游标
+func (suite *RelationRepositoryTestSuite) TestDecodeCursorInvalid() {
+	_, err := DecodeCursor("%%%")
+	assert.ErrorIs(suite.T(), err, ErrInvalidCursor)
+
+	c, err := DecodeCursor("")
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), c)
+}
+
+// TestRelationRepositoryTestSuite 运行测试套件
+// TestRelationCounts 测试计数随关注/粉丝写入增量维护，重复写入不重复计数，Recompute 能修正漂移
+func (suite *RelationRepositoryTestSuite) TestRelationCounts() {
+	ctx := context.Background()
+	countRepo := suite.countRepo
+
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "c"))
+	assert.NoError(suite.T(), suite.fanRepo.Create(ctx, "b", "a"))
+	assert.NoError(suite.T(), suite.fanRepo.Create(ctx, "b", "a"))
+	assert.NoError(suite.T(), suite.followRepo.Delete(ctx, "a", "c"))
+
+	counts, err := countRepo.BatchGet(ctx, []string{"a", "b", "c"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), counts["a"].FollowingCount)
+	assert.Equal(suite.T(), int64(1), counts["b"].FollowerCount)
+	_, ok := counts["c"]
+	assert.False(suite.T(), ok)
+
+	// 人为制造漂移后对账
+	suite.countDB("a").Model(&model.RelationCount{}).Where("user_id = ?", "a").Update("following_count", 7)
+	changed, err := countRepo.Recompute(ctx, []string{"a", "b", "c"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"a"}, changed)
+	counts, err = countRepo.BatchGet(ctx, []string{"a"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(1), counts["a"].FollowingCount)
+
+	changed, err = countRepo.Recompute(ctx, []string{"a", "b", "c"})
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), changed)
+}
+
+// TestRecomputeKeepsConcurrentIncrements 测试统计之后提交的增量不会被旧的统计值覆盖
+func (suite *RelationRepositoryTestSuite) TestRecomputeKeepsConcurrentIncrements() {
+	ctx := context.Background()
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+	db := suite.countDB("a")
+	db.Model(&model.RelationCount{}).Where("user_id = ?", "a").Update("following_count", 7)
+	snapshot, err := batchGetCounts(db, []string{"a"})
+	assert.NoError(suite.T(), err)
+	// 统计读到 1 条关注之后又提交了一次关注
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "c"))
+
+	changed, stale, err := applyRecount(db, []string{"a"}, snapshot, &recount{following: map[string]int64{"a": 1}})
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), changed)
+	assert.Equal(suite.T(), []string{"a"}, stale)
+	counts, err := suite.countRepo.BatchGet(ctx, []string{"a"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(8), counts["a"].FollowingCount)
+
+	// 重读后按最新统计修正
+	changed, err = suite.countRepo.Recompute(ctx, []string{"a"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"a"}, changed)
+	counts, err = suite.countRepo.BatchGet(ctx, []string{"a"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), counts["a"].FollowingCount)
+}
+
+// TestRecomputeKeepsLaggingFollowerCount 测试 fans 冗余尚未追上时不按 fans 修正粉丝数，追上后再修正
+func (suite *RelationRepositoryTestSuite) TestRecomputeKeepsLaggingFollowerCount() {
+	ctx := context.Background()
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+	assert.NoError(suite.T(), suite.countDB("b").Create(&model.RelationCount{UserID: "b", FollowerCount: 5, UpdatedAt: time.Now()}).Error)
+
+	changed, err := suite.countRepo.Recompute(ctx, []string{"b"})
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), changed)
+	counts, err := suite.countRepo.BatchGet(ctx, []string{"b"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(5), counts["b"].FollowerCount)
+
+	for _, db := range suite.eventDBs {
+		db.Model(&model.RelationEvent{}).Where("status = ?", model.RelationEventPending).Update("status", model.RelationEventDone)
+	}
+	changed, err = suite.countRepo.Recompute(ctx, []string{"b"})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"b"}, changed)
+	counts, err = suite.countRepo.BatchGet(ctx, []string{"b"})
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), counts["b"].FollowerCount)
+}
+
+// TestMutualsFriendsAndSecondDegree 测试共同关注、互关好友与二度关注
+func (suite *RelationRepositoryTestSuite) TestMutualsFriendsAndSecondDegree() {
+	ctx := context.Background()
+	// a -> b, c, d；b -> a, c, x；c -> a, x, y；d -> x
+	edges := [][2]string{
+		{"a", "b"}, {"a", "c"}, {"a", "d"},
+		{"b", "a"}, {"b", "c"}, {"b", "x"},
+		{"c", "a"}, {"c", "x"}, {"c", "y"},
+		{"d", "x"},
+	}
+	for _, e := range edges {
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, e[0], e[1]))
+	}
+
+	common, err := suite.followRepo.ListCommonFollowings(ctx, "b", "c", 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"a", "x"}, common)
+	common, err = suite.followRepo.ListCommonFollowings(ctx, "b", "c", 1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"a"}, common)
+
+	var friends []string
+	var after *Cursor
+	for {
+		page, next, err := suite.followRepo.ListFriendsAfter(ctx, "a", after, 1)
+		assert.NoError(suite.T(), err)
+		for _, f := range page {
+			friends = append(friends, f.FolloweeID)
+		}
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	assert.ElementsMatch(suite.T(), []string{"b", "c"}, friends)
+
+	recs, err := suite.followRepo.ListSecondDegree(ctx, "a", 10, 10, 10)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), recs, 2)
+	assert.Equal(suite.T(), "x", recs[0].UserID)
+	assert.Equal(suite.T(), int64(3), recs[0].Overlap)
+	assert.Equal(suite.T(), "y", recs[1].UserID)
+
+	// 每个来源只看最近 1 条关注：b -> x、c -> y、d -> x
+	recs, err = suite.followRepo.ListSecondDegree(ctx, "a", 10, 1, 10)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), recs, 2)
+	assert.Equal(suite.T(), "x", recs[0].UserID)
+	assert.Equal(suite.T(), int64(2), recs[0].Overlap)
+	assert.Equal(suite.T(), int64(1), recs[1].Overlap)
+
+	recs, err = suite.followRepo.ListSecondDegree(ctx, "a", 10, 10, 1)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), recs, 1)
+	assert.Equal(suite.T(), "x", recs[0].UserID)
+}
+
+// TestSecondDegreeSkipsFollowedTopCandidates 测试排在前面的候选超过一批都已被关注时，仍能找到其后的候选
+func (suite *RelationRepositoryTestSuite) TestSecondDegreeSkipsFollowedTopCandidates() {
+	ctx := context.Background()
+	n := secondDegreeBatch + 50
+	for i := 0; i < n; i++ {
+		t := fmt.Sprintf("t%04d", i)
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", t))
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, "s1", t))
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, "s2", t))
+	}
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "s1", "z"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "s2", "z"))
+	// s1、s2 是 me 最近关注的人，作为二度扩展的来源
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", "s1"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", "s2"))
+
+	recs, err := suite.followRepo.ListSecondDegree(ctx, "me", 2, n+1, 10)
+	assert.NoError(suite.T(), err)
+	if assert.Len(suite.T(), recs, 1) {
+		assert.Equal(suite.T(), "z", recs[0].UserID)
+		assert.Equal(suite.T(), int64(2), recs[0].Overlap)
+	}
+}
+
+func TestRelationRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(RelationRepositoryTestSuite))
+}
+
+// TestFollowCreateRechecksBlock 测试单库关注在插入语句内复查拉黑：任一方向拉黑都拒绝，且不产生事件和计数
+func TestFollowCreateRechecksBlock(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.Follow{}, &model.Block{}, &model.RelationEvent{}, &model.RelationCount{}))
+	repo := NewFollowRepository(db)
+	assert.NoError(t, NewBlockRepository(db).Create(ctx, "b", "a"))
+
+	assert.ErrorIs(t, repo.Create(ctx, "a", "b"), ErrBlocked)
+	assert.ErrorIs(t, repo.Create(ctx, "b", "a"), ErrBlocked)
+	var follows, events int64
+	db.Model(&model.Follow{}).Count(&follows)
+	db.Model(&model.RelationEvent{}).Count(&events)
+	assert.Zero(t, follows)
+	assert.Zero(t, events)
+
+	// 重复关注仍然幂等
+	assert.NoError(t, repo.Create(ctx, "a", "c"))
+	assert.NoError(t, repo.Create(ctx, "a", "c"))
+	db.Model(&model.Follow{}).Count(&follows)
+	assert.Equal(t, int64(1), follows)
+}
+
+// 分片测试的拓扑，刻意不取 2 的幂
+const (
+	testShardDBs    = 3
+	testTablesPerDB = 4
+)
+
+// openShardDBs 打开 testShardDBs 个相互独立的 sqlite 内存库
+func openShardDBs(t *testing.T) []*gorm.DB {
+	dbs := make([]*gorm.DB, testShardDBs)
+	for i := range dbs {
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		assert.NoError(t, err)
+		// 内存库随连接存在，固定单连接
+		sqlDB, err := db.DB()
+		assert.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+		dbs[i] = db
+	}
+	return dbs
+}
+
+// ShardedRelationRepositoryTestSuite 在分库分表实现上运行 RelationRepositoryTestSuite 的全部用例
+type ShardedRelationRepositoryTestSuite struct {
+	RelationRepositoryTestSuite
+	dbs []*gorm.DB
+}
+
+func (suite *ShardedRelationRepositoryTestSuite) SetupSuite() {
+	suite.dbs = openShardDBs(suite.T())
+	followRepo, err := NewShardedFollowRepository(suite.dbs, testTablesPerDB)
+	assert.NoError(suite.T(), err)
+	fanRepo, err := NewShardedFanRepository(suite.dbs, testTablesPerDB)
+	assert.NoError(suite.T(), err)
+	countRepo, err := NewShardedRelationCountRepository(suite.dbs, testTablesPerDB)
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), followRepo.(*ShardedFollowRepository).InitSchema())
+	assert.NoError(suite.T(), fanRepo.(*ShardedFanRepository).InitSchema())
+	// 重复执行是幂等的
+	assert.NoError(suite.T(), fanRepo.(*ShardedFanRepository).InitSchema())
+
+	suite.followRepo = followRepo
+	suite.fanRepo = fanRepo
+	suite.countRepo = countRepo
+	suite.fanTable = func(userID string) *gorm.DB {
+		db, table := fanRepo.(*ShardedFanRepository).shards.route(userID, "fans")
+		return db.Table(table)
+	}
+	suite.countDB = func(userID string) *gorm.DB {
+		dbIdx, _ := fanRepo.(*ShardedFanRepository).shards.topo.RouteByUserKey(userID)
+		return suite.dbs[dbIdx]
+	}
+	suite.eventDBs = suite.dbs
+}
+
+func (suite *ShardedRelationRepositoryTestSuite) TearDownTest() {
+	for _, db := range suite.dbs {
+		for i := 0; i < testTablesPerDB; i++ {
+			db.Exec("DELETE FROM " + shardTableName("follows", i))
+			db.Exec("DELETE FROM " + shardTableName("fans", i))
+		}
+		db.Exec("DELETE FROM relation_events")
+		db.Exec("DELETE FROM relation_counts")
+	}
+}
+
+// TestRoutesByUser 关注边、事件与计数都落在关注者所在的库
+func (suite *ShardedRelationRepositoryTestSuite) TestRoutesByUser() {
+	ctx := context.Background()
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "a", "b"))
+
+	dbIdx, tblIdx := suite.followRepo.(*ShardedFollowRepository).shards.topo.RouteByUserKey("a")
+	for i, db := range suite.dbs {
+		var follows, events int64
+		db.Table(shardTableName("follows", tblIdx)).Count(&follows)
+		db.Model(&model.RelationEvent{}).Count(&events)
+		if i == dbIdx {
+			assert.Equal(suite.T(), int64(1), follows)
+			assert.Equal(suite.T(), int64(1), events)
+		} else {
+			assert.Zero(suite.T(), follows)
+			assert.Zero(suite.T(), events)
+		}
+	}
+
+	_, err := NewShardedFollowRepository(nil, testTablesPerDB)
+	assert.Error(suite.T(), err)
+	_, err = NewShardedFollowRepository(suite.dbs, 0)
+	assert.Error(suite.T(), err)
+
+	// 关系链按哈希路由，分片数不受订单基因的 1024 上限约束
+	shards, err := newUserShards(suite.dbs, 1<<OrderGeneBits)
+	assert.NoError(suite.T(), err)
+	dbIdx, tblIdx = shards.topo.RouteByUserKey("a")
+	assert.Less(suite.T(), dbIdx, len(suite.dbs))
+	assert.Less(suite.T(), tblIdx, 1<<OrderGeneBits)
+}
+
+// TestFriendsScanIsBounded 互关稀疏时单次调用只扫描有限批关注，返回空页和扫描到的位置，续翻能找到后面的好友
+func (suite *ShardedRelationRepositoryTestSuite) TestFriendsScanIsBounded() {
+	ctx := context.Background()
+	n := shardScanBatch * maxFriendScanBatches
+	for i := 0; i < n; i++ {
+		assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", fmt.Sprintf("u%05d", i)))
+	}
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "me", "friend"))
+	assert.NoError(suite.T(), suite.followRepo.Create(ctx, "friend", "me"))
+
+	page, next, err := suite.followRepo.ListFriendsAfter(ctx, "me", nil, 10)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), page)
+	if !assert.NotNil(suite.T(), next) {
+		return
+	}
+	page, next, err = suite.followRepo.ListFriendsAfter(ctx, "me", next, 10)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), next)
+	if assert.Len(suite.T(), page, 1) {
+		assert.Equal(suite.T(), "friend", page[0].FolloweeID)
+	}
+}
+
+func TestShardedRelationRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(ShardedRelationRepositoryTestSuite))
+}
@@ -0,0 +1,615 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+// 关系链分库分表：follows 按 follower_id、fans 按 user_id 路由，与 ShardedOrderRepository 一样由 ShardTopology
+// 决定库表规模（len(dbs) 个库 x 每库 tablesPerDB 张表）。同一用户的关注、粉丝、relation_counts 与 relation_events
+// 落在同一个库，关注/取关仍在单库事务内写事件和计数；每个库的 relation_events 需要各自的 FanReplicator 消费。
+
+const (
+	// shardScanBatch 跨分片查询（共同关注、好友、按作者清理 inbox）每轮扫描的行数
+	shardScanBatch = 500
+	// maxFriendScanBatches 分片好友列表单次调用最多扫描的关注批数，扫满仍不足一页时返回已扫到的位置作为游标
+	maxFriendScanBatches = 4
+)
+
+// RouteByUserKey 字符串用户 ID 的分片路由：FNV-1a 哈希右移 8 位后取模定库、哈希取模定表。
+// 与订单的基因路由无关，不受 OrderGeneBits 的分片数上限约束
+func (t ShardTopology) RouteByUserKey(userID string) (dbIndex, tableIndex int) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	v := h.Sum32()
+	dbIndex = int((v >> 8) % uint32(t.DBCount))
+	tableIndex = int(v % uint32(t.TableCount))
+	return
+}
+
+// shardTableName 分表名称，如 follows_3
+func shardTableName(base string, tableIndex int) string {
+	return fmt.Sprintf("%s_%d", base, tableIndex)
+}
+
+// userShards 按用户 ID 路由的一组分库
+type userShards struct {
+	topo ShardTopology
+	dbs  []*gorm.DB
+}
+
+// newUserShards 只校验库表数为正；按哈希路由，分片总数可超过订单基因数
+func newUserShards(dbs []*gorm.DB, tablesPerDB int) (userShards, error) {
+	if err := validateShardCounts(len(dbs), tablesPerDB); err != nil {
+		return userShards{}, err
+	}
+	return userShards{topo: ShardTopology{DBCount: len(dbs), TableCount: tablesPerDB}, dbs: dbs}, nil
+}
+
+// route 返回 userID 所在的库与分表名
+func (s userShards) route(userID, base string) (*gorm.DB, string) {
+	dbIdx, tblIdx := s.topo.RouteByUserKey(userID)
+	return s.dbs[dbIdx], shardTableName(base, tblIdx)
+}
+
+// table 返回 userID 所在分表上的查询
+func (s userShards) table(ctx context.Context, userID, base string) *gorm.DB {
+	db, table := s.route(userID, base)
+	return db.WithContext(ctx).Table(table)
+}
+
+// shardGroup 一张分表及路由到它的用户
+type shardGroup struct {
+	dbIndex int
+	db      *gorm.DB
+	table   string
+	userIDs []string
+}
+
+// group 按分表对用户分组（去重），按 (库, 表) 排序使结果稳定
+func (s userShards) group(base string, userIDs []string) []shardGroup {
+	idx := make(map[[2]int]int)
+	var groups []shardGroup
+	seen := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		dbIdx, tblIdx := s.topo.RouteByUserKey(id)
+		key := [2]int{dbIdx, tblIdx}
+		i, ok := idx[key]
+		if !ok {
+			i = len(groups)
+			idx[key] = i
+			groups = append(groups, shardGroup{dbIndex: dbIdx, db: s.dbs[dbIdx], table: shardTableName(base, tblIdx)})
+		}
+		groups[i].userIDs = append(groups[i].userIDs, id)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].dbIndex != groups[j].dbIndex {
+			return groups[i].dbIndex < groups[j].dbIndex
+		}
+		return groups[i].table < groups[j].table
+	})
+	return groups
+}
+
+// all 列出全部分表，用于无法按用户路由的扫描
+func (s userShards) all(base string) []shardGroup {
+	groups := make([]shardGroup, 0, len(s.dbs)*s.topo.TableCount)
+	for dbIdx, db := range s.dbs {
+		for tblIdx := 0; tblIdx < s.topo.TableCount; tblIdx++ {
+			groups = append(groups, shardGroup{dbIndex: dbIdx, db: db, table: shardTableName(base, tblIdx)})
+		}
+	}
+	return groups
+}
+
+// shardIndex 分表上的索引。同一个库的多张分表不能共用模型里 idx_follow_pair 这类固定索引名，
+// 因此分表只按列定义建表，索引以表名为前缀另建
+type shardIndex struct {
+	suffix  string
+	unique  bool
+	columns string
+}
+
+// migrateShardTable 建分表：columns 是不带索引标签的列定义，与对应模型的列保持一致
+func migrateShardTable(db *gorm.DB, table string, columns interface{}, indexes []shardIndex) error {
+	if err := db.Table(table).AutoMigrate(columns); err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		unique := ""
+		if idx.unique {
+			unique = "UNIQUE "
+		}
+		sql := fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s_%s ON %s (%s)", unique, table, idx.suffix, table, idx.columns)
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateShardTables 在每个库上建 topo.TableCount 张分表
+func (s userShards) migrateShardTables(base string, columns interface{}, indexes []shardIndex) error {
+	for _, g := range s.all(base) {
+		if err := migrateShardTable(g.db, g.table, columns, indexes); err != nil {
+			return fmt.Errorf("failed to migrate table %s in db %d: %w", g.table, g.dbIndex, err)
+		}
+	}
+	return nil
+}
+
+// followShardColumns 分表 follows_N 的列，与 model.Follow 一致
+type followShardColumns struct {
+	ID         string `gorm:"primaryKey;type:varchar(36)"`
+	FollowerID string `gorm:"type:varchar(36);not null"`
+	FolloweeID string `gorm:"type:varchar(36);not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+var followShardIndexes = []shardIndex{
+	{suffix: "pair", unique: true, columns: "follower_id, followee_id"},
+	{suffix: "follower_seek", columns: "follower_id, created_at, id"},
+}
+
+// fanShardColumns 分表 fans_N 的列，与 model.Fan 一致
+type fanShardColumns struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	UserID    string `gorm:"type:varchar(36);not null"`
+	FanID     string `gorm:"type:varchar(36);not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+var fanShardIndexes = []shardIndex{
+	{suffix: "pair", unique: true, columns: "user_id, fan_id"},
+	{suffix: "user_seek", columns: "user_id, created_at, id"},
+}
+
+// seekPage 按 (created_at, id) 升序 seek 分页，多取一条判断是否还有下一页；语义同单库的 ListXxxAfter
+func seekPage[T any](q *gorm.DB, after, upTo *Cursor, limit int, cursorOf func(T) *Cursor) ([]T, *Cursor, error) {
+	if after != nil {
+		q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+	}
+	if upTo != nil {
+		q = q.Where("(created_at, id) <= (?, ?)", upTo.CreatedAt, upTo.ID)
+	}
+	var res []T
+	if err := q.Order("created_at ASC, id ASC").Limit(limit + 1).Find(&res).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(res) <= limit {
+		return res, nil, nil
+	}
+	res = res[:limit]
+	return res, cursorOf(res[limit-1]), nil
+}
+
+func followCursor(f *model.Follow) *Cursor { return &Cursor{CreatedAt: f.CreatedAt, ID: f.ID} }
+
+func fanCursor(f *model.Fan) *Cursor { return &Cursor{CreatedAt: f.CreatedAt, ID: f.ID} }
+
+// ShardedFollowRepository 分库分表关注仓储，按 follower_id 路由
+type ShardedFollowRepository struct {
+	shards userShards
+}
+
+// NewShardedFollowRepository 创建分库分表关注仓储，库数取 len(dbs)，每库 tablesPerDB 张表
+func NewShardedFollowRepository(dbs []*gorm.DB, tablesPerDB int) (FollowRepository, error) {
+	shards, err := newUserShards(dbs, tablesPerDB)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedFollowRepository{shards: shards}, nil
+}
+
+// Create 在关注者所在库的事务内写入关注、事件与关注数；blocks 不在分库上，拉黑由服务层 Follow 前置检查
+func (r *ShardedFollowRepository) Create(ctx context.Context, followerID, followeeID string) error {
+	db, table := r.shards.route(followerID, "follows")
+	f := &model.Follow{ID: uuid.New().String(), FollowerID: followerID, FolloweeID: followeeID}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(f)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := incrRelationCount(tx, followerID, "following_count", 1); err != nil {
+			return err
+		}
+		return tx.Create(newRelationEvent(model.RelationEventAdd, followeeID, followerID)).Error
+	})
+}
+
+// Delete 在关注者所在库的事务内删除关注并写入 remove 事件、扣减关注数
+func (r *ShardedFollowRepository) Delete(ctx context.Context, followerID, followeeID string) error {
+	db, table := r.shards.route(followerID, "follows")
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(table).Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&model.Follow{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := incrRelationCount(tx, followerID, "following_count", -1); err != nil {
+			return err
+		}
+		return tx.Create(newRelationEvent(model.RelationEventRemove, followeeID, followerID)).Error
+	})
+}
+
+func (r *ShardedFollowRepository) Exists(ctx context.Context, followerID, followeeID string) (bool, error) {
+	var cnt int64
+	if err := r.shards.table(ctx, followerID, "follows").
+		Where("follower_id = ? AND followee_id = ?", followerID, followeeID).
+		Count(&cnt).Error; err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+func (r *ShardedFollowRepository) ListFollowings(ctx context.Context, followerID string, offset, limit int) ([]*model.Follow, error) {
+	var res []*model.Follow
+	err := r.shards.table(ctx, followerID, "follows").
+		Where("follower_id = ?", followerID).
+		Offset(offset).Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (r *ShardedFollowRepository) ListFollowingsAfter(ctx context.Context, followerID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error) {
+	q := r.shards.table(ctx, followerID, "follows").Where("follower_id = ?", followerID)
+	return seekPage(q, after, nil, limit, followCursor)
+}
+
+func (r *ShardedFollowRepository) ListRecentFollowees(ctx context.Context, followerID string, limit int) ([]string, error) {
+	var res []string
+	err := r.shards.table(ctx, followerID, "follows").
+		Where("follower_id = ?", followerID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Pluck("followee_id", &res).Error
+	return res, err
+}
+
+// ListBetween 出边在 userID 所在分表；入边按 targets 所在分表分组查询
+func (r *ShardedFollowRepository) ListBetween(ctx context.Context, userID string, targets []string) ([]*model.Follow, error) {
+	var res []*model.Follow
+	if len(targets) == 0 {
+		return res, nil
+	}
+	if err := r.shards.table(ctx, userID, "follows").
+		Where("follower_id = ? AND followee_id IN ?", userID, targets).
+		Find(&res).Error; err != nil {
+		return nil, err
+	}
+	in, err := r.listFollowingTo(ctx, userID, targets)
+	if err != nil {
+		return nil, err
+	}
+	return append(res, in...), nil
+}
+
+// listFollowingTo followerIDs 中关注了 userID 的那些关注边
+func (r *ShardedFollowRepository) listFollowingTo(ctx context.Context, userID string, followerIDs []string) ([]*model.Follow, error) {
+	var res []*model.Follow
+	for _, g := range r.shards.group("follows", followerIDs) {
+		var part []*model.Follow
+		if err := g.db.WithContext(ctx).Table(g.table).
+			Where("follower_id IN ? AND followee_id = ?", g.userIDs, userID).
+			Find(&part).Error; err != nil {
+			return nil, err
+		}
+		res = append(res, part...)
+	}
+	return res, nil
+}
+
+// ListCommonFollowings 按 followee_id 顺序分批扫描 a 的关注，到 b 所在分表点查
+func (r *ShardedFollowRepository) ListCommonFollowings(ctx context.Context, a, b string, limit int) ([]string, error) {
+	res := []string{}
+	after := ""
+	for len(res) < limit {
+		var batch []string
+		if err := r.shards.table(ctx, a, "follows").
+			Where("follower_id = ? AND followee_id > ?", a, after).
+			Order("followee_id").
+			Limit(shardScanBatch).
+			Pluck("followee_id", &batch).Error; err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		after = batch[len(batch)-1]
+
+		var common []string
+		if err := r.shards.table(ctx, b, "follows").
+			Where("follower_id = ? AND followee_id IN ?", b, batch).
+			Order("followee_id").
+			Pluck("followee_id", &common).Error; err != nil {
+			return nil, err
+		}
+		res = append(res, common...)
+		if len(batch) < shardScanBatch {
+			break
+		}
+	}
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// ListFriendsAfter 按 userID 的关注顺序分批扫描，到各被关注者所在分表确认回关。
+// 每次调用至多扫描 maxFriendScanBatches 批关注，互关稀疏时返回的页可能不足 limit（甚至为空），游标指向扫描到的位置
+func (r *ShardedFollowRepository) ListFriendsAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Follow, *Cursor, error) {
+	var res []*model.Follow
+	for batch := 0; len(res) <= limit; batch++ {
+		if batch == maxFriendScanBatches {
+			return res, after, nil
+		}
+		page, next, err := r.ListFollowingsAfter(ctx, userID, after, shardScanBatch)
+		if err != nil {
+			return nil, nil, err
+		}
+		followees := make([]string, len(page))
+		for i, f := range page {
+			followees[i] = f.FolloweeID
+		}
+		back, err := r.listFollowingTo(ctx, userID, followees)
+		if err != nil {
+			return nil, nil, err
+		}
+		mutual := make(map[string]struct{}, len(back))
+		for _, f := range back {
+			mutual[f.FollowerID] = struct{}{}
+		}
+		for _, f := range page {
+			if _, ok := mutual[f.FolloweeID]; ok {
+				res = append(res, f)
+			}
+		}
+		if next == nil {
+			return res, nil, nil
+		}
+		after = next
+	}
+	res = res[:limit]
+	return res, followCursor(res[limit-1]), nil
+}
+
+// ListSecondDegree 一度关系在 userID 所在分表，二度关注按来源所在分表分组聚合后在内存中合并，
+// 再按重合度分批过滤已关注者，语义同单库实现
+func (r *ShardedFollowRepository) ListSecondDegree(ctx context.Context, userID string, maxSources, perSource, limit int) ([]*FollowOverlap, error) {
+	var sources []string
+	if err := r.shards.table(ctx, userID, "follows").
+		Where("follower_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(maxSources).
+		Pluck("followee_id", &sources).Error; err != nil {
+		return nil, err
+	}
+
+	overlap := make(map[string]int64)
+	for _, g := range r.shards.group("follows", sources) {
+		if err := countRecentFollowees(g.db.WithContext(ctx), g.table, g.userIDs, perSource, overlap); err != nil {
+			return nil, err
+		}
+	}
+	return topUnfollowed(overlap, userID, limit, func() *gorm.DB { return r.shards.table(ctx, userID, "follows") })
+}
+
+// InitSchema 初始化所有分片的 follows 分表，以及每个库的 relation_events / relation_counts
+func (r *ShardedFollowRepository) InitSchema() error {
+	for dbIdx, db := range r.shards.dbs {
+		if err := db.AutoMigrate(&model.RelationEvent{}, &model.RelationCount{}); err != nil {
+			return fmt.Errorf("failed to migrate relation tables in db %d: %w", dbIdx, err)
+		}
+	}
+	return r.shards.migrateShardTables("follows", &followShardColumns{}, followShardIndexes)
+}
+
+// ShardedFanRepository 分库分表粉丝仓储，按 user_id 路由
+type ShardedFanRepository struct {
+	shards userShards
+}
+
+// NewShardedFanRepository 创建分库分表粉丝仓储，dbs 与 ShardedFollowRepository 使用同一组库
+func NewShardedFanRepository(dbs []*gorm.DB, tablesPerDB int) (FanRepository, error) {
+	shards, err := newUserShards(dbs, tablesPerDB)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedFanRepository{shards: shards}, nil
+}
+
+// Create 幂等写入粉丝关系；真正插入时同事务累加粉丝数
+func (r *ShardedFanRepository) Create(ctx context.Context, userID, fanID string) error {
+	db, table := r.shards.route(userID, "fans")
+	f := &model.Fan{ID: uuid.New().String(), UserID: userID, FanID: fanID}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(f)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return incrRelationCount(tx, userID, "follower_count", 1)
+	})
+}
+
+// Delete 删除粉丝关系；真正删除时同事务扣减粉丝数
+func (r *ShardedFanRepository) Delete(ctx context.Context, userID, fanID string) error {
+	db, table := r.shards.route(userID, "fans")
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(table).Where("user_id = ? AND fan_id = ?", userID, fanID).Delete(&model.Fan{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return incrRelationCount(tx, userID, "follower_count", -1)
+	})
+}
+
+func (r *ShardedFanRepository) ListFans(ctx context.Context, userID string, offset, limit int) ([]*model.Fan, error) {
+	var res []*model.Fan
+	err := r.shards.table(ctx, userID, "fans").
+		Where("user_id = ?", userID).
+		Offset(offset).Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
+func (r *ShardedFanRepository) ListFansAfter(ctx context.Context, userID string, after *Cursor, limit int) ([]*model.Fan, *Cursor, error) {
+	return r.ListFansRange(ctx, userID, after, nil, limit)
+}
+
+func (r *ShardedFanRepository) ListFansRange(ctx context.Context, userID string, after, upTo *Cursor, limit int) ([]*model.Fan, *Cursor, error) {
+	q := r.shards.table(ctx, userID, "fans").Where("user_id = ?", userID)
+	return seekPage(q, after, upTo, limit, fanCursor)
+}
+
+func (r *ShardedFanRepository) SplitPoints(ctx context.Context, userID string, step, maxPoints int) ([]*Cursor, error) {
+	var res []*Cursor
+	var after *Cursor
+	for len(res) < maxPoints {
+		q := r.shards.table(ctx, userID, "fans").Select("created_at, id").Where("user_id = ?", userID)
+		if after != nil {
+			q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+		}
+		var row struct {
+			CreatedAt time.Time
+			ID        string
+		}
+		tx := q.Order("created_at ASC, id ASC").Offset(step - 1).Limit(1).Scan(&row)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			break
+		}
+		after = &Cursor{CreatedAt: row.CreatedAt, ID: row.ID}
+		res = append(res, after)
+	}
+	return res, nil
+}
+
+func (r *ShardedFanRepository) CountFans(ctx context.Context, userID string) (int64, error) {
+	var cnt int64
+	err := r.shards.table(ctx, userID, "fans").Where("user_id = ?", userID).Count(&cnt).Error
+	return cnt, err
+}
+
+func (r *ShardedFanRepository) CountFansBatch(ctx context.Context, userIDs []string) (map[string]int64, error) {
+	res := make(map[string]int64, len(userIDs))
+	for _, g := range r.shards.group("fans", userIDs) {
+		part, err := countEdges(g.db.WithContext(ctx), g.table, "user_id", g.userIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id, cnt := range part {
+			res[id] = cnt
+		}
+	}
+	return res, nil
+}
+
+// InitSchema 初始化所有分片的 fans 分表，以及每个库的 relation_counts
+func (r *ShardedFanRepository) InitSchema() error {
+	for dbIdx, db := range r.shards.dbs {
+		if err := db.AutoMigrate(&model.RelationCount{}); err != nil {
+			return fmt.Errorf("failed to migrate relation_counts in db %d: %w", dbIdx, err)
+		}
+	}
+	return r.shards.migrateShardTables("fans", &fanShardColumns{}, fanShardIndexes)
+}
+
+// ShardedRelationCountRepository 分库后的计数仓储：用户计数与其关注、粉丝在同一个库
+type ShardedRelationCountRepository struct {
+	shards userShards
+}
+
+// NewShardedRelationCountRepository 创建分库计数仓储，dbs 与关注/粉丝仓储使用同一组库
+func NewShardedRelationCountRepository(dbs []*gorm.DB, tablesPerDB int) (RelationCountRepository, error) {
+	shards, err := newUserShards(dbs, tablesPerDB)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedRelationCountRepository{shards: shards}, nil
+}
+
+// byDB 按库对用户分组，按库序号排列
+func (r *ShardedRelationCountRepository) byDB(userIDs []string) [][]string {
+	res := make([][]string, len(r.shards.dbs))
+	for _, id := range userIDs {
+		dbIdx, _ := r.shards.topo.RouteByUserKey(id)
+		res[dbIdx] = append(res[dbIdx], id)
+	}
+	return res
+}
+
+func (r *ShardedRelationCountRepository) BatchGet(ctx context.Context, userIDs []string) (map[string]*model.RelationCount, error) {
+	res := make(map[string]*model.RelationCount, len(userIDs))
+	for dbIdx, ids := range r.byDB(userIDs) {
+		if len(ids) == 0 {
+			continue
+		}
+		part, err := batchGetCounts(r.shards.dbs[dbIdx].WithContext(ctx), ids)
+		if err != nil {
+			return nil, err
+		}
+		for id, row := range part {
+			res[id] = row
+		}
+	}
+	return res, nil
+}
+
+func (r *ShardedRelationCountRepository) Recompute(ctx context.Context, userIDs []string) ([]string, error) {
+	var changed []string
+	for dbIdx, ids := range r.byDB(userIDs) {
+		if len(ids) == 0 {
+			continue
+		}
+		part, err := recomputeCounts(r.shards.dbs[dbIdx].WithContext(ctx), ids, func(ids []string) (*recount, error) {
+			rc := &recount{following: make(map[string]int64), followers: make(map[string]int64), lagging: make(map[string]bool)}
+			// 关系事件写在关注者所在的库，被关注者的 pending 事件可能落在任意一个库
+			for _, db := range r.shards.dbs {
+				if err := pendingFollowerEvents(db.WithContext(ctx), ids, rc.lagging); err != nil {
+					return nil, err
+				}
+			}
+			for _, g := range r.shards.group("follows", ids) {
+				part, err := countEdges(g.db.WithContext(ctx), g.table, "follower_id", g.userIDs)
+				if err != nil {
+					return nil, err
+				}
+				for id, cnt := range part {
+					rc.following[id] = cnt
+				}
+			}
+			for _, g := range r.shards.group("fans", ids) {
+				part, err := countEdges(g.db.WithContext(ctx), g.table, "user_id", g.userIDs)
+				if err != nil {
+					return nil, err
+				}
+				for id, cnt := range part {
+					rc.followers[id] = cnt
+				}
+			}
+			return rc, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, part...)
+	}
+	return changed, nil
+}
@@ -18,7 +18,7 @@ func setupRelBenchDB(b *testing.B) *gorm.DB {
     if err != nil {
         b.Fatalf("open db: %v", err)
     }
-    if err := db.AutoMigrate(&model.User{}, &model.Follow{}, &model.Fan{}); err != nil {
+    if err := db.AutoMigrate(&model.User{}, &model.Follow{}, &model.Block{}, &model.Fan{}, &model.RelationEvent{}, &model.RelationCount{}); err != nil {
         b.Fatalf("migrate: %v", err)
     }
     return db
@@ -77,4 +77,23 @@ func BenchmarkQueryFansAndFollowing(b *testing.B) {
             _, _ = followRepo.ListFollowings(ctx, u0.ID, 0, 50)
         }
     })
+
+    // 深分页：offset 需要跳过前面所有行，seek 游标直接定位
+    b.Run("ListFans_DeepOffset", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            _, _ = fanRepo.ListFans(ctx, u0.ID, N-50, 50)
+        }
+    })
+
+    var deep *Cursor
+    for {
+        _, next, err := fanRepo.ListFansAfter(ctx, u0.ID, deep, 500)
+        if err != nil || next == nil { break }
+        deep = next
+    }
+    b.Run("ListFans_DeepCursor", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            _, _, _ = fanRepo.ListFansAfter(ctx, u0.ID, deep, 50)
+        }
+    })
 }
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const (
+	defaultMigrateBatchSize = 1000
+	defaultVerifyAttempts   = 5
+	verifyRetryInterval     = 200 * time.Millisecond
+)
+
+// BucketMigrationReport 单个桶的迁移结果（cmd/reshard 直接输出为 JSON）
+type BucketMigrationReport struct {
+	Bucket int `json:"bucket"`
+	From   int `json:"from"`
+	To     int `json:"to"`
+	// Resumed 从上次中断的阶段继续
+	Resumed        bool      `json:"resumed"`
+	Copied         int64     `json:"copied"`
+	SourceRows     int64     `json:"source_rows"`
+	TargetRows     int64     `json:"target_rows"`
+	SourceChecksum string    `json:"source_checksum"`
+	TargetChecksum string    `json:"target_checksum"`
+	Purged         int64     `json:"purged"`
+	StartedAt      time.Time `json:"started_at"`
+	DurationMs     int64     `json:"duration_ms"`
+}
+
+// BucketMigrator 在线迁移单个虚拟桶：
+//  1. 映射置为 {src, dst}，所有进程开始双写；
+//  2. 按 order_id 顺序把源库的行幂等复制到目标库；
+//  3. 比对两边的行数与校验和，不一致时重新复制再比对；
+//  4. 映射置为 {dst, src}，读切到目标库，仍双写以兼容尚未刷新映射的进程；
+//  5. 映射置为 {dst, nil}，清理源库中该桶的行。
+//
+// 每次修改映射后等待 grace，grace 应大于各进程刷新映射的间隔。中途失败可用相同参数重跑，从当前阶段继续
+type BucketMigrator struct {
+	repo           *repository.BucketedOrderRepository
+	grace          time.Duration
+	batchSize      int
+	verifyAttempts int
+}
+
+func NewBucketMigrator(repo *repository.BucketedOrderRepository, grace time.Duration, batchSize int) *BucketMigrator {
+	if batchSize <= 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+	return &BucketMigrator{repo: repo, grace: grace, batchSize: batchSize, verifyAttempts: defaultVerifyAttempts}
+}
+
+// Migrate 把 bucket 迁移到 target 库
+func (m *BucketMigrator) Migrate(ctx context.Context, bucket, target int) (*BucketMigrationReport, error) {
+	router := m.repo.Router()
+	if bucket < 0 || bucket >= router.Buckets() {
+		return nil, fmt.Errorf("bucket %d out of range [0, %d)", bucket, router.Buckets())
+	}
+	if target < 0 || target >= router.DBCount() {
+		return nil, fmt.Errorf("target database %d out of range [0, %d)", target, router.DBCount())
+	}
+	report := &BucketMigrationReport{Bucket: bucket, To: target, StartedAt: time.Now()}
+	defer func() { report.DurationMs = time.Since(report.StartedAt).Milliseconds() }()
+
+	cur, err := router.LoadBucket(ctx, bucket)
+	if err != nil {
+		return report, err
+	}
+	switch {
+	case cur.ShadowDB == nil && cur.DBIndex == target:
+		return report, fmt.Errorf("bucket %d is already on database %d", bucket, target)
+	case cur.ShadowDB == nil:
+		// 开始双写
+		report.From = cur.DBIndex
+		if err := router.UpdateBucket(ctx, cur, cur.DBIndex, &target); err != nil {
+			return report, err
+		}
+		logger.Info("bucket dual-write started", zap.Int("bucket", bucket), zap.Int("from", report.From), zap.Int("to", target))
+		if err := m.wait(ctx); err != nil {
+			return report, err
+		}
+	case *cur.ShadowDB == target:
+		// 上次在复制或校验阶段中断
+		report.From, report.Resumed = cur.DBIndex, true
+	case cur.DBIndex == target:
+		// 上次已切换读，只差收尾
+		report.From, report.Resumed = *cur.ShadowDB, true
+		return report, m.finish(ctx, cur, report)
+	default:
+		return report, fmt.Errorf("bucket %d is being migrated from %d to %d", bucket, cur.DBIndex, *cur.ShadowDB)
+	}
+
+	if err := m.copyAndVerify(ctx, report); err != nil {
+		return report, err
+	}
+
+	// 切换读，保留源库为影子
+	src := report.From
+	if err := router.UpdateBucket(ctx, cur, target, &src); err != nil {
+		return report, err
+	}
+	logger.Info("bucket flipped", zap.Int("bucket", bucket), zap.Int("from", src), zap.Int("to", target))
+	if err := m.wait(ctx); err != nil {
+		return report, err
+	}
+	return report, m.finish(ctx, cur, report)
+}
+
+func (m *BucketMigrator) copy(ctx context.Context, report *BucketMigrationReport) error {
+	var after int64 = -1
+	for {
+		n, last, err := m.repo.CopyBucket(ctx, report.Bucket, report.From, report.To, after, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("copy bucket %d: %w", report.Bucket, err)
+		}
+		report.Copied += int64(n)
+		if n < m.batchSize {
+			return nil
+		}
+		after = last
+	}
+}
+
+// copyAndVerify 复制后比对两边的行数与校验和。复制读到的行可能早于并发双写的更新、覆盖掉目标库的新值，
+// 比对也可能恰好落在双写的两次写入之间，因此不一致时重新复制再比对，至多 verifyAttempts 轮
+func (m *BucketMigrator) copyAndVerify(ctx context.Context, report *BucketMigrationReport) error {
+	for attempt := 1; ; attempt++ {
+		if err := m.copy(ctx, report); err != nil {
+			return err
+		}
+		srcSum, dstSum, err := m.repo.CompareBucket(ctx, report.Bucket, report.From, report.To, m.batchSize)
+		if err != nil {
+			return err
+		}
+		report.SourceRows, report.TargetRows = srcSum.Rows, dstSum.Rows
+		report.SourceChecksum = strconv.FormatUint(srcSum.Sum, 16)
+		report.TargetChecksum = strconv.FormatUint(dstSum.Sum, 16)
+		if srcSum == dstSum {
+			return nil
+		}
+		if attempt >= m.verifyAttempts {
+			return fmt.Errorf("bucket %d verification failed: source %d rows (%s), target %d rows (%s)",
+				report.Bucket, srcSum.Rows, report.SourceChecksum, dstSum.Rows, report.TargetChecksum)
+		}
+		logger.Warn("bucket verification mismatch, copying again", zap.Int("bucket", report.Bucket),
+			zap.Int64("source_rows", srcSum.Rows), zap.Int64("target_rows", dstSum.Rows))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyRetryInterval):
+		}
+	}
+}
+
+// finish 停止双写，待各进程刷新映射后清理源库中该桶的行
+func (m *BucketMigrator) finish(ctx context.Context, cur *model.ShardBucket, report *BucketMigrationReport) error {
+	if err := m.repo.Router().UpdateBucket(ctx, cur, report.To, nil); err != nil {
+		return err
+	}
+	logger.Info("bucket dual-write stopped", zap.Int("bucket", report.Bucket), zap.Int("to", report.To))
+	if err := m.wait(ctx); err != nil {
+		return err
+	}
+	purged, err := m.purge(ctx, report.Bucket, report.From)
+	report.Purged = purged
+	return err
+}
+
+// Abort 停止双写并清理影子库中该桶的行：切换读之前调用即放弃迁移（清理目标库中已复制的行），
+// 切换读之后主库已是目标库，调用等同于完成迁移
+func (m *BucketMigrator) Abort(ctx context.Context, bucket int) (*BucketMigrationReport, error) {
+	report := &BucketMigrationReport{Bucket: bucket, StartedAt: time.Now()}
+	defer func() { report.DurationMs = time.Since(report.StartedAt).Milliseconds() }()
+
+	cur, err := m.repo.Router().LoadBucket(ctx, bucket)
+	if err != nil {
+		return report, err
+	}
+	if cur.ShadowDB == nil {
+		return report, fmt.Errorf("bucket %d is not being migrated", bucket)
+	}
+	report.From, report.To = cur.DBIndex, *cur.ShadowDB
+	if err := m.repo.Router().UpdateBucket(ctx, cur, cur.DBIndex, nil); err != nil {
+		return report, err
+	}
+	logger.Info("bucket migration aborted", zap.Int("bucket", bucket), zap.Int("from", report.From), zap.Int("to", report.To))
+	if err := m.wait(ctx); err != nil {
+		return report, err
+	}
+	purged, err := m.purge(ctx, bucket, report.To)
+	report.Purged = purged
+	return report, err
+}
+
+func (m *BucketMigrator) purge(ctx context.Context, bucket, dbIdx int) (int64, error) {
+	var total int64
+	for {
+		n, err := m.repo.PurgeBucket(ctx, bucket, dbIdx, m.batchSize)
+		if err != nil {
+			return total, fmt.Errorf("purge bucket %d on database %d: %w", bucket, dbIdx, err)
+		}
+		total += n
+		if n < int64(m.batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// wait 等待各进程刷新映射
+func (m *BucketMigrator) wait(ctx context.Context) error {
+	if m.grace <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.grace):
+		return nil
+	}
+}
+
+// StartBucketRefresh 定期重新加载桶映射，使迁移工具的切换在 interval 内对本进程生效；返回停止函数
+func StartBucketRefresh(router *repository.BucketRouter, interval time.Duration) func(context.Context) error {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := router.Reload(context.Background()); err != nil {
+					logger.Error("reload shard buckets failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return func(ctx context.Context) error {
+		close(stop)
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+const (
+	migrateBuckets     = 8
+	migrateTablesPerDB = 2
+)
+
+func openMemoryDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// 内存库随连接存在，固定单连接
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+// setupBucketMigration 先以 2 个库初始化映射并写入数据，再加入第 3 个空库，模拟扩容
+func setupBucketMigration(t *testing.T, orders int64) ([]*gorm.DB, *repository.BucketedOrderRepository) {
+	ctx := context.Background()
+	meta := openMemoryDB(t)
+	dbs := []*gorm.DB{openMemoryDB(t), openMemoryDB(t)}
+	router, err := repository.NewBucketRouter(meta, migrateBuckets, len(dbs), migrateTablesPerDB)
+	require.NoError(t, err)
+	require.NoError(t, router.InitSchema(ctx))
+	repo, err := repository.NewBucketedOrderRepository(dbs, router)
+	require.NoError(t, err)
+	require.NoError(t, repo.(*repository.BucketedOrderRepository).InitSchema())
+	base := time.Now().Add(-time.Hour)
+	for i := int64(0); i < orders; i++ {
+		require.NoError(t, repo.Create(ctx, &model.Order{OrderID: i, UserID: i, Amount: float64(i), CreatedAt: base.Add(time.Duration(i) * time.Millisecond)}))
+	}
+
+	dbs = append(dbs, openMemoryDB(t))
+	router, err = repository.NewBucketRouter(meta, migrateBuckets, len(dbs), migrateTablesPerDB)
+	require.NoError(t, err)
+	require.NoError(t, router.Reload(ctx))
+	repo, err = repository.NewBucketedOrderRepository(dbs, router)
+	require.NoError(t, err)
+	bucketed := repo.(*repository.BucketedOrderRepository)
+	require.NoError(t, bucketed.InitSchema())
+	return dbs, bucketed
+}
+
+func countBucket(t *testing.T, db *gorm.DB, bucket int) int64 {
+	var cnt int64
+	require.NoError(t, db.Table(fmt.Sprintf("orders_%d", bucket*migrateTablesPerDB/migrateBuckets)).
+		Where("order_id % ? = ?", migrateBuckets, bucket).Count(&cnt).Error)
+	return cnt
+}
+
+func TestBucketMigratorMovesBucketUnderWrites(t *testing.T) {
+	dbs, repo := setupBucketMigration(t, 400)
+	migrator := NewBucketMigrator(repo, 20*time.Millisecond, 7)
+	ctx := context.Background()
+
+	// 迁移期间持续为用户 3 下单（订单落在桶 3），并更新桶 3 的已有订单
+	var (
+		wg      sync.WaitGroup
+		stop    atomic.Bool
+		created atomic.Int64
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		gen, err := repository.NewOrderIDGenerator(0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for n := int64(0); !stop.Load(); n++ {
+			id, err := gen.Next(3)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if assert.NoError(t, repo.Create(ctx, &model.Order{OrderID: id, UserID: 3, Amount: 1})) {
+				created.Add(1)
+			}
+			assert.NoError(t, repo.UpdateStatus(ctx, 3+n%50*migrateBuckets, model.OrderStatusShipped))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	report, err := migrator.Migrate(ctx, 3, 2)
+	stop.Store(true)
+	wg.Wait()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.From)
+	assert.False(t, report.Resumed)
+	assert.Equal(t, report.SourceRows, report.TargetRows)
+	assert.Equal(t, report.SourceChecksum, report.TargetChecksum)
+	assert.GreaterOrEqual(t, report.Purged, int64(50))
+	primary, shadow := repo.Router().Route(3)
+	assert.Equal(t, 2, primary)
+	assert.Equal(t, -1, shadow)
+
+	// 源库已清理，数据全部在新库可读
+	assert.Zero(t, countBucket(t, dbs[1], 3))
+	assert.Equal(t, 50+created.Load(), countBucket(t, dbs[2], 3))
+	cnt, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 400+created.Load(), cnt)
+	order, err := repo.GetByOrderID(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int8(model.OrderStatusShipped), order.Status)
+
+	_, err = migrator.Migrate(ctx, 3, 2)
+	assert.Error(t, err)
+}
+
+func TestBucketMigratorResumesAndAborts(t *testing.T) {
+	dbs, repo := setupBucketMigration(t, 80)
+	migrator := NewBucketMigrator(repo, 0, 100)
+	router := repo.Router()
+	ctx := context.Background()
+
+	// 模拟上次在切换读之后中断：映射为 {dst, src}，两边都有数据
+	cur, err := router.LoadBucket(ctx, 1)
+	require.NoError(t, err)
+	src := cur.DBIndex
+	dst := 2
+	_, _, err = repo.CopyBucket(ctx, 1, src, dst, -1, 100)
+	require.NoError(t, err)
+	require.NoError(t, router.UpdateBucket(ctx, cur, dst, &src))
+
+	report, err := migrator.Migrate(ctx, 1, dst)
+	require.NoError(t, err)
+	assert.True(t, report.Resumed)
+	assert.Equal(t, int64(10), report.Purged)
+	assert.Zero(t, countBucket(t, dbs[src], 1))
+
+	// 复制阶段放弃：停止双写并清理目标库
+	cur, err = router.LoadBucket(ctx, 4)
+	require.NoError(t, err)
+	require.NoError(t, router.UpdateBucket(ctx, cur, cur.DBIndex, &dst))
+	_, _, err = repo.CopyBucket(ctx, 4, cur.DBIndex, dst, -1, 100)
+	require.NoError(t, err)
+	report, err = migrator.Abort(ctx, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), report.Purged)
+	assert.Zero(t, countBucket(t, dbs[dst], 4))
+	assert.Equal(t, int64(10), countBucket(t, dbs[cur.DBIndex], 4))
+	_, err = migrator.Abort(ctx, 4)
+	assert.Error(t, err)
+
+	cnt, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), cnt)
+}
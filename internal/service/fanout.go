@@ -2,25 +2,57 @@ package service
 
 import (
     "context"
+    "errors"
+    "sync"
     "time"
 
     "github.com/google/uuid"
+    "go.uber.org/zap"
     "gorm.io/gorm"
-    "gorm.io/gorm/clause"
 
     "github.com/d60-Lab/gin-template/internal/model"
     "github.com/d60-Lab/gin-template/internal/repository"
+    "github.com/d60-Lab/gin-template/pkg/idgen"
+    "github.com/d60-Lab/gin-template/pkg/logger"
 )
 
-// FanoutWorker 从 outbox 拉取事件并写入 inbox（仅本地基准模拟）
+const (
+    defaultFanoutLease       = time.Minute
+    defaultFanoutMaxAttempts = 8
+    fanoutBaseBackoff        = 2 * time.Second
+    fanoutMaxBackoff         = 10 * time.Minute
+    // maxFanoutShards 单条 outbox 最多切分的分片数
+    maxFanoutShards = 64
+)
+
+// FanoutWorker 从 outbox 拉取事件并写入 inbox。
+// 领取时设置租约，worker 崩溃后过期的 processing 行由 reaper 放回 pending；失败按指数退避重试，超过次数置为 failed。
+// 每写一页 inbox 都与断点同事务提交，重新领取时从断点继续；粉丝很多的作者可切分为多个分片由多个 worker 并行处理。
 type FanoutWorker struct {
-    db           *gorm.DB
+    outbox       repository.OutboxRepository
+    shards       repository.FanoutShardRepository
     fanRepo      repository.FanRepository
+    countRepo    repository.RelationCountRepository
+    posts        repository.PostRepository
+    inbox        repository.InboxRepository
     batchSize    int
     claimLimit   int
     pollInterval time.Duration
     workers      int
     metricsCh    chan time.Duration // outbox->processed latency
+    wakeCh       chan struct{}
+    lease        time.Duration
+    maxAttempts  int
+    // celebrityThreshold 粉丝数 >= 该值的作者走拉模式（不写 inbox），0 表示全部推送
+    celebrityThreshold int64
+    // muteRepo 非空时跳过屏蔽了作者的粉丝
+    muteRepo repository.MuteRepository
+    // timelineCache 非空时每页 inbox 提交后写穿到已缓存的时间线
+    timelineCache *TimelineCache
+    // shardSize 粉丝数超过该值的 outbox 切分为每片约 shardSize 个粉丝的分片，0 表示不切分
+    shardSize int
+    // ids 非空时 inbox 行 ID 按时间递增，否则为 uuid
+    ids *idgen.Generator
 }
 
 func NewFanoutWorker(db *gorm.DB, fanRepo repository.FanRepository, workers, batchSize, claimLimit int, pollInterval time.Duration) *FanoutWorker {
@@ -28,18 +60,108 @@ func NewFanoutWorker(db *gorm.DB, fanRepo repository.FanRepository, workers, bat
     if batchSize <= 0 { batchSize = 500 }
     if claimLimit <= 0 { claimLimit = 128 }
     if pollInterval <= 0 { pollInterval = 50 * time.Millisecond }
-    return &FanoutWorker{db: db, fanRepo: fanRepo, workers: workers, batchSize: batchSize, claimLimit: claimLimit, pollInterval: pollInterval, metricsCh: make(chan time.Duration, 65536)}
+    return &FanoutWorker{
+        outbox: repository.NewOutboxRepository(db), shards: repository.NewFanoutShardRepository(db), fanRepo: fanRepo,
+        countRepo: repository.NewRelationCountRepository(db),
+        posts: repository.NewPostRepository(db), inbox: repository.NewInboxRepository(db),
+        workers: workers, batchSize: batchSize, claimLimit: claimLimit, pollInterval: pollInterval,
+        lease: defaultFanoutLease, maxAttempts: defaultFanoutMaxAttempts,
+        metricsCh: make(chan time.Duration, 65536),
+        wakeCh:    make(chan struct{}, workers),
+    }
+}
+
+// Notify 唤醒一个空闲 worker 立即领取（如收到 Postgres NOTIFY）；丢失也无妨，轮询会兜底。
+func (w *FanoutWorker) Notify() {
+    select {
+    case w.wakeCh <- struct{}{}:
+    default:
+    }
 }
 
 func (w *FanoutWorker) Metrics() <-chan time.Duration { return w.metricsCh }
 
+// WithCelebrityThreshold 设置推拉结合的粉丝数阈值（需在 Start 前调用）。
+func (w *FanoutWorker) WithCelebrityThreshold(n int64) *FanoutWorker {
+    w.celebrityThreshold = n
+    return w
+}
+
+// WithRetryPolicy 设置最大尝试次数与处理租约（需在 Start 前调用），非正数保持默认值。
+// lease 需大于单条 outbox 的最长扇出耗时，否则仍在处理的行会被重复领取。
+func (w *FanoutWorker) WithRetryPolicy(maxAttempts int, lease time.Duration) *FanoutWorker {
+    if maxAttempts > 0 { w.maxAttempts = maxAttempts }
+    if lease > 0 { w.lease = lease }
+    return w
+}
+
+// WithSharding 设置分片大小（需在 Start 前调用）：粉丝数超过 shardSize 的作者按粉丝区间切分，
+// 分片数封顶 maxFanoutShards；0 表示不切分。
+func (w *FanoutWorker) WithSharding(shardSize int) *FanoutWorker {
+    w.shardSize = shardSize
+    return w
+}
+
+// WithMutes 设置屏蔽列表（需在 Start 前调用），屏蔽了作者的粉丝不写 inbox。
+func (w *FanoutWorker) WithMutes(muteRepo repository.MuteRepository) *FanoutWorker {
+    w.muteRepo = muteRepo
+    return w
+}
+
+// WithTimelineCache 设置时间线缓存（需在 Start 前调用），扇出写入的 inbox 同步写入已缓存用户的 ZSET。
+func (w *FanoutWorker) WithTimelineCache(cache *TimelineCache) *FanoutWorker {
+    w.timelineCache = cache
+    return w
+}
+
+// WithIDGenerator inbox 行 ID 改用分布式 ID 生成器（需在 Start 前调用）。
+func (w *FanoutWorker) WithIDGenerator(ids *idgen.Generator) *FanoutWorker {
+    w.ids = ids
+    return w
+}
+
+// mutedFans 返回本页粉丝中屏蔽了作者的那部分；查询失败时不过滤（读端还会再过滤一次）
+func (w *FanoutWorker) mutedFans(ctx context.Context, authorID string, fans []*model.Fan) map[string]struct{} {
+    if w.muteRepo == nil { return nil }
+    ids := make([]string, len(fans))
+    for i, f := range fans { ids[i] = f.FanID }
+    muted, err := w.muteRepo.ListMutedBy(ctx, authorID, ids)
+    if err != nil || len(muted) == 0 { return nil }
+    res := make(map[string]struct{}, len(muted))
+    for _, id := range muted { res[id] = struct{}{} }
+    return res
+}
+
+// isCelebrity 判断作者是否超过阈值（粉丝数取 relation_counts，与读端一致），超过则该作者的帖子由读端拉取。
+func (w *FanoutWorker) isCelebrity(ctx context.Context, authorID string) bool {
+    if w.celebrityThreshold <= 0 { return false }
+    celebs, err := filterCelebrities(ctx, w.countRepo, w.celebrityThreshold, []string{authorID})
+    if err != nil { return false }
+    return len(celebs) > 0
+}
+
 // Start 启动若干 worker 轮询处理 outbox；返回停止函数。
+// 停止函数会等待正在处理的批次结束，或直到 ctx 超时。
 func (w *FanoutWorker) Start() func(context.Context) error {
     stop := make(chan struct{})
+    var wg sync.WaitGroup
     for i := 0; i < w.workers; i++ {
-        go w.loop(stop)
+        wg.Add(1)
+        go func() { defer wg.Done(); w.loop(stop) }()
+    }
+    wg.Add(1)
+    go func() { defer wg.Done(); w.reapLoop(stop) }()
+    return func(ctx context.Context) error {
+        close(stop)
+        done := make(chan struct{})
+        go func() { wg.Wait(); close(done) }()
+        select {
+        case <-done:
+            return nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
     }
-    return func(ctx context.Context) error { close(stop); return nil }
 }
 
 func (w *FanoutWorker) loop(stop <-chan struct{}) {
@@ -50,63 +172,264 @@ func (w *FanoutWorker) loop(stop <-chan struct{}) {
         case <-stop:
             return
         case <-ticker.C:
-            _ = w.processOnce(context.Background())
+        case <-w.wakeCh:
+        }
+        // 一直处理到没有可领取的行为止，再回到等待
+        for {
+            n, err := w.processOnce(context.Background())
+            if err != nil {
+                logger.Warn("fanout claim failed", zap.Error(err))
+                break
+            }
+            if n == 0 { break }
+            select {
+            case <-stop:
+                return
+            default:
+            }
         }
     }
 }
 
-// processOnce: claim一批 pending outbox 并扇出
-func (w *FanoutWorker) processOnce(ctx context.Context) error {
-    // claim batch using SELECT ... FOR UPDATE SKIP LOCKED
-    type ob struct{ ID string; PostID string; AuthorID string; CreatedAt time.Time }
-    var batch []ob
-    err := w.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-        if err := tx.Raw(`
-            SELECT id, post_id, author_id, created_at
-            FROM outbox
-            WHERE status = 'pending'
-            ORDER BY created_at
-            LIMIT ?
-            FOR UPDATE SKIP LOCKED
-        `, w.claimLimit).Scan(&batch).Error; err != nil { return err }
-        if len(batch) == 0 { return nil }
-        ids := make([]string, len(batch))
-        for i, b := range batch { ids[i] = b.ID }
-        return tx.Model(&model.Outbox{}).Where("id IN ?", ids).Update("status", "processing").Error
-    })
-    if err != nil { return err }
-    if len(batch) == 0 { return nil }
-
-    // process each outbox
-    for _, b := range batch {
-        // fetch fans in pages
-        offset := 0
-        page := w.batchSize
-        totalWritten := int64(0)
-        for {
-            fans, err := w.fanRepo.ListFans(ctx, b.AuthorID, offset, page)
-            if err != nil { break }
-            if len(fans) == 0 { break }
-            records := make([]model.Inbox, 0, len(fans))
-            now := time.Now()
-            score := now.UnixNano()
-            for _, f := range fans {
-                records = append(records, model.Inbox{ID: uuid.New().String(), UserID: f.FanID, PostID: b.PostID, Score: score, CreatedAt: now})
+// reapLoop 定期回收租约过期的 processing 行
+func (w *FanoutWorker) reapLoop(stop <-chan struct{}) {
+    ticker := time.NewTicker(w.lease / 2)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            n, err := w.outbox.ReleaseExpired(context.Background(), w.maxAttempts)
+            if err != nil {
+                logger.Error("fanout release expired failed", zap.Error(err))
+            } else if n > 0 {
+                logger.Warn("fanout released expired claims", zap.Int64("rows", n))
+            }
+            if w.shardSize <= 0 { continue }
+            n, err = w.shards.ReleaseExpired(context.Background(), w.maxAttempts)
+            if err != nil {
+                logger.Error("fanout release expired shards failed", zap.Error(err))
+            } else if n > 0 {
+                logger.Warn("fanout released expired shards", zap.Int64("rows", n))
             }
-            // upsert ignore duplicates
-            _ = w.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
-            totalWritten += int64(len(records))
-            if len(fans) < page { break }
-            offset += page
         }
+    }
+}
+
+// processOnce: 领取一批 pending outbox 并逐条扇出；开启分片时再领取一批分片。返回领取的行数
+func (w *FanoutWorker) processOnce(ctx context.Context) (int, error) {
+    batch, err := w.outbox.Claim(ctx, w.claimLimit, w.lease)
+    if err != nil { return 0, err }
+    for _, b := range batch { w.handle(ctx, b) }
+    if w.shardSize <= 0 { return len(batch), nil }
+    shards, err := w.shards.Claim(ctx, w.claimLimit, w.lease)
+    if err != nil { return len(batch), err }
+    for _, sh := range shards { w.handleShard(ctx, sh) }
+    return len(batch) + len(shards), nil
+}
+
+// handle 扇出一条 outbox；失败按指数退避放回 pending，达到最大次数置为 failed。
+// 租约已丢失（行被回收后由其他 worker 领取或已结束）时放弃本次结果，不覆盖行状态
+func (w *FanoutWorker) handle(ctx context.Context, b *model.Outbox) {
+    err := w.fanoutOutbox(ctx, b)
+    if errors.Is(err, errFanoutSharded) { return }
+    if errors.Is(err, repository.ErrLeaseLost) {
+        logger.Warn("fanout outbox lease lost", zap.String("outbox", b.ID), zap.Int("attempts", b.Attempts))
+        return
+    }
+    if err != nil {
+        if b.Attempts >= w.maxAttempts {
+            logger.Error("fanout outbox failed",
+                zap.String("outbox", b.ID), zap.String("post", b.PostID), zap.Int("attempts", b.Attempts), zap.Error(err))
+            _ = w.outbox.MarkFailed(ctx, b.ID, b.Attempts, err.Error())
+            return
+        }
+        _ = w.outbox.MarkRetry(ctx, b.ID, b.Attempts, time.Now().Add(fanoutBackoff(b.Attempts)), err.Error())
+        return
+    }
+    if err := w.outbox.MarkDone(ctx, b.ID, b.Attempts); err != nil {
+        // 租约到期后会被重新领取并从断点继续；inbox 写入幂等，重复扇出无副作用
+        logger.Warn("fanout mark done failed", zap.String("outbox", b.ID), zap.Error(err))
+        return
+    }
+    w.recordLatency(b.CreatedAt)
+}
+
+// errFanoutSharded outbox 已交给分片处理，本次不需要标记完成
+var errFanoutSharded = errors.New("fanout sharded")
+
+func (w *FanoutWorker) fanoutOutbox(ctx context.Context, b *model.Outbox) error {
+    switch b.Kind {
+    case model.OutboxKindRetract:
+        return w.retract(ctx, b.PostID)
+    case model.OutboxKindEdit:
+        // inbox 只引用 post_id，编辑无需改写
+        return nil
+    }
+    // 大V走拉模式：不写 inbox，直接标记完成
+    if w.isCelebrity(ctx, b.AuthorID) { return nil }
+    sharded, err := w.split(ctx, b)
+    if err != nil { return err }
+    if sharded { return errFanoutSharded }
+    job := fanoutJob{
+        authorID: b.AuthorID,
+        postID:   b.PostID,
+        // score 取帖子发布时间，便于与拉模式的大V帖子合并排序
+        score: b.CreatedAt.UnixNano(),
+        after: checkpoint(b.CursorAt, b.CursorID),
+        save: func(ctx context.Context, records []model.Inbox, cursor *repository.Cursor) (int64, error) {
+            return w.outbox.SaveProgress(ctx, b.ID, b.Attempts, records, cursor)
+        },
+    }
+    return w.fanout(ctx, job)
+}
+
+// retract 分批删除引用已删除帖子的 inbox 行；删除幂等，失败重试时从头再删即可
+func (w *FanoutWorker) retract(ctx context.Context, postID string) error {
+    for {
+        n, err := w.inbox.DeleteByPost(ctx, postID, w.batchSize)
+        if err != nil { return err }
+        if n < int64(w.batchSize) { return nil }
+    }
+}
+
+// split 粉丝数超过 shardSize 时把 outbox 切分为分片，返回是否已交给分片处理。
+// 已切分过的（重新入队或崩溃恢复）只重置失败分片；已有断点的不再切分，直接从断点继续。
+func (w *FanoutWorker) split(ctx context.Context, b *model.Outbox) (bool, error) {
+    if w.shardSize <= 0 || b.CursorAt != nil { return false, nil }
+    existing, err := w.shards.CountByOutbox(ctx, b.ID)
+    if err != nil { return false, err }
+    if existing > 0 { return true, w.shards.ResumeOutbox(ctx, b.ID, b.Attempts) }
+
+    cnt, err := w.fanRepo.CountFans(ctx, b.AuthorID)
+    if err != nil { return false, err }
+    if cnt <= int64(w.shardSize) { return false, nil }
+    step := w.shardSize
+    if per := int((cnt + maxFanoutShards - 1) / maxFanoutShards); per > step { step = per }
+    points, err := w.fanRepo.SplitPoints(ctx, b.AuthorID, step, maxFanoutShards-1)
+    if err != nil { return false, err }
+
+    // 分割点把粉丝切成 (nil, p0], (p0, p1], ..., (pk, nil)
+    now := time.Now()
+    shards := make([]*model.FanoutShard, 0, len(points)+1)
+    var lower *repository.Cursor
+    for i := 0; i <= len(points); i++ {
+        var upper *repository.Cursor
+        if i < len(points) { upper = points[i] }
+        sh := &model.FanoutShard{
+            ID: uuid.New().String(), OutboxID: b.ID, Seq: i, PostID: b.PostID, AuthorID: b.AuthorID,
+            Score: b.CreatedAt.UnixNano(), Status: model.OutboxPending, NextAttemptAt: now, CreatedAt: now, UpdatedAt: now,
+        }
+        if lower != nil { sh.LowerAt, sh.LowerID = &lower.CreatedAt, lower.ID }
+        if upper != nil { sh.UpperAt, sh.UpperID = &upper.CreatedAt, upper.ID }
+        shards = append(shards, sh)
+        lower = upper
+    }
+    if err := w.shards.CreateForOutbox(ctx, b.ID, b.Attempts, shards); err != nil { return false, err }
+    logger.Info("fanout outbox sharded",
+        zap.String("outbox", b.ID), zap.Int64("fans", cnt), zap.Int("shards", len(shards)))
+    return true, nil
+}
+
+// handleShard 扇出一个分片；最后一个完成的分片负责把 outbox 置为 done
+func (w *FanoutWorker) handleShard(ctx context.Context, sh *model.FanoutShard) {
+    after := checkpoint(sh.CursorAt, sh.CursorID)
+    if after == nil { after = checkpoint(sh.LowerAt, sh.LowerID) }
+    job := fanoutJob{
+        authorID: sh.AuthorID,
+        postID:   sh.PostID,
+        score:    sh.Score,
+        after:    after,
+        upTo:     checkpoint(sh.UpperAt, sh.UpperID),
+        save: func(ctx context.Context, records []model.Inbox, cursor *repository.Cursor) (int64, error) {
+            return w.shards.SaveProgress(ctx, sh.ID, sh.Attempts, records, cursor)
+        },
+    }
+    err := w.fanout(ctx, job)
+    if errors.Is(err, repository.ErrLeaseLost) {
+        logger.Warn("fanout shard lease lost", zap.String("shard", sh.ID), zap.Int("attempts", sh.Attempts))
+        return
+    }
+    if err != nil {
+        if sh.Attempts >= w.maxAttempts {
+            logger.Error("fanout shard failed",
+                zap.String("outbox", sh.OutboxID), zap.Int("seq", sh.Seq), zap.Int("attempts", sh.Attempts), zap.Error(err))
+            _ = w.shards.MarkFailed(ctx, sh, err.Error())
+            return
+        }
+        _ = w.shards.MarkRetry(ctx, sh.ID, sh.Attempts, time.Now().Add(fanoutBackoff(sh.Attempts)), err.Error())
+        return
+    }
+    if err := w.shards.MarkDone(ctx, sh.ID, sh.Attempts); err != nil {
+        logger.Warn("fanout mark shard done failed", zap.String("shard", sh.ID), zap.Error(err))
+        return
+    }
+    completed, err := w.shards.CompleteOutbox(ctx, sh.OutboxID)
+    if err != nil {
+        logger.Warn("fanout complete sharded outbox failed", zap.String("outbox", sh.OutboxID), zap.Error(err))
+        return
+    }
+    if completed { w.recordLatency(time.Unix(0, sh.Score)) }
+}
+
+// fanoutJob 一次扇出的工作范围：整条 outbox 或其中一个分片
+type fanoutJob struct {
+    authorID string
+    postID   string
+    score    int64
+    after    *repository.Cursor // 断点或区间下界（不含），nil 表示从头开始
+    upTo     *repository.Cursor // 区间上界（含），nil 表示到末尾
+    // save 写入一页 inbox 并推进断点
+    save func(ctx context.Context, records []model.Inbox, cursor *repository.Cursor) (int64, error)
+}
+
+// fanout 从断点开始分页读取粉丝写入 inbox，每页与断点同事务提交
+func (w *FanoutWorker) fanout(ctx context.Context, job fanoutJob) error {
+    after := job.after
+    for {
+        // 帖子在扇出过程中被删除时停止；retract 之后仍可能多写入一页，读端会过滤已删除的帖子
+        retracted, err := w.posts.IsRetracted(ctx, job.postID)
+        if err != nil { return err }
+        if retracted { return nil }
+        // fetch fans in pages (seek on created_at, id)
+        fans, next, err := w.fanRepo.ListFansRange(ctx, job.authorID, after, job.upTo, w.batchSize)
+        if err != nil { return err }
+        if len(fans) == 0 { return nil }
+        records := make([]model.Inbox, 0, len(fans))
         now := time.Now()
-        _ = w.db.WithContext(ctx).Model(&model.Outbox{}).
-            Where("id = ?", b.ID).
-            Updates(map[string]any{"status": "done", "processed_at": now, "fanout_count": totalWritten}).Error
-        // record latency
-        if !b.CreatedAt.IsZero() {
-            select { case w.metricsCh <- time.Since(b.CreatedAt): default: }
+        muted := w.mutedFans(ctx, job.authorID, fans)
+        for _, f := range fans {
+            if _, ok := muted[f.FanID]; ok { continue }
+            id, err := newRowID(w.ids)
+            if err != nil { return err }
+            records = append(records, model.Inbox{ID: id, UserID: f.FanID, PostID: job.postID, Score: job.score, CreatedAt: now})
         }
+        last := fans[len(fans)-1]
+        if _, err := job.save(ctx, records, &repository.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}); err != nil { return err }
+        // 写穿失败不影响扇出：缓存过期或被重建后会从 inbox 恢复
+        if w.timelineCache != nil {
+            if err := w.timelineCache.Append(ctx, records); err != nil {
+                logger.Warn("timeline cache append failed", zap.String("post", job.postID), zap.Error(err))
+            }
+        }
+        if next == nil { return nil }
+        after = next
     }
-    return nil
+}
+
+// checkpoint 把持久化的 (created_at, id) 还原为游标，未设置时返回 nil
+func checkpoint(at *time.Time, id string) *repository.Cursor {
+    if at == nil { return nil }
+    return &repository.Cursor{CreatedAt: *at, ID: id}
+}
+
+func (w *FanoutWorker) recordLatency(createdAt time.Time) {
+    if createdAt.IsZero() { return }
+    select { case w.metricsCh <- time.Since(createdAt): default: }
+}
+
+// fanoutBackoff 指数退避：2s, 4s, 8s ... 封顶 10 分钟
+func fanoutBackoff(attempts int) time.Duration {
+    return expBackoff(attempts, fanoutBaseBackoff, fanoutMaxBackoff)
 }
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/idgen"
+)
+
+// brokenFanRepo 模拟粉丝列表读取失败
+type brokenFanRepo struct {
+	repository.FanRepository
+}
+
+func (brokenFanRepo) ListFansRange(context.Context, string, *repository.Cursor, *repository.Cursor, int) ([]*model.Fan, *repository.Cursor, error) {
+	return nil, nil, errors.New("fans unavailable")
+}
+
+// claimedOutbox 写入一条已被领取（processing）的 outbox，模拟 Claim 之后的状态
+func claimedOutbox(t *testing.T, db *gorm.DB, id, author string, attempts int) *model.Outbox {
+	now := time.Now()
+	lease := now.Add(time.Minute)
+	ob := &model.Outbox{ID: id, PostID: "p-" + id, AuthorID: author, Status: model.OutboxProcessing, Attempts: attempts, LeaseUntil: &lease, CreatedAt: now, NextAttemptAt: now}
+	require.NoError(t, db.Create(ob).Error)
+	return ob
+}
+
+// claimOutbox 按 Claim 的方式领取一行：置为 processing 并 attempts+1
+func claimOutbox(t *testing.T, db *gorm.DB, id string) *model.Outbox {
+	lease := time.Now().Add(time.Minute)
+	require.NoError(t, db.Model(&model.Outbox{}).Where("id = ?", id).
+		Updates(map[string]any{"status": model.OutboxProcessing, "attempts": gorm.Expr("attempts + 1"), "lease_until": lease}).Error)
+	return loadOutbox(t, db, id)
+}
+
+// claimShard 按 Claim 的方式领取一个分片
+func claimShard(t *testing.T, db *gorm.DB, id string) *model.FanoutShard {
+	lease := time.Now().Add(time.Minute)
+	require.NoError(t, db.Model(&model.FanoutShard{}).Where("id = ?", id).
+		Updates(map[string]any{"status": model.OutboxProcessing, "attempts": gorm.Expr("attempts + 1"), "lease_until": lease}).Error)
+	var sh model.FanoutShard
+	require.NoError(t, db.First(&sh, "id = ?", id).Error)
+	return &sh
+}
+
+func loadOutbox(t *testing.T, db *gorm.DB, id string) *model.Outbox {
+	var ob model.Outbox
+	require.NoError(t, db.First(&ob, "id = ?", id).Error)
+	return &ob
+}
+
+func TestFanoutRetriesThenFails(t *testing.T) {
+	db := setupTimelineDB(t)
+	w := NewFanoutWorker(db, brokenFanRepo{}, 1, 0, 0, 0).WithRetryPolicy(3, 0)
+	ctx := context.Background()
+
+	before := time.Now()
+	w.handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	ob := loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxPending, ob.Status)
+	assert.True(t, ob.NextAttemptAt.After(before))
+	assert.Nil(t, ob.LeaseUntil)
+	assert.Equal(t, "fans unavailable", ob.LastError)
+
+	w.handle(ctx, claimedOutbox(t, db, "o2", "author", 3))
+	assert.Equal(t, model.OutboxFailed, loadOutbox(t, db, "o2").Status)
+}
+
+func TestFanoutWritesInboxAndMarksDone(t *testing.T) {
+	db := setupTimelineDB(t)
+	fanRepo := repository.NewFanRepository(db)
+	ctx := context.Background()
+	for _, fan := range []string{"f1", "f2", "f3"} {
+		require.NoError(t, fanRepo.Create(ctx, "author", fan))
+	}
+	w := NewFanoutWorker(db, fanRepo, 1, 2, 0, 0)
+
+	w.handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	ob := loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxDone, ob.Status)
+	assert.Equal(t, int64(3), ob.FanoutCount)
+	var cnt int64
+	db.Model(&model.Inbox{}).Where("post_id = ?", "p-o1").Count(&cnt)
+	assert.Equal(t, int64(3), cnt)
+}
+
+func TestFanoutSkipsCelebrityByRelationCount(t *testing.T) {
+	db := setupTimelineDB(t)
+	fanRepo := repository.NewFanRepository(db)
+	ctx := context.Background()
+	require.NoError(t, fanRepo.Create(ctx, "author", "f1"))
+	// 大V判定读 relation_counts，不对 fans 计数
+	require.NoError(t, db.Model(&model.RelationCount{}).Where("user_id = ?", "author").Update("follower_count", 5).Error)
+
+	NewFanoutWorker(db, fanRepo, 1, 2, 0, 0).WithCelebrityThreshold(5).
+		handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	assert.Equal(t, model.OutboxDone, loadOutbox(t, db, "o1").Status)
+	var cnt int64
+	db.Model(&model.Inbox{}).Where("post_id = ?", "p-o1").Count(&cnt)
+	assert.Zero(t, cnt)
+}
+
+func TestPublishAndFanoutUseIDGenerator(t *testing.T) {
+	db := setupTimelineDB(t)
+	fanRepo := repository.NewFanRepository(db)
+	ctx := context.Background()
+	for _, fan := range []string{"f1", "f2", "f3"} {
+		require.NoError(t, fanRepo.Create(ctx, "author", fan))
+	}
+	ids, err := idgen.New(idgen.DefaultLayout, 7)
+	require.NoError(t, err)
+
+	postID, err := NewPublisher(db).WithIDGenerator(ids).Publish(ctx, "author", "hello")
+	require.NoError(t, err)
+	id, err := idgen.Parse(postID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), idgen.DefaultLayout.Decode(id).WorkerID)
+
+	NewFanoutWorker(db, fanRepo, 1, 2, 0, 0).WithIDGenerator(ids).
+		handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	var inbox []model.Inbox
+	require.NoError(t, db.Where("post_id = ?", "p-o1").Order("id").Find(&inbox).Error)
+	require.Len(t, inbox, 3)
+	for _, row := range inbox {
+		rowID, err := idgen.Parse(row.ID)
+		require.NoError(t, err)
+		assert.Greater(t, rowID, id)
+	}
+}
+
+// flakyFanRepo 读到第 failAt 页时失败，模拟扇出中途崩溃
+type flakyFanRepo struct {
+	repository.FanRepository
+	failAt int
+	pages  int
+}
+
+func (r *flakyFanRepo) ListFansRange(ctx context.Context, userID string, after, upTo *repository.Cursor, limit int) ([]*model.Fan, *repository.Cursor, error) {
+	r.pages++
+	if r.pages == r.failAt {
+		return nil, nil, errors.New("worker crashed")
+	}
+	return r.FanRepository.ListFansRange(ctx, userID, after, upTo, limit)
+}
+
+func seedFans(t *testing.T, db *gorm.DB, author string, n int) {
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < n; i++ {
+		at := base.Add(time.Duration(i) * time.Second)
+		require.NoError(t, db.Create(&model.Fan{ID: fmt.Sprintf("fan-%03d", i), UserID: author, FanID: fmt.Sprintf("u%03d", i), CreatedAt: at, UpdatedAt: at}).Error)
+	}
+}
+
+func countInbox(t *testing.T, db *gorm.DB, postID string) int64 {
+	var cnt int64
+	require.NoError(t, db.Model(&model.Inbox{}).Where("post_id = ?", postID).Count(&cnt).Error)
+	return cnt
+}
+
+func TestFanoutResumesFromCheckpoint(t *testing.T) {
+	db := setupTimelineDB(t)
+	seedFans(t, db, "author", 5)
+	flaky := &flakyFanRepo{FanRepository: repository.NewFanRepository(db), failAt: 2}
+	ctx := context.Background()
+
+	// 第一页写入后崩溃：断点停在第 2 个粉丝
+	NewFanoutWorker(db, flaky, 1, 2, 0, 0).handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	ob := loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxPending, ob.Status)
+	require.NotNil(t, ob.CursorAt)
+	assert.Equal(t, "fan-001", ob.CursorID)
+	assert.Equal(t, int64(2), ob.FanoutCount)
+
+	// 另一个 worker 重新领取后从断点继续
+	ob = claimOutbox(t, db, ob.ID)
+	NewFanoutWorker(db, repository.NewFanRepository(db), 1, 2, 0, 0).handle(ctx, ob)
+	ob = loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxDone, ob.Status)
+	assert.Equal(t, int64(5), ob.FanoutCount)
+	assert.Equal(t, int64(5), countInbox(t, db, "p-o1"))
+}
+
+func TestFanoutShardsLargeAuthor(t *testing.T) {
+	db := setupTimelineDB(t)
+	require.NoError(t, db.AutoMigrate(&model.FanoutShard{}))
+	seedFans(t, db, "author", 7)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 1, 2, 0, 0).WithSharding(3)
+	ctx := context.Background()
+
+	w.handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	assert.Equal(t, model.OutboxSharded, loadOutbox(t, db, "o1").Status)
+	var shards []*model.FanoutShard
+	require.NoError(t, db.Order("seq").Find(&shards, "outbox_id = ?", "o1").Error)
+	require.Len(t, shards, 3)
+	assert.Nil(t, shards[0].LowerAt)
+	assert.Equal(t, "fan-002", shards[0].UpperID)
+	assert.Equal(t, "fan-002", shards[1].LowerID)
+	assert.Nil(t, shards[2].UpperAt)
+
+	// 分片可乱序处理，最后一个完成的分片把 outbox 置为 done
+	for _, i := range []int{2, 0, 1} {
+		assert.NotEqual(t, model.OutboxDone, loadOutbox(t, db, "o1").Status)
+		w.handleShard(ctx, claimShard(t, db, shards[i].ID))
+	}
+	ob := loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxDone, ob.Status)
+	assert.Equal(t, int64(7), ob.FanoutCount)
+	assert.Equal(t, int64(7), countInbox(t, db, "p-o1"))
+}
+
+func TestFanoutStaleShardCannotFailOutbox(t *testing.T) {
+	db := setupTimelineDB(t)
+	require.NoError(t, db.AutoMigrate(&model.FanoutShard{}))
+	seedFans(t, db, "author", 5)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 1, 2, 0, 0).WithSharding(3)
+	ctx := context.Background()
+
+	w.handle(ctx, claimedOutbox(t, db, "o1", "author", 1))
+	var shards []*model.FanoutShard
+	require.NoError(t, db.Order("seq").Find(&shards, "outbox_id = ?", "o1").Error)
+	require.Len(t, shards, 2)
+
+	// 第一次领取的租约过期后分片被重新领取；旧 worker 的失败与进度都不生效
+	stale := claimShard(t, db, shards[0].ID)
+	require.NoError(t, db.Model(&model.FanoutShard{}).Where("id = ?", stale.ID).Update("status", model.OutboxPending).Error)
+	current := claimShard(t, db, shards[0].ID)
+	repo := repository.NewFanoutShardRepository(db)
+	assert.ErrorIs(t, repo.MarkFailed(ctx, stale, "stale"), repository.ErrLeaseLost)
+	assert.ErrorIs(t, repo.MarkDone(ctx, stale.ID, stale.Attempts), repository.ErrLeaseLost)
+	assert.Equal(t, model.OutboxSharded, loadOutbox(t, db, "o1").Status)
+
+	w.handleShard(ctx, current)
+	w.handleShard(ctx, claimShard(t, db, shards[1].ID))
+	assert.Equal(t, model.OutboxDone, loadOutbox(t, db, "o1").Status)
+	assert.Equal(t, int64(5), countInbox(t, db, "p-o1"))
+}
+
+func TestFanoutBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, fanoutBackoff(1))
+	assert.Equal(t, 8*time.Second, fanoutBackoff(3))
+	assert.Equal(t, fanoutMaxBackoff, fanoutBackoff(20))
+}
+
+func TestPublishNotifyIgnoredOutsidePostgres(t *testing.T) {
+	db := setupTimelineDB(t)
+	ctx := context.Background()
+
+	// sqlite 没有 pg_notify，WithNotify 应当是空操作，发布照常成功
+	p := NewPublisher(db).WithNotify(FanoutNotifyChannel)
+	_, err := p.Publish(ctx, "author", "hello")
+	require.NoError(t, err)
+
+	var n int64
+	require.NoError(t, db.Model(&model.Outbox{}).Count(&n).Error)
+	assert.Equal(t, int64(1), n)
+
+	// 唤醒信号不阻塞，多余的直接丢弃
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 2, 10, 10, time.Second)
+	for i := 0; i < 10; i++ {
+		w.Notify()
+	}
+	assert.Len(t, w.wakeCh, 2)
+}
+
+func loadOutboxByKind(t *testing.T, db *gorm.DB, postID, kind string) *model.Outbox {
+	var ob model.Outbox
+	require.NoError(t, db.First(&ob, "post_id = ? AND kind = ?", postID, kind).Error)
+	return &ob
+}
+
+func TestPostEditAndRetractPropagate(t *testing.T) {
+	db := setupTimelineDB(t)
+	seedFans(t, db, "author", 3)
+	ctx := context.Background()
+	p := NewPublisher(db)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 1, 2, 0, 0)
+	timeline := NewTimelineService(db, nil, nil, 0, nil, nil)
+
+	postID, err := p.Publish(ctx, "author", "v1")
+	require.NoError(t, err)
+	w.handle(ctx, claimOutbox(t, db, loadOutboxByKind(t, db, postID, model.OutboxKindPublish).ID))
+	require.Equal(t, int64(3), countInbox(t, db, postID))
+
+	// 只有作者可以编辑/删除
+	assert.ErrorIs(t, p.Edit(ctx, "other", postID, "hacked"), ErrNotPostAuthor)
+	assert.ErrorIs(t, p.Retract(ctx, "other", postID), ErrNotPostAuthor)
+
+	require.NoError(t, p.Edit(ctx, "author", postID, "v2"))
+	page, err := timeline.GetTimeline(ctx, "u000", "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.List, 1)
+	assert.Equal(t, "v2", page.List[0].Payload)
+
+	// 删除后清理完成之前，时间线已经读不到
+	require.NoError(t, p.Retract(ctx, "author", postID))
+	page, err = timeline.GetTimeline(ctx, "u000", "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.List)
+	assert.Equal(t, int64(3), countInbox(t, db, postID))
+
+	retract := claimOutbox(t, db, loadOutboxByKind(t, db, postID, model.OutboxKindRetract).ID)
+	w.handle(ctx, retract)
+	assert.Equal(t, int64(0), countInbox(t, db, postID))
+	assert.Equal(t, model.OutboxDone, loadOutbox(t, db, retract.ID).Status)
+	assert.ErrorIs(t, p.Retract(ctx, "author", postID), ErrPostNotFound)
+}
+
+func TestRetractCancelsPendingFanout(t *testing.T) {
+	db := setupTimelineDB(t)
+	seedFans(t, db, "author", 3)
+	ctx := context.Background()
+	p := NewPublisher(db)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 1, 2, 0, 0)
+
+	postID, err := p.Publish(ctx, "author", "v1")
+	require.NoError(t, err)
+	require.NoError(t, p.Retract(ctx, "author", postID))
+
+	publish := loadOutboxByKind(t, db, postID, model.OutboxKindPublish)
+	assert.Equal(t, model.OutboxDone, publish.Status)
+	assert.Equal(t, "retracted", publish.LastError)
+
+	// 已被领取的扇出在写 inbox 前发现帖子已删除，直接结束
+	w.handle(ctx, publish)
+	assert.Equal(t, int64(0), countInbox(t, db, postID))
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/cacheperf"
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+// setupFollowerCache dbDelay 模拟回源耗时，用于让并发回源重叠
+func setupFollowerCache(t *testing.T, dbDelay time.Duration) (*gorm.DB, *miniredis.Miniredis, *cacheperf.FollowerService) {
+	db := setupReplicatorDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+	mr := miniredis.RunT(t)
+	return db, mr, cacheperf.NewFollowerService(db, redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour, dbDelay)
+}
+
+func TestFollowerCacheFollowsRelationChanges(t *testing.T) {
+	db, mr, followers := setupFollowerCache(t, 0)
+	rel := NewRelationshipService(repository.NewFollowRepository(db), repository.NewFanRepository(db), nil, nil, nil, nil, followers)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour)
+	require.NoError(t, db.Create(&model.Fan{ID: "f1", UserID: "b", FanID: "u1", CreatedAt: base}).Error)
+	require.NoError(t, db.Create(&model.Fan{ID: "f2", UserID: "b", FanID: "u2", CreatedAt: base.Add(time.Second)}).Error)
+
+	list, err := rel.ListFans(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u2", "u1"}, list)
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+
+	// 关注/取关直接维护索引（fans 尚未由 replicator 落库），不触发重建
+	require.NoError(t, rel.Follow(ctx, "u3", "b"))
+	require.NoError(t, rel.Unfollow(ctx, "u2", "b"))
+	list, err = rel.ListFans(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u3", "u1"}, list)
+	list, err = rel.ListFans(ctx, "b", 2, 10)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+	assert.Greater(t, mr.TTL("followers:index:b"), time.Duration(0))
+
+	// 未缓存的用户不建索引，下次读取回源
+	require.NoError(t, rel.Follow(ctx, "u1", "c"))
+	assert.False(t, mr.Exists("followers:index:c"))
+}
+
+func TestFollowerCacheInvalidatesUserSnapshots(t *testing.T) {
+	db, mr, followers := setupFollowerCache(t, 0)
+	users := NewUserService(repository.NewUserRepository(db), nil, nil, followers)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&model.User{ID: "u1", Username: "alice", Email: "a@example.com", Password: "p"}).Error)
+	require.NoError(t, db.Create(&model.Fan{ID: "f1", UserID: "b", FanID: "u1", CreatedAt: time.Now()}).Error)
+
+	snaps, err := followers.FetchFollowersOptimized(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	require.True(t, mr.Exists("user:u1"))
+
+	name := "alice2"
+	_, err = users.Update(ctx, "u1", &dto.UpdateUserRequest{Username: &name})
+	require.NoError(t, err)
+	assert.False(t, mr.Exists("user:u1"))
+	snaps, err = followers.FetchFollowersOptimized(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	assert.Equal(t, "alice2", snaps[0].Username)
+
+	// 删除用户时连同其粉丝索引一起失效
+	require.NoError(t, db.Create(&model.User{ID: "b", Username: "bob", Email: "b@example.com", Password: "p"}).Error)
+	require.True(t, mr.Exists("followers:index:b"))
+	require.NoError(t, users.Delete(ctx, "b"))
+	assert.False(t, mr.Exists("followers:index:b"))
+}
+
+func TestFollowerCacheCoalescesConcurrentMisses(t *testing.T) {
+	db, _, followers := setupFollowerCache(t, 50*time.Millisecond)
+	require.NoError(t, db.Create(&model.Fan{ID: "f1", UserID: "b", FanID: "u1", CreatedAt: time.Now()}).Error)
+
+	// sqlite :memory: 每个连接是独立的库
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids, err := followers.FetchFollowerIDs(context.Background(), "b", 1, 10)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"u1"}, ids)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+}
+
+func TestFollowerCacheEmptySentinel(t *testing.T) {
+	db, mr, followers := setupFollowerCache(t, 0)
+	rel := NewRelationshipService(repository.NewFollowRepository(db), repository.NewFanRepository(db), nil, nil, nil, nil, followers)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		list, err := rel.ListFans(ctx, "b", 1, 10)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	}
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+	assert.LessOrEqual(t, mr.TTL("followers:index:b"), 30*time.Second)
+
+	// 新粉丝写入占位索引；取关最后一个粉丝后索引重新只剩占位，读取不回源
+	require.NoError(t, rel.Follow(ctx, "u1", "b"))
+	list, err := rel.ListFans(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, list)
+	require.NoError(t, rel.Unfollow(ctx, "u1", "b"))
+	list, err = rel.ListFans(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+}
+
+func TestFollowerCacheCapsIndex(t *testing.T) {
+	db, mr, followers := setupFollowerCache(t, 0)
+	followers.WithIndexSize(3)
+	rel := NewRelationshipService(repository.NewFollowRepository(db), repository.NewFanRepository(db), nil, nil, nil, nil, followers)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour)
+	for i, fan := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		require.NoError(t, db.Create(&model.Fan{ID: "f" + fan, UserID: "b", FanID: fan, CreatedAt: base.Add(time.Duration(i) * time.Second)}).Error)
+	}
+
+	// 只缓存最新的 3 个粉丝，窗口内的分页读 Redis
+	list, err := rel.ListFans(ctx, "b", 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u5", "u4"}, list)
+	index, err := mr.List("followers:index:b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u5", "u4", "u3"}, index)
+	assert.Equal(t, int64(0), followers.Counters().PageQueries)
+
+	// 越过窗口的分页回源 fans 表
+	list, err = rel.ListFans(ctx, "b", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u3", "u2"}, list)
+	list, err = rel.ListFans(ctx, "b", 3, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, list)
+	assert.Equal(t, int64(2), followers.Counters().PageQueries)
+	assert.Equal(t, int64(1), followers.Counters().IndexLoads)
+
+	// 新关注推入后仍截断到窗口大小
+	require.NoError(t, rel.Follow(ctx, "u6", "b"))
+	index, err = mr.List("followers:index:b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u6", "u5", "u4"}, index)
+}
+
+func TestFollowerCacheRefreshesEarly(t *testing.T) {
+	db, mr, followers := setupFollowerCache(t, time.Millisecond)
+	// beta 取极大值，任何命中都会触发提前刷新
+	followers.WithEarlyRefresh(1e12)
+	ctx := context.Background()
+	require.NoError(t, db.Create(&model.Fan{ID: "f1", UserID: "b", FanID: "u1", CreatedAt: time.Now()}).Error)
+
+	_, err := followers.FetchFollowerIDs(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	ids, err := followers.FetchFollowerIDs(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, ids)
+	assert.Equal(t, int64(1), followers.Counters().EarlyRefresh)
+	assert.Eventually(t, func() bool { return followers.Counters().IndexLoads == 2 }, time.Second, 5*time.Millisecond)
+
+	// 回源耗时按用户记录，与索引同时过期
+	assert.True(t, mr.Exists("followers:load:b"))
+	assert.Greater(t, mr.TTL("followers:load:b"), time.Duration(0))
+
+	// 其他用户的回源耗时不影响本用户：没有本用户的耗时记录时不提前刷新
+	require.NoError(t, db.Create(&model.Fan{ID: "f2", UserID: "c", FanID: "u1", CreatedAt: time.Now()}).Error)
+	_, err = followers.FetchFollowerIDs(ctx, "c", 1, 10)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return followers.Counters().IndexLoads == 3 }, time.Second, 5*time.Millisecond)
+	mr.Del("followers:load:c")
+	_, err = followers.FetchFollowerIDs(ctx, "c", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), followers.Counters().EarlyRefresh)
+
+	// 关闭后命中不再刷新
+	followers.WithEarlyRefresh(0)
+	_, err = followers.FetchFollowerIDs(ctx, "b", 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), followers.Counters().EarlyRefresh)
+}
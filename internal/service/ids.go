@@ -0,0 +1,19 @@
+package service
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/d60-Lab/gin-template/pkg/idgen"
+)
+
+// newRowID 生成字符串主键：设置了 ID 生成器时为按时间递增的定长十进制（字典序即时间序，索引按序追加），否则为 uuid
+func newRowID(ids *idgen.Generator) (string, error) {
+	if ids == nil {
+		return uuid.New().String(), nil
+	}
+	id, err := ids.Next(0)
+	if err != nil {
+		return "", err
+	}
+	return idgen.Format(id), nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+const (
+	defaultOutboxListLimit = 20
+	maxOutboxListLimit     = 100
+)
+
+// OutboxService 外发盒运维：查看扇出失败的记录并重新入队
+type OutboxService interface {
+	// ListFailed 游标分页列出 failed 记录，cursor 为空表示第一页
+	ListFailed(ctx context.Context, cursor string, limit int) (*dto.OutboxListResponse, error)
+	// Requeue 把 failed 记录重置为 pending（attempts 清零），非 failed 的 id 会被忽略
+	Requeue(ctx context.Context, ids []string) (int64, error)
+}
+
+type outboxService struct {
+	repo repository.OutboxRepository
+}
+
+func NewOutboxService(repo repository.OutboxRepository) OutboxService {
+	return &outboxService{repo: repo}
+}
+
+func (s *outboxService) ListFailed(ctx context.Context, cursor string, limit int) (*dto.OutboxListResponse, error) {
+	after, err := repository.DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		limit = defaultOutboxListLimit
+	}
+	if limit > maxOutboxListLimit {
+		limit = maxOutboxListLimit
+	}
+	rows, next, err := s.repo.ListFailed(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	resp := &dto.OutboxListResponse{List: make([]*dto.OutboxItem, len(rows)), NextCursor: encodeNextCursor(next)}
+	for i, r := range rows {
+		resp.List[i] = &dto.OutboxItem{
+			ID:            r.ID,
+			PostID:        r.PostID,
+			AuthorID:      r.AuthorID,
+			Status:        r.Status,
+			Attempts:      r.Attempts,
+			LastError:     r.LastError,
+			CreatedAt:     r.CreatedAt.Format("2006-01-02 15:04:05"),
+			NextAttemptAt: r.NextAttemptAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return resp, nil
+}
+
+func (s *outboxService) Requeue(ctx context.Context, ids []string) (int64, error) {
+	return s.repo.Requeue(ctx, ids)
+}
@@ -2,30 +2,108 @@ package service
 
 import (
     "context"
+    "errors"
     "time"
 
     "github.com/google/uuid"
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
 
     "github.com/d60-Lab/gin-template/internal/model"
+    "github.com/d60-Lab/gin-template/pkg/idgen"
 )
 
+var (
+    ErrPostNotFound  = errors.New("post not found")
+    ErrNotPostAuthor = errors.New("only the author can modify this post")
+)
+
+// FanoutNotifyChannel 新 outbox 的 Postgres NOTIFY 频道，FanoutWorker 通过 LISTEN 被即时唤醒
+const FanoutNotifyChannel = "fanout_outbox"
+
 // Publisher 负责事务内写 posts + outbox
-type Publisher struct { db *gorm.DB }
+type Publisher struct {
+    db *gorm.DB
+    // notifyChannel 非空时在同一事务内 NOTIFY，提交后才会投递（仅 Postgres）
+    notifyChannel string
+    // ids 非空时帖子 ID 按时间递增，否则为 uuid
+    ids *idgen.Generator
+}
 
 func NewPublisher(db *gorm.DB) *Publisher { return &Publisher{db: db} }
 
+// WithNotify 发布时向 channel 发送 NOTIFY（payload 为 outbox id）；非 Postgres 方言下忽略。
+func (p *Publisher) WithNotify(channel string) *Publisher {
+    if p.db.Dialector.Name() == "postgres" { p.notifyChannel = channel }
+    return p
+}
+
+// WithIDGenerator 帖子 ID 改用分布式 ID 生成器。
+func (p *Publisher) WithIDGenerator(ids *idgen.Generator) *Publisher {
+    p.ids = ids
+    return p
+}
+
 // Publish 在一个事务内落地 Post 与 Outbox 事件
 func (p *Publisher) Publish(ctx context.Context, authorID, payload string) (string, error) {
-    postID := uuid.New().String()
+    postID, err := newRowID(p.ids)
+    if err != nil { return "", err }
     now := time.Now()
-    err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+    err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
         post := &model.Post{ID: postID, AuthorID: authorID, Payload: payload, CreatedAt: now, UpdatedAt: now}
         if err := tx.Create(post).Error; err != nil { return err }
-        out := &model.Outbox{ID: uuid.New().String(), PostID: postID, AuthorID: authorID, CreatedAt: now, Status: "pending"}
-        if err := tx.Create(out).Error; err != nil { return err }
-        return nil
+        return p.enqueue(tx, postID, authorID, model.OutboxKindPublish, now)
     })
     if err != nil { return "", err }
     return postID, nil
 }
+
+// Edit 作者修改内容：原地更新 payload 并写入 edit 事件（inbox 只引用 post_id，读时即为新内容）
+func (p *Publisher) Edit(ctx context.Context, authorID, postID, payload string) error {
+    return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        post, err := lockOwnPost(tx, authorID, postID)
+        if err != nil { return err }
+        now := time.Now()
+        if err := tx.Model(post).Updates(map[string]any{"payload": payload, "updated_at": now}).Error; err != nil { return err }
+        return p.enqueue(tx, postID, authorID, model.OutboxKindEdit, now)
+    })
+}
+
+// Retract 作者删除帖子：软删除（读路径立即不可见），取消尚未领取的扇出，并写入 retract 事件由 worker 分批清理 inbox
+func (p *Publisher) Retract(ctx context.Context, authorID, postID string) error {
+    return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        post, err := lockOwnPost(tx, authorID, postID)
+        if err != nil { return err }
+        if err := tx.Delete(post).Error; err != nil { return err }
+        now := time.Now()
+        if err := tx.Model(&model.Outbox{}).
+            Where("post_id = ? AND kind = ? AND status = ?", postID, model.OutboxKindPublish, model.OutboxPending).
+            Updates(map[string]any{"status": model.OutboxDone, "processed_at": now, "last_error": "retracted"}).Error; err != nil {
+            return err
+        }
+        return p.enqueue(tx, postID, authorID, model.OutboxKindRetract, now)
+    })
+}
+
+// lockOwnPost 在事务内锁定未删除的帖子并校验作者
+func lockOwnPost(tx *gorm.DB, authorID, postID string) (*model.Post, error) {
+    var post model.Post
+    q := tx
+    if tx.Dialector.Name() == "postgres" { q = q.Clauses(clause.Locking{Strength: "UPDATE"}) }
+    if err := q.Where("id = ?", postID).First(&post).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) { return nil, ErrPostNotFound }
+        return nil, err
+    }
+    if post.AuthorID != authorID { return nil, ErrNotPostAuthor }
+    return &post, nil
+}
+
+// enqueue 在事务内写入一条 outbox 事件，开启 NOTIFY 时同事务通知
+func (p *Publisher) enqueue(tx *gorm.DB, postID, authorID, kind string, now time.Time) error {
+    out := &model.Outbox{ID: uuid.New().String(), PostID: postID, AuthorID: authorID, Kind: kind, CreatedAt: now, Status: model.OutboxPending, NextAttemptAt: now}
+    if err := tx.Create(out).Error; err != nil { return err }
+    if p.notifyChannel != "" {
+        return tx.Exec("SELECT pg_notify(?, ?)", p.notifyChannel, out.ID).Error
+    }
+    return nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const (
+	defaultCountCacheTTL      = 5 * time.Minute
+	defaultReconcileInterval  = 10 * time.Minute
+	defaultReconcileBatchSize = 500
+)
+
+// RelationCountService 关注数/粉丝数读取：Redis 缓存在前，relation_counts 表在后
+type RelationCountService interface {
+	GetCounts(ctx context.Context, userID string) (*dto.RelationCounts, error)
+	BatchGetCounts(ctx context.Context, userIDs []string) (map[string]*dto.RelationCounts, error)
+	// Invalidate 计数变化后删除缓存，下次读取回源
+	Invalidate(ctx context.Context, userIDs ...string)
+}
+
+type relationCountService struct {
+	repo  repository.RelationCountRepository
+	cache *redis.Client // 为 nil 时直接读库
+	ttl   time.Duration
+}
+
+// NewRelationCountService 创建计数服务；cache 可为 nil（未配置 Redis 时）
+func NewRelationCountService(repo repository.RelationCountRepository, cache *redis.Client, ttl time.Duration) RelationCountService {
+	if ttl <= 0 {
+		ttl = defaultCountCacheTTL
+	}
+	return &relationCountService{repo: repo, cache: cache, ttl: ttl}
+}
+
+func countCacheKey(userID string) string { return fmt.Sprintf("relcount:%s", userID) }
+
+func (s *relationCountService) GetCounts(ctx context.Context, userID string) (*dto.RelationCounts, error) {
+	res, err := s.BatchGetCounts(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	return res[userID], nil
+}
+
+func (s *relationCountService) BatchGetCounts(ctx context.Context, userIDs []string) (map[string]*dto.RelationCounts, error) {
+	res := make(map[string]*dto.RelationCounts, len(userIDs))
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+
+	missing := userIDs
+	if s.cache != nil {
+		missing = make([]string, 0, len(userIDs))
+		keys := make([]string, len(userIDs))
+		for i, id := range userIDs {
+			keys[i] = countCacheKey(id)
+		}
+		vals, err := s.cache.MGet(ctx, keys...).Result()
+		for i, id := range userIDs {
+			if err == nil && vals[i] != nil {
+				if str, ok := vals[i].(string); ok {
+					var c dto.RelationCounts
+					if uErr := json.Unmarshal([]byte(str), &c); uErr == nil {
+						res[id] = &c
+						continue
+					}
+				}
+			}
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	rows, err := s.repo.BatchGet(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	var pipe redis.Pipeliner
+	if s.cache != nil {
+		pipe = s.cache.Pipeline()
+	}
+	for _, id := range missing {
+		c := &dto.RelationCounts{UserID: id}
+		if row, ok := rows[id]; ok {
+			c.FollowingCount = row.FollowingCount
+			c.FollowerCount = row.FollowerCount
+		}
+		res[id] = c
+		if pipe != nil {
+			if payload, err := json.Marshal(c); err == nil {
+				pipe.Set(ctx, countCacheKey(id), payload, s.ttl)
+			}
+		}
+	}
+	if pipe != nil {
+		_, _ = pipe.Exec(ctx)
+	}
+	return res, nil
+}
+
+func (s *relationCountService) Invalidate(ctx context.Context, userIDs ...string) {
+	if s.cache == nil || len(userIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = countCacheKey(id)
+	}
+	if err := s.cache.Del(ctx, keys...).Err(); err != nil {
+		logger.Warn("invalidate relation counts failed", zap.Strings("users", userIDs), zap.Error(err))
+	}
+}
+
+// RelationCountReconciler 周期性地从 follows / fans 重新统计计数，修正增量维护的误差
+// （如 replicator 死信、历史数据）；统计期间并发提交的增量不会被覆盖，fans 冗余尚未追上的用户暂不修正粉丝数
+type RelationCountReconciler struct {
+	db        *gorm.DB
+	repo      repository.RelationCountRepository
+	counts    RelationCountService
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelationCountReconciler(db *gorm.DB, repo repository.RelationCountRepository, counts RelationCountService, interval time.Duration, batchSize int) *RelationCountReconciler {
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultReconcileBatchSize
+	}
+	return &RelationCountReconciler{db: db, repo: repo, counts: counts, interval: interval, batchSize: batchSize}
+}
+
+// Start 启动后台对账；返回停止函数，等待当前一轮结束或直到 ctx 超时
+func (r *RelationCountReconciler) Start() func(context.Context) error {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := r.RunOnce(context.Background())
+				if err != nil {
+					logger.Error("relation count reconcile failed", zap.Error(err))
+					continue
+				}
+				if changed > 0 {
+					logger.Info("relation counts reconciled", zap.Int("changed", changed))
+				}
+			}
+		}
+	}()
+	return func(ctx context.Context) error {
+		close(stop)
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// RunOnce 按用户 ID 分批完整对账一轮，返回被修正的用户数
+func (r *RelationCountReconciler) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+	lastID := ""
+	for {
+		var ids []string
+		if err := r.db.WithContext(ctx).Model(&model.User{}).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(r.batchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		lastID = ids[len(ids)-1]
+
+		changed, err := r.repo.Recompute(ctx, ids)
+		if err != nil {
+			return total, err
+		}
+		if r.counts != nil {
+			r.counts.Invalidate(ctx, changed...)
+		}
+		total += len(changed)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func TestRelationCountsCacheAndReconcile(t *testing.T) {
+	db := setupReplicatorDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, db.Create(&model.User{ID: id, Username: id, Email: id + "@example.com", Password: "p"}).Error)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	countRepo := repository.NewRelationCountRepository(db)
+	counts := NewRelationCountService(countRepo, rdb, 0)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	rel := NewRelationshipService(followRepo, fanRepo, nil, counts, nil, nil, nil)
+
+	// 先读一次把 0 写入缓存，关注后应被失效
+	c, err := rel.GetCounts(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), c.FollowingCount)
+	assert.True(t, mr.Exists(countCacheKey("a")))
+
+	require.NoError(t, rel.Follow(ctx, "a", "b"))
+	assert.False(t, mr.Exists(countCacheKey("a")))
+	c, err = rel.GetCounts(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.FollowingCount)
+
+	// 直接改库制造漂移：缓存仍是旧值，对账后修正并失效缓存
+	require.NoError(t, db.Model(&model.RelationCount{}).Where("user_id = ?", "a").Update("following_count", 5).Error)
+	c, err = rel.GetCounts(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.FollowingCount)
+
+	reconciler := NewRelationCountReconciler(db, countRepo, counts, 0, 1)
+	changed, err := reconciler.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	assert.False(t, mr.Exists(countCacheKey("a")))
+
+	batch, err := counts.BatchGetCounts(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), batch["a"].FollowingCount)
+	// fans 尚未由 replicator 写入，粉丝数仍为 0
+	assert.Equal(t, int64(0), batch["b"].FollowerCount)
+}
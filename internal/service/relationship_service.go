@@ -4,11 +4,36 @@ import (
     "context"
     "errors"
 
+    "go.uber.org/zap"
+
+    "github.com/d60-Lab/gin-template/internal/dto"
     "github.com/d60-Lab/gin-template/internal/repository"
+    "github.com/d60-Lab/gin-template/pkg/logger"
 )
 
 var (
-    ErrFollowSelf = errors.New("cannot follow self")
+    ErrFollowSelf           = errors.New("cannot follow self")
+    ErrTooManyTargets       = errors.New("too many targets")
+    ErrEmptyTarget          = errors.New("target user is required")
+    ErrCountsUnavailable    = errors.New("relation counts unavailable")
+    ErrBlocked              = repository.ErrBlocked
+    ErrBlockSelf            = errors.New("cannot block self")
+    ErrMuteSelf             = errors.New("cannot mute self")
+    ErrTooManyMutes         = errors.New("too many muted users")
+    ErrBlockMuteUnavailable = errors.New("block/mute not configured")
+)
+
+const (
+    // MaxRelationTargets 批量关系查询一次最多的目标数
+    MaxRelationTargets = 100
+    // MaxRelationListLimit 共同关注 / 好友 / 推荐列表单次最多返回的条数
+    MaxRelationListLimit = 100
+    // maxRecommendSources 推荐时最多从最近关注的多少人出发做二度扩展
+    maxRecommendSources = 500
+    // maxRecommendPerSource 二度扩展时每个来源只看其最近关注的多少人，避免来源中的大 V 放大扫描量
+    maxRecommendPerSource = 200
+    // MaxMutes 每个用户最多屏蔽的人数（时间线读取时会整体加载屏蔽列表）
+    MaxMutes = 1000
 )
 
 // RelationshipService 关系链服务
@@ -17,27 +42,79 @@ type RelationshipService interface {
     Unfollow(ctx context.Context, fromUserID, toUserID string) error
     ListFollowing(ctx context.Context, userID string, page, pageSize int) ([]string, error)
     ListFans(ctx context.Context, userID string, page, pageSize int) ([]string, error)
+    // ListFollowingByCursor / ListFansByCursor 基于 seek 游标分页，cursor 为空表示第一页，返回的 nextCursor 为空表示没有更多；
+    // limit 经 ClampRelationLimit 限制
+    ListFollowingByCursor(ctx context.Context, userID, cursor string, limit int) ([]string, string, error)
+    ListFansByCursor(ctx context.Context, userID, cursor string, limit int) ([]string, string, error)
+    // GetRelation 查询 a 与 b 的关系（a 视角），b 为空时返回 ErrEmptyTarget
+    GetRelation(ctx context.Context, a, b string) (*dto.RelationStatus, error)
+    // BatchGetRelations 批量查询 viewer 与 targets 的关系，结果按 targets 顺序返回（去重），最多 MaxRelationTargets 个
+    BatchGetRelations(ctx context.Context, viewer string, targets []string) ([]*dto.RelationStatus, error)
+    // GetCounts 查询关注数与粉丝数
+    GetCounts(ctx context.Context, userID string) (*dto.RelationCounts, error)
+    // ListMutuals a 与 b 的共同关注，最多 MaxRelationListLimit 个
+    ListMutuals(ctx context.Context, a, b string, limit int) ([]string, error)
+    // ListFriends 互相关注的好友，游标语义同 ListFollowingByCursor；一页可能不足 limit，以 nextCursor 判断是否结束
+    ListFriends(ctx context.Context, userID, cursor string, limit int) ([]string, string, error)
+    // RecommendUsers 可能认识的人：基于二度关注按重合度排序
+    RecommendUsers(ctx context.Context, userID string, limit int) ([]*dto.RecommendedUser, error)
+    // Block 拉黑并解除双方的关注关系；此后任一方向的 Follow 返回 ErrBlocked
+    Block(ctx context.Context, blockerID, blockedID string) error
+    Unblock(ctx context.Context, blockerID, blockedID string) error
+    // Mute 屏蔽某作者：不影响关注，扇出与时间线读取跳过其帖子
+    Mute(ctx context.Context, userID, mutedID string) error
+    Unmute(ctx context.Context, userID, mutedID string) error
+}
+
+// FollowerCache 粉丝列表缓存（由 cacheperf.FollowerService 实现）：/fans 的 offset 分页优先读它，
+// 关注变化与资料变更时增量维护；维护失败只记日志，缓存随 TTL 过期自愈
+type FollowerCache interface {
+    FetchFollowerIDs(ctx context.Context, userID string, page, size int) ([]string, error)
+    OnFollow(ctx context.Context, userID, fanID string) error
+    OnUnfollow(ctx context.Context, userID, fanID string) error
+    InvalidateUser(ctx context.Context, userID string) error
+    InvalidateFollowers(ctx context.Context, userID string) error
 }
 
 type relationshipService struct {
     followRepo  repository.FollowRepository
     fanRepo     repository.FanRepository
     replicator  *FanReplicator
+    counts      RelationCountService
+    blockRepo   repository.BlockRepository
+    muteRepo    repository.MuteRepository
+    followers   FollowerCache
 }
 
-func NewRelationshipService(followRepo repository.FollowRepository, fanRepo repository.FanRepository, replicator *FanReplicator) RelationshipService {
-    return &relationshipService{followRepo: followRepo, fanRepo: fanRepo, replicator: replicator}
+// NewRelationshipService 创建关系链服务；followers 为 nil 时粉丝列表直接读 fans 表
+func NewRelationshipService(followRepo repository.FollowRepository, fanRepo repository.FanRepository, replicator *FanReplicator, counts RelationCountService, blockRepo repository.BlockRepository, muteRepo repository.MuteRepository, followers FollowerCache) RelationshipService {
+    return &relationshipService{followRepo: followRepo, fanRepo: fanRepo, replicator: replicator, counts: counts, blockRepo: blockRepo, muteRepo: muteRepo, followers: followers}
 }
 
 func (s *relationshipService) Follow(ctx context.Context, fromUserID, toUserID string) error {
     if fromUserID == toUserID {
         return ErrFollowSelf
     }
+    // 前置检查尽早拒绝；单库 followRepo 还会在插入语句内复查，分库的 follows 与 blocks 不同库只靠这里
+    if s.blockRepo != nil {
+        blocked, err := s.blockRepo.IsBlocked(ctx, fromUserID, toUserID)
+        if err != nil { return err }
+        if blocked { return ErrBlocked }
+    }
+    // follows 与 relation_events 同事务写入，这里只唤醒 replicator 降低冗余延迟
     if err := s.followRepo.Create(ctx, fromUserID, toUserID); err != nil {
         return err
     }
+    // 关注数随 follows 同事务更新；粉丝数由 replicator 落 fans 后失效
+    if s.counts != nil { s.counts.Invalidate(ctx, fromUserID) }
+    // 粉丝列表缓存直接随 follows 更新，不等 fans 冗余落库
+    if s.followers != nil {
+        if err := s.followers.OnFollow(ctx, toUserID, fromUserID); err != nil {
+            logger.Warn("update follower cache failed", zap.String("user", toUserID), zap.String("fan", fromUserID), zap.Error(err))
+        }
+    }
     if s.replicator != nil {
-        s.replicator.EnqueueAdd(toUserID, fromUserID)
+        s.replicator.Notify()
     }
     return nil
 }
@@ -46,8 +123,14 @@ func (s *relationshipService) Unfollow(ctx context.Context, fromUserID, toUserID
     if err := s.followRepo.Delete(ctx, fromUserID, toUserID); err != nil {
         return err
     }
+    if s.counts != nil { s.counts.Invalidate(ctx, fromUserID) }
+    if s.followers != nil {
+        if err := s.followers.OnUnfollow(ctx, toUserID, fromUserID); err != nil {
+            logger.Warn("update follower cache failed", zap.String("user", toUserID), zap.String("fan", fromUserID), zap.Error(err))
+        }
+    }
     if s.replicator != nil {
-        s.replicator.EnqueueRemove(toUserID, fromUserID)
+        s.replicator.Notify()
     }
     return nil
 }
@@ -66,6 +149,9 @@ func (s *relationshipService) ListFollowing(ctx context.Context, userID string,
 func (s *relationshipService) ListFans(ctx context.Context, userID string, page, pageSize int) ([]string, error) {
     if page < 1 { page = 1 }
     if pageSize < 1 { pageSize = 10 }
+    if s.followers != nil {
+        return s.followers.FetchFollowerIDs(ctx, userID, page, pageSize)
+    }
     offset := (page - 1) * pageSize
     items, err := s.fanRepo.ListFans(ctx, userID, offset, pageSize)
     if err != nil { return nil, err }
@@ -73,3 +159,145 @@ func (s *relationshipService) ListFans(ctx context.Context, userID string, page,
     for i, it := range items { res[i] = it.FanID }
     return res, nil
 }
+
+func (s *relationshipService) ListFollowingByCursor(ctx context.Context, userID, cursor string, limit int) ([]string, string, error) {
+    after, err := repository.DecodeCursor(cursor)
+    if err != nil { return nil, "", err }
+    items, next, err := s.followRepo.ListFollowingsAfter(ctx, userID, after, ClampRelationLimit(limit))
+    if err != nil { return nil, "", err }
+    res := make([]string, len(items))
+    for i, it := range items { res[i] = it.FolloweeID }
+    return res, encodeNextCursor(next), nil
+}
+
+func (s *relationshipService) ListFansByCursor(ctx context.Context, userID, cursor string, limit int) ([]string, string, error) {
+    after, err := repository.DecodeCursor(cursor)
+    if err != nil { return nil, "", err }
+    items, next, err := s.fanRepo.ListFansAfter(ctx, userID, after, ClampRelationLimit(limit))
+    if err != nil { return nil, "", err }
+    res := make([]string, len(items))
+    for i, it := range items { res[i] = it.FanID }
+    return res, encodeNextCursor(next), nil
+}
+
+func (s *relationshipService) GetRelation(ctx context.Context, a, b string) (*dto.RelationStatus, error) {
+    if b == "" { return nil, ErrEmptyTarget }
+    res, err := s.BatchGetRelations(ctx, a, []string{b})
+    if err != nil { return nil, err }
+    return res[0], nil
+}
+
+func (s *relationshipService) BatchGetRelations(ctx context.Context, viewer string, targets []string) ([]*dto.RelationStatus, error) {
+    uniq := make([]string, 0, len(targets))
+    seen := make(map[string]struct{}, len(targets))
+    for _, t := range targets {
+        if t == "" { continue }
+        if _, ok := seen[t]; ok { continue }
+        seen[t] = struct{}{}
+        uniq = append(uniq, t)
+    }
+    if len(uniq) > MaxRelationTargets { return nil, ErrTooManyTargets }
+
+    edges, err := s.followRepo.ListBetween(ctx, viewer, uniq)
+    if err != nil { return nil, err }
+    following := make(map[string]bool, len(edges))
+    followedBy := make(map[string]bool, len(edges))
+    for _, e := range edges {
+        if e.FollowerID == viewer { following[e.FolloweeID] = true }
+        if e.FolloweeID == viewer { followedBy[e.FollowerID] = true }
+    }
+
+    res := make([]*dto.RelationStatus, len(uniq))
+    for i, t := range uniq {
+        res[i] = &dto.RelationStatus{
+            UserID:     t,
+            Following:  following[t],
+            FollowedBy: followedBy[t],
+            Mutual:     following[t] && followedBy[t],
+        }
+    }
+    return res, nil
+}
+
+func (s *relationshipService) GetCounts(ctx context.Context, userID string) (*dto.RelationCounts, error) {
+    if s.counts == nil { return nil, ErrCountsUnavailable }
+    return s.counts.GetCounts(ctx, userID)
+}
+
+func (s *relationshipService) ListMutuals(ctx context.Context, a, b string, limit int) ([]string, error) {
+    limit = ClampRelationLimit(limit)
+    if a == b { return s.listFollowingIDs(ctx, a, limit) }
+    return s.followRepo.ListCommonFollowings(ctx, a, b, limit)
+}
+
+// listFollowingIDs a == b 时共同关注即其关注列表，直接取首页
+func (s *relationshipService) listFollowingIDs(ctx context.Context, userID string, limit int) ([]string, error) {
+    items, _, err := s.followRepo.ListFollowingsAfter(ctx, userID, nil, limit)
+    if err != nil { return nil, err }
+    res := make([]string, len(items))
+    for i, it := range items { res[i] = it.FolloweeID }
+    return res, nil
+}
+
+func (s *relationshipService) ListFriends(ctx context.Context, userID, cursor string, limit int) ([]string, string, error) {
+    after, err := repository.DecodeCursor(cursor)
+    if err != nil { return nil, "", err }
+    items, next, err := s.followRepo.ListFriendsAfter(ctx, userID, after, ClampRelationLimit(limit))
+    if err != nil { return nil, "", err }
+    res := make([]string, len(items))
+    for i, it := range items { res[i] = it.FolloweeID }
+    return res, encodeNextCursor(next), nil
+}
+
+func (s *relationshipService) RecommendUsers(ctx context.Context, userID string, limit int) ([]*dto.RecommendedUser, error) {
+    rows, err := s.followRepo.ListSecondDegree(ctx, userID, maxRecommendSources, maxRecommendPerSource, ClampRelationLimit(limit))
+    if err != nil { return nil, err }
+    res := make([]*dto.RecommendedUser, len(rows))
+    for i, r := range rows { res[i] = &dto.RecommendedUser{UserID: r.UserID, Overlap: r.Overlap} }
+    return res, nil
+}
+
+func (s *relationshipService) Block(ctx context.Context, blockerID, blockedID string) error {
+    if blockerID == blockedID { return ErrBlockSelf }
+    if s.blockRepo == nil { return ErrBlockMuteUnavailable }
+    // 先落拉黑记录再解除关注：拉黑提交后才执行插入的 Follow 会被 follows 插入语句拒绝，此前已提交的关注边由这里删除；
+    // 插入早于拉黑提交、而事务提交晚于这里删除的 Follow 仍可能留下关注边
+    if err := s.blockRepo.Create(ctx, blockerID, blockedID); err != nil { return err }
+    if err := s.Unfollow(ctx, blockerID, blockedID); err != nil { return err }
+    return s.Unfollow(ctx, blockedID, blockerID)
+}
+
+func (s *relationshipService) Unblock(ctx context.Context, blockerID, blockedID string) error {
+    if s.blockRepo == nil { return ErrBlockMuteUnavailable }
+    return s.blockRepo.Delete(ctx, blockerID, blockedID)
+}
+
+func (s *relationshipService) Mute(ctx context.Context, userID, mutedID string) error {
+    if userID == mutedID { return ErrMuteSelf }
+    if s.muteRepo == nil { return ErrBlockMuteUnavailable }
+    // 已屏蔽时幂等返回，不受上限影响
+    exists, err := s.muteRepo.Exists(ctx, userID, mutedID)
+    if err != nil { return err }
+    if exists { return nil }
+    cnt, err := s.muteRepo.Count(ctx, userID)
+    if err != nil { return err }
+    if cnt >= MaxMutes { return ErrTooManyMutes }
+    return s.muteRepo.Create(ctx, userID, mutedID)
+}
+
+func (s *relationshipService) Unmute(ctx context.Context, userID, mutedID string) error {
+    if s.muteRepo == nil { return ErrBlockMuteUnavailable }
+    return s.muteRepo.Delete(ctx, userID, mutedID)
+}
+
+// ClampRelationLimit 列表类接口的每页数量：默认 20，最多 MaxRelationListLimit；handler 用它回显实际生效的 page_size
+func ClampRelationLimit(limit int) int {
+    if limit < 1 { return 20 }
+    if limit > MaxRelationListLimit { return MaxRelationListLimit }
+    return limit
+}
+
+func encodeNextCursor(c *repository.Cursor) string {
+    if c == nil { return "" }
+    return c.Encode()
+}
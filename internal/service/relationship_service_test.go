@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func TestBlockRemovesFollowsAndRejectsFollow(t *testing.T) {
+	db := setupReplicatorDB(t)
+	require.NoError(t, db.AutoMigrate(&model.Block{}, &model.Mute{}))
+	followRepo := repository.NewFollowRepository(db)
+	rel := NewRelationshipService(followRepo, repository.NewFanRepository(db), nil, nil,
+		repository.NewBlockRepository(db), repository.NewMuteRepository(db), nil)
+	ctx := context.Background()
+
+	require.NoError(t, rel.Follow(ctx, "a", "b"))
+	require.NoError(t, rel.Follow(ctx, "b", "a"))
+	require.NoError(t, rel.Block(ctx, "a", "b"))
+
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		exists, err := followRepo.Exists(ctx, pair[0], pair[1])
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.ErrorIs(t, rel.Follow(ctx, pair[0], pair[1]), ErrBlocked)
+	}
+	assert.ErrorIs(t, rel.Block(ctx, "a", "a"), ErrBlockSelf)
+
+	require.NoError(t, rel.Unblock(ctx, "a", "b"))
+	assert.NoError(t, rel.Follow(ctx, "b", "a"))
+}
+
+func TestMuteLimit(t *testing.T) {
+	db := setupReplicatorDB(t)
+	require.NoError(t, db.AutoMigrate(&model.Mute{}))
+	muteRepo := repository.NewMuteRepository(db)
+	rel := NewRelationshipService(repository.NewFollowRepository(db), repository.NewFanRepository(db), nil, nil, nil, muteRepo, nil)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, rel.Mute(ctx, "a", "a"), ErrMuteSelf)
+	require.NoError(t, rel.Mute(ctx, "a", "b"))
+	require.NoError(t, rel.Mute(ctx, "a", "b"))
+	muted, err := muteRepo.ListMuted(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, muted)
+
+	mutedBy, err := muteRepo.ListMutedBy(ctx, "b", []string{"a", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, mutedBy)
+
+	// 达到上限后不能新增，但重复屏蔽已屏蔽的人仍然成功
+	for i := 1; i < MaxMutes; i++ {
+		require.NoError(t, muteRepo.Create(ctx, "a", fmt.Sprintf("m%d", i)))
+	}
+	assert.ErrorIs(t, rel.Mute(ctx, "a", "c"), ErrTooManyMutes)
+	assert.NoError(t, rel.Mute(ctx, "a", "b"))
+}
+
+func TestBlockMuteUnavailable(t *testing.T) {
+	db := setupReplicatorDB(t)
+	rel := NewRelationshipService(repository.NewFollowRepository(db), repository.NewFanRepository(db), nil, nil, nil, nil, nil)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, rel.Block(ctx, "a", "b"), ErrBlockMuteUnavailable)
+	assert.ErrorIs(t, rel.Unblock(ctx, "a", "b"), ErrBlockMuteUnavailable)
+	assert.ErrorIs(t, rel.Mute(ctx, "a", "b"), ErrBlockMuteUnavailable)
+	assert.ErrorIs(t, rel.Unmute(ctx, "a", "b"), ErrBlockMuteUnavailable)
+}
+
+func TestCursorListsClampLimit(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	rel := NewRelationshipService(followRepo, repository.NewFanRepository(db), nil, nil, nil, nil, nil)
+	ctx := context.Background()
+	for i := 0; i <= MaxRelationListLimit; i++ {
+		require.NoError(t, followRepo.Create(ctx, "a", fmt.Sprintf("u%03d", i)))
+	}
+
+	list, next, err := rel.ListFollowingByCursor(ctx, "a", "", 100000)
+	require.NoError(t, err)
+	assert.Len(t, list, MaxRelationListLimit)
+	assert.NotEmpty(t, next)
+	list, next, err = rel.ListFollowingByCursor(ctx, "a", next, 100000)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Empty(t, next)
+	assert.Equal(t, 20, ClampRelationLimit(0))
+}
+
+func TestGetRelation(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	rel := NewRelationshipService(followRepo, repository.NewFanRepository(db), nil, nil, nil, nil, nil)
+	ctx := context.Background()
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+
+	st, err := rel.GetRelation(ctx, "a", "b")
+	require.NoError(t, err)
+	assert.True(t, st.Following)
+	assert.False(t, st.FollowedBy)
+
+	_, err = rel.GetRelation(ctx, "a", "")
+	assert.ErrorIs(t, err, ErrEmptyTarget)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/eventbus"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const (
+	// FanoutTopic 帖子扇出事件的 topic（Redis Streams 下即 stream key）
+	FanoutTopic = "fanout:outbox"
+	// FanoutConsumerGroup 写 inbox 的消费组
+	FanoutConsumerGroup = "fanout-inbox"
+)
+
+// fanoutEvent 投递到总线的扇出事件；消费者按 OutboxID 读取最新的行（断点、尝试次数）再扇出
+type fanoutEvent struct {
+	OutboxID  string    `json:"outbox_id"`
+	PostID    string    `json:"post_id"`
+	AuthorID  string    `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboxRelay 把已提交的 outbox 行转发到事件总线，由总线消费者写 inbox，扇出可独立于数据库扩容。
+// 领取时置为 processing 并设置租约，消费者完成后置为 done；消息丢失或消费者崩溃时租约到期，
+// 行被放回 pending 并重新发布，因此投递为至少一次，依赖 inbox 写入幂等。
+type OutboxRelay struct {
+	outbox       repository.OutboxRepository
+	bus          eventbus.EventBus
+	topic        string
+	claimLimit   int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	wakeCh       chan struct{}
+}
+
+func NewOutboxRelay(db *gorm.DB, bus eventbus.EventBus, claimLimit int, pollInterval time.Duration) *OutboxRelay {
+	if claimLimit <= 0 {
+		claimLimit = 128
+	}
+	if pollInterval <= 0 {
+		pollInterval = 50 * time.Millisecond
+	}
+	return &OutboxRelay{
+		outbox: repository.NewOutboxRepository(db), bus: bus, topic: FanoutTopic,
+		claimLimit: claimLimit, pollInterval: pollInterval,
+		lease: defaultFanoutLease, maxAttempts: defaultFanoutMaxAttempts,
+		wakeCh: make(chan struct{}, 1),
+	}
+}
+
+// WithRetryPolicy 设置最大尝试次数与租约（需在 Start 前调用），非正数保持默认值。
+// lease 需覆盖总线积压时间加单条扇出耗时，否则消费中的行会被重复发布。
+func (r *OutboxRelay) WithRetryPolicy(maxAttempts int, lease time.Duration) *OutboxRelay {
+	if maxAttempts > 0 {
+		r.maxAttempts = maxAttempts
+	}
+	if lease > 0 {
+		r.lease = lease
+	}
+	return r
+}
+
+// Notify 立即唤醒转发（如收到 Postgres NOTIFY）
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动转发与租约回收；返回停止函数，等待当前批次结束或直到 ctx 超时
+func (r *OutboxRelay) Start() func(context.Context) error {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); r.loop(stop) }()
+	go func() { defer wg.Done(); r.reapLoop(stop) }()
+	return func(ctx context.Context) error {
+		close(stop)
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *OutboxRelay) loop(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-r.wakeCh:
+		}
+		for {
+			n, err := r.RunOnce(context.Background())
+			if err != nil {
+				logger.Warn("outbox relay failed", zap.Error(err))
+				break
+			}
+			if n == 0 {
+				break
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+func (r *OutboxRelay) reapLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.lease / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n, err := r.outbox.ReleaseExpired(context.Background(), r.maxAttempts)
+			if err != nil {
+				logger.Error("outbox relay release expired failed", zap.Error(err))
+			} else if n > 0 {
+				logger.Warn("outbox relay released expired claims", zap.Int64("rows", n))
+			}
+		}
+	}
+}
+
+// RunOnce 领取一批 pending 行并发布到总线，返回领取的行数。
+// 发布失败时整批按退避放回 pending，达到最大次数的置为 failed。
+func (r *OutboxRelay) RunOnce(ctx context.Context) (int, error) {
+	batch, err := r.outbox.Claim(ctx, r.claimLimit, r.lease)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+	return len(batch), r.publish(ctx, batch)
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, batch []*model.Outbox) error {
+	msgs := make([]eventbus.Message, 0, len(batch))
+	for _, b := range batch {
+		payload, err := json.Marshal(fanoutEvent{OutboxID: b.ID, PostID: b.PostID, AuthorID: b.AuthorID, CreatedAt: b.CreatedAt})
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, eventbus.Message{Key: b.AuthorID, Payload: payload})
+	}
+	err := r.bus.Publish(ctx, r.topic, msgs...)
+	if err == nil {
+		return nil
+	}
+	for _, b := range batch {
+		if b.Attempts >= r.maxAttempts {
+			_ = r.outbox.MarkFailed(ctx, b.ID, b.Attempts, err.Error())
+			continue
+		}
+		_ = r.outbox.MarkRetry(ctx, b.ID, b.Attempts, time.Now().Add(fanoutBackoff(b.Attempts)), err.Error())
+	}
+	return err
+}
+
+// HandleEvent 总线消费者：按事件读取 outbox 当前行后扇出。
+// 只处理 processing 的行，其余（已完成、已失败、租约到期后放回 pending 等待重新发布）直接确认；
+// 扇出失败的重试与死信仍记录在 outbox 上，因此只有读库失败时才让总线重新投递。
+func (w *FanoutWorker) HandleEvent(ctx context.Context, msg *eventbus.Message) error {
+	var ev fanoutEvent
+	if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+		logger.Warn("fanout drop malformed event", zap.String("id", msg.ID), zap.Error(err))
+		return nil
+	}
+	b, err := w.outbox.Get(ctx, ev.OutboxID)
+	if err != nil {
+		return err
+	}
+	if b == nil || b.Status != model.OutboxProcessing {
+		return nil
+	}
+	w.handle(ctx, b)
+	return nil
+}
+
+// StartConsumers 启动 workers 个总线消费者替代轮询 outbox（需配合 OutboxRelay）；返回停止函数。
+// 分片需要轮询领取，总线模式下不切分。
+func (w *FanoutWorker) StartConsumers(bus eventbus.EventBus, topic, group string) func(context.Context) error {
+	w.shardSize = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	// 停止时只停止拉取新消息，正在处理的事件用独立 ctx 跑完
+	handler := func(_ context.Context, msg *eventbus.Message) error { return w.HandleEvent(context.Background(), msg) }
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := bus.Subscribe(ctx, topic, group, handler); err != nil {
+				logger.Error("fanout consumer stopped", zap.String("topic", topic), zap.Error(err))
+			}
+		}()
+	}
+	return func(stopCtx context.Context) error {
+		cancel()
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}
+}
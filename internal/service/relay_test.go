@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/eventbus"
+)
+
+func TestRelayPublishesAndConsumersFanout(t *testing.T) {
+	db := setupTimelineDB(t)
+	// 消费者在其他 goroutine 中读写，:memory: 库必须共用同一个连接
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	seedFans(t, db, "author", 5)
+	ctx := context.Background()
+
+	bus := eventbus.NewMemory()
+	relay := NewOutboxRelay(db, bus, 0, 0)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 2, 2, 0, 0)
+	stop := w.StartConsumers(bus, FanoutTopic, FanoutConsumerGroup)
+	defer func() { _ = stop(ctx) }()
+
+	// 第二条在发布前已完成（例如租约到期后被重新发布），消费者应跳过
+	require.NoError(t, relay.publish(ctx, []*model.Outbox{
+		claimedOutbox(t, db, "o1", "author", 1),
+		claimedOutbox(t, db, "o2", "author", 1),
+	}))
+	require.NoError(t, db.Model(&model.Outbox{}).Where("id = ?", "o2").Update("status", model.OutboxDone).Error)
+
+	require.Eventually(t, func() bool {
+		return bus.Pending(FanoutTopic, FanoutConsumerGroup) == 0 && loadOutbox(t, db, "o1").Status == model.OutboxDone
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(5), countInbox(t, db, "p-o1"))
+	assert.Equal(t, int64(0), countInbox(t, db, "p-o2"))
+}
+
+func TestRelayPublishFailureRetries(t *testing.T) {
+	db := setupTimelineDB(t)
+	ctx := context.Background()
+	bus := eventbus.NewMemory()
+	require.NoError(t, bus.Close())
+	relay := NewOutboxRelay(db, bus, 0, 0).WithRetryPolicy(2, 0)
+
+	before := time.Now()
+	err := relay.publish(ctx, []*model.Outbox{
+		claimedOutbox(t, db, "o1", "author", 1),
+		claimedOutbox(t, db, "o2", "author", 2),
+	})
+	assert.ErrorIs(t, err, eventbus.ErrClosed)
+
+	ob := loadOutbox(t, db, "o1")
+	assert.Equal(t, model.OutboxPending, ob.Status)
+	assert.True(t, ob.NextAttemptAt.After(before))
+	assert.Equal(t, model.OutboxFailed, loadOutbox(t, db, "o2").Status)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+const (
+	defaultCheckBatch = 1000
+	maxDriftSamples   = 20
+)
+
+// RelationPair 一条粉丝关系：fans(user_id, fan_id) 对应 follows(follower_id=fan_id, followee_id=user_id)
+type RelationPair struct {
+	UserID string `json:"user_id"`
+	FanID  string `json:"fan_id"`
+}
+
+// RelationCheckReport follows 与 fans 一致性校验结果（直接输出为 JSON 供告警使用）
+type RelationCheckReport struct {
+	UserID         string         `json:"user_id,omitempty"` // 为空表示全量校验
+	Repair         bool           `json:"repair"`
+	ScannedFollows int64          `json:"scanned_follows"`
+	ScannedFans    int64          `json:"scanned_fans"`
+	MissingFans    int64          `json:"missing_fans"` // follows 中存在而 fans 缺失
+	OrphanFans     int64          `json:"orphan_fans"`  // fans 中存在而 follows 已不存在
+	RepairedAdd    int64          `json:"repaired_add"`
+	RepairedDelete int64          `json:"repaired_delete"`
+	PendingEvents  int64          `json:"pending_events"` // 尚未被 replicator 消费的事件，存在时少量漂移属正常
+	MissingSamples []RelationPair `json:"missing_samples,omitempty"`
+	OrphanSamples  []RelationPair `json:"orphan_samples,omitempty"`
+	StartedAt      time.Time      `json:"started_at"`
+	DurationMs     int64          `json:"duration_ms"`
+}
+
+// Drift 漂移总数
+func (r *RelationCheckReport) Drift() int64 { return r.MissingFans + r.OrphanFans }
+
+// RelationChecker 比对 follows 与 fans 冗余表，可选幂等修复
+type RelationChecker struct {
+	db         *gorm.DB
+	followRepo repository.FollowRepository
+	fanRepo    repository.FanRepository
+	events     repository.RelationEventRepository
+	batchSize  int
+}
+
+func NewRelationChecker(db *gorm.DB, followRepo repository.FollowRepository, fanRepo repository.FanRepository, events repository.RelationEventRepository, batchSize int) *RelationChecker {
+	if batchSize <= 0 {
+		batchSize = defaultCheckBatch
+	}
+	return &RelationChecker{db: db, followRepo: followRepo, fanRepo: fanRepo, events: events, batchSize: batchSize}
+}
+
+// CheckAll 分批全量比对两张表
+func (c *RelationChecker) CheckAll(ctx context.Context, repair bool) (*RelationCheckReport, error) {
+	report := &RelationCheckReport{Repair: repair, StartedAt: time.Now()}
+	noScope := func(q *gorm.DB) *gorm.DB { return q }
+	return c.run(ctx, report, noScope, noScope)
+}
+
+// CheckUser 只比对与某个用户相关的关系（他的粉丝与他的关注）
+func (c *RelationChecker) CheckUser(ctx context.Context, userID string, repair bool) (*RelationCheckReport, error) {
+	report := &RelationCheckReport{UserID: userID, Repair: repair, StartedAt: time.Now()}
+	followScope := func(q *gorm.DB) *gorm.DB {
+		return q.Where("(followee_id = ? OR follower_id = ?)", userID, userID)
+	}
+	fanScope := func(q *gorm.DB) *gorm.DB {
+		return q.Where("(user_id = ? OR fan_id = ?)", userID, userID)
+	}
+	return c.run(ctx, report, followScope, fanScope)
+}
+
+func (c *RelationChecker) run(ctx context.Context, report *RelationCheckReport, followScope, fanScope func(*gorm.DB) *gorm.DB) (*RelationCheckReport, error) {
+	if err := c.scanFollows(ctx, report, followScope); err != nil {
+		return nil, err
+	}
+	if err := c.scanFans(ctx, report, fanScope); err != nil {
+		return nil, err
+	}
+	if c.events != nil {
+		pending, err := c.events.CountPending(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.PendingEvents = pending
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// scanFollows 按主键分批扫描 follows，找出 fans 中缺失的关系
+func (c *RelationChecker) scanFollows(ctx context.Context, report *RelationCheckReport, scope func(*gorm.DB) *gorm.DB) error {
+	lastID := ""
+	for {
+		var batch []*model.Follow
+		q := scope(c.db.WithContext(ctx).Model(&model.Follow{})).Where("id > ?", lastID)
+		if err := q.Order("id").Limit(c.batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+		report.ScannedFollows += int64(len(batch))
+
+		pairs := make([][]interface{}, len(batch))
+		for i, f := range batch {
+			pairs[i] = []interface{}{f.FolloweeID, f.FollowerID}
+		}
+		var present []RelationPair
+		if err := c.db.WithContext(ctx).Model(&model.Fan{}).
+			Select("user_id, fan_id").
+			Where("(user_id, fan_id) IN ?", pairs).
+			Scan(&present).Error; err != nil {
+			return err
+		}
+		seen := make(map[RelationPair]struct{}, len(present))
+		for _, p := range present {
+			seen[p] = struct{}{}
+		}
+
+		for _, f := range batch {
+			p := RelationPair{UserID: f.FolloweeID, FanID: f.FollowerID}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			report.MissingFans++
+			if len(report.MissingSamples) < maxDriftSamples {
+				report.MissingSamples = append(report.MissingSamples, p)
+			}
+			if report.Repair {
+				if err := c.repairPair(ctx, p, true, report); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// scanFans 按主键分批扫描 fans，找出 follows 中已不存在的孤儿关系
+func (c *RelationChecker) scanFans(ctx context.Context, report *RelationCheckReport, scope func(*gorm.DB) *gorm.DB) error {
+	lastID := ""
+	for {
+		var batch []*model.Fan
+		q := scope(c.db.WithContext(ctx).Model(&model.Fan{})).Where("id > ?", lastID)
+		if err := q.Order("id").Limit(c.batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+		report.ScannedFans += int64(len(batch))
+
+		pairs := make([][]interface{}, len(batch))
+		for i, f := range batch {
+			pairs[i] = []interface{}{f.FanID, f.UserID}
+		}
+		var present []struct {
+			FollowerID string
+			FolloweeID string
+		}
+		if err := c.db.WithContext(ctx).Model(&model.Follow{}).
+			Select("follower_id, followee_id").
+			Where("(follower_id, followee_id) IN ?", pairs).
+			Scan(&present).Error; err != nil {
+			return err
+		}
+		seen := make(map[RelationPair]struct{}, len(present))
+		for _, p := range present {
+			seen[RelationPair{UserID: p.FolloweeID, FanID: p.FollowerID}] = struct{}{}
+		}
+
+		for _, f := range batch {
+			p := RelationPair{UserID: f.UserID, FanID: f.FanID}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			report.OrphanFans++
+			if len(report.OrphanSamples) < maxDriftSamples {
+				report.OrphanSamples = append(report.OrphanSamples, p)
+			}
+			if report.Repair {
+				if err := c.repairPair(ctx, p, false, report); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// repairPair 修复前再次读取 follows 确认状态：若与扫描时的判断不一致（并发关注/取关），
+// 说明漂移已由 replicator 处理，跳过。写入使用 OnConflict{DoNothing} / 条件删除，可重复执行。
+func (c *RelationChecker) repairPair(ctx context.Context, p RelationPair, followExpected bool, report *RelationCheckReport) error {
+	exists, err := c.followRepo.Exists(ctx, p.FanID, p.UserID)
+	if err != nil {
+		return err
+	}
+	if exists != followExpected {
+		return nil
+	}
+	if exists {
+		if err := c.fanRepo.Create(ctx, p.UserID, p.FanID); err != nil {
+			return err
+		}
+		report.RepairedAdd++
+		return nil
+	}
+	if err := c.fanRepo.Delete(ctx, p.UserID, p.FanID); err != nil {
+		return err
+	}
+	report.RepairedDelete++
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func TestRelationCheckerFindsAndRepairsDrift(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	checker := NewRelationChecker(db, followRepo, fanRepo, repository.NewRelationEventRepository(db), 2)
+	ctx := context.Background()
+
+	// a->b 正常；a->c 缺 fans；d->b 只剩孤儿 fans
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	require.NoError(t, fanRepo.Create(ctx, "b", "a"))
+	require.NoError(t, followRepo.Create(ctx, "a", "c"))
+	require.NoError(t, fanRepo.Create(ctx, "b", "d"))
+
+	report, err := checker.CheckAll(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), report.ScannedFollows)
+	assert.Equal(t, int64(2), report.ScannedFans)
+	assert.Equal(t, int64(1), report.MissingFans)
+	assert.Equal(t, int64(1), report.OrphanFans)
+	assert.Equal(t, []RelationPair{{UserID: "c", FanID: "a"}}, report.MissingSamples)
+	assert.Equal(t, []RelationPair{{UserID: "b", FanID: "d"}}, report.OrphanSamples)
+
+	// 按用户校验只看与 c 相关的关系
+	report, err = checker.CheckUser(ctx, "c", false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.MissingFans)
+	assert.Equal(t, int64(0), report.OrphanFans)
+
+	report, err = checker.CheckAll(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.RepairedAdd)
+	assert.Equal(t, int64(1), report.RepairedDelete)
+
+	// 修复可重复执行，之后不再有漂移
+	report, err = checker.CheckAll(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), report.Drift())
+
+	var cnt int64
+	db.Model(&model.Fan{}).Count(&cnt)
+	assert.Equal(t, int64(2), cnt)
+}
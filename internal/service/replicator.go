@@ -1,109 +1,390 @@
 package service
 
 import (
-    "context"
-    "time"
+	"context"
+	"sync"
+	"time"
 
-    "go.uber.org/zap"
+	"go.uber.org/zap"
 
-    "github.com/d60-Lab/gin-template/internal/repository"
-    "github.com/d60-Lab/gin-template/pkg/logger"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/idgen"
+	"github.com/d60-Lab/gin-template/pkg/logger"
 )
 
-type replicateAction int
-
 const (
-    actionAdd replicateAction = iota + 1
-    actionRemove
+	defaultReplicatorBatch       = 256
+	defaultReplicatorPoll        = 200 * time.Millisecond
+	defaultReplicatorLease       = 30 * time.Second
+	defaultReplicatorMaxAttempts = 8
+	replicatorBaseBackoff        = time.Second
+	replicatorMaxBackoff         = 5 * time.Minute
+	// replicatorPurgeBatch 取关时每条 DELETE 清理的 inbox 行数
+	replicatorPurgeBatch = 500
+	// replicatorRetentionInterval 清理已完成事件的间隔，replicatorRetentionBatch 每条 DELETE 的行数
+	replicatorRetentionInterval = 10 * time.Minute
+	replicatorRetentionBatch    = 1000
 )
 
-type replicateJob struct {
-    action replicateAction
-    userID string
-    fanID  string
-    enqAt  time.Time
-}
-
-// FanReplicator 简单的本地异步冗余执行器（服务异步冗余）
+// FanReplicator 消费 relation_events 外发盒，把关注关系异步冗余到 fans 表（服务异步冗余），
+// 开启 WithTimeline 时顺带回填/清理关注者的时间线。
+// 事件与 follows 同事务落库，进程重启不会丢失；失败按指数退避重试，超过次数进入死信。
 type FanReplicator struct {
-    fanRepo repository.FanRepository
-    ch      chan replicateJob
-    metricsCh chan time.Duration
+	events     repository.RelationEventRepository
+	followRepo repository.FollowRepository
+	fanRepo    repository.FanRepository
+	counts     RelationCountService
+	// inbox 非空时同步时间线：关注后回填作者最近的帖子，取关后清理该作者的条目
+	inbox              repository.InboxRepository
+	posts              repository.PostRepository
+	backfillPosts      int
+	celebrityThreshold int64
+	timelineCache      *TimelineCache
+	// ids 非空时回填的 inbox 行 ID 按时间递增，否则为 uuid
+	ids *idgen.Generator
+
+	batchSize    int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	// doneRetention 已完成事件保留时长，0 表示不清理
+	doneRetention time.Duration
+
+	wakeCh    chan struct{}
+	metricsCh chan time.Duration
 }
 
-func NewFanReplicator(fanRepo repository.FanRepository, queueSize int) *FanReplicator {
-    if queueSize <= 0 {
-        queueSize = 10000
-    }
-    return &FanReplicator{fanRepo: fanRepo, ch: make(chan replicateJob, queueSize), metricsCh: make(chan time.Duration, 65536)}
+func NewFanReplicator(events repository.RelationEventRepository, followRepo repository.FollowRepository, fanRepo repository.FanRepository, batchSize, maxAttempts int, pollInterval time.Duration) *FanReplicator {
+	if batchSize <= 0 {
+		batchSize = defaultReplicatorBatch
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultReplicatorMaxAttempts
+	}
+	if pollInterval <= 0 {
+		pollInterval = defaultReplicatorPoll
+	}
+	return &FanReplicator{
+		events:       events,
+		followRepo:   followRepo,
+		fanRepo:      fanRepo,
+		batchSize:    batchSize,
+		pollInterval: pollInterval,
+		lease:        defaultReplicatorLease,
+		maxAttempts:  maxAttempts,
+		wakeCh:       make(chan struct{}, 1),
+		metricsCh:    make(chan time.Duration, 65536),
+	}
 }
 
+// Start 启动若干消费协程；返回的停止函数等待在途批次处理完，或直到 ctx 超时。
+// 未处理的事件留在表中，下次启动继续消费。
 func (r *FanReplicator) Start(workers int) func(context.Context) error {
-    if workers <= 0 {
-        workers = 4
-    }
-    stopCh := make(chan struct{})
-    for i := 0; i < workers; i++ {
-        go func() {
-            for {
-                select {
-                case job := <-r.ch:
-                    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-                    switch job.action {
-                    case actionAdd:
-                        _ = r.fanRepo.Create(ctx, job.userID, job.fanID)
-                    case actionRemove:
-                        _ = r.fanRepo.Delete(ctx, job.userID, job.fanID)
-                    }
-                    cancel()
-                    if !job.enqAt.IsZero() {
-                        select {
-                        case r.metricsCh <- time.Since(job.enqAt):
-                        default:
-                        }
-                    }
-                case <-stopCh:
-                    return
-                }
-            }
-        }()
-    }
-    return func(ctx context.Context) error {
-        close(stopCh)
-        // 等待队列自然排空一小段时间
-        timeout := time.After(2 * time.Second)
-        for {
-            select {
-            case <-timeout:
-                return nil
-            default:
-                if len(r.ch) == 0 {
-                    return nil
-                }
-                time.Sleep(50 * time.Millisecond)
-            }
-        }
-    }
-}
-
-func (r *FanReplicator) EnqueueAdd(userID, fanID string) {
-    select {
-    case r.ch <- replicateJob{action: actionAdd, userID: userID, fanID: fanID, enqAt: time.Now()}:
-    default:
-        logger.Warn("replicator queue full, drop add", zap.String("user", userID), zap.String("fan", fanID))
-    }
-}
-
-func (r *FanReplicator) EnqueueRemove(userID, fanID string) {
-    select {
-    case r.ch <- replicateJob{action: actionRemove, userID: userID, fanID: fanID, enqAt: time.Now()}:
-    default:
-        logger.Warn("replicator queue full, drop remove", zap.String("user", userID), zap.String("fan", fanID))
-    }
+	if workers <= 0 {
+		workers = 4
+	}
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(stopCh)
+		}()
+	}
+	if r.doneRetention > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.retentionLoop(stopCh)
+		}()
+	}
+	return func(ctx context.Context) error {
+		close(stopCh)
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *FanReplicator) loop(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		case <-r.wakeCh:
+		}
+		// 一直处理到没有到期事件为止，再回到等待
+		for {
+			n, err := r.processOnce(context.Background())
+			if err != nil {
+				logger.Warn("replicator claim failed", zap.Error(err))
+				break
+			}
+			if n == 0 {
+				break
+			}
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// processOnce 领取并处理一批事件，返回领取数量
+func (r *FanReplicator) processOnce(ctx context.Context) (int, error) {
+	batch, err := r.events.Claim(ctx, r.batchSize, r.lease)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+	for _, ev := range batch {
+		r.handle(ctx, ev)
+	}
+	return len(batch), nil
+}
+
+// handle 处理一条已领取的事件，ev.Attempts 已含本次领取
+func (r *FanReplicator) handle(ctx context.Context, ev *model.RelationEvent) {
+	// 之前的领取都未能结束（处理者崩溃或卡住到租约过期），不再重试
+	if ev.Attempts > r.maxAttempts {
+		logger.Error("replicator event dead-lettered after expired leases",
+			zap.String("event", ev.ID), zap.String("user", ev.UserID), zap.String("fan", ev.FanID),
+			zap.Int("attempts", ev.Attempts))
+		_ = r.events.MarkDead(ctx, ev.ID, ev.Attempts, "lease expired without completion")
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := r.apply(opCtx, ev); err != nil {
+		if ev.Attempts >= r.maxAttempts {
+			logger.Error("replicator event dead-lettered",
+				zap.String("event", ev.ID), zap.String("user", ev.UserID), zap.String("fan", ev.FanID),
+				zap.Int("attempts", ev.Attempts), zap.Error(err))
+			_ = r.events.MarkDead(ctx, ev.ID, ev.Attempts, err.Error())
+			return
+		}
+		_ = r.events.MarkRetry(ctx, ev.ID, ev.Attempts, time.Now().Add(replicatorBackoff(ev.Attempts)), err.Error())
+		return
+	}
+	// fans 变化后粉丝数随之变化，失效被关注者的计数缓存
+	if r.counts != nil {
+		r.counts.Invalidate(ctx, ev.UserID)
+	}
+	if err := r.events.MarkDone(ctx, ev.ID, ev.Attempts); err != nil {
+		// 租约到期后会被重新领取；apply 幂等，重复处理无副作用
+		logger.Warn("replicator mark done failed", zap.String("event", ev.ID), zap.Error(err))
+		return
+	}
+	select {
+	case r.metricsCh <- time.Since(ev.CreatedAt):
+	default:
+	}
+}
+
+// apply 以 follows 表为准对齐 fans 中的这一对关系（及关注者时间线），而不是机械执行 add/remove：
+// 这样重复投递、乱序投递（同一对关系先取关再关注）都能收敛到正确状态。
+func (r *FanReplicator) apply(ctx context.Context, ev *model.RelationEvent) error {
+	exists, err := r.followRepo.Exists(ctx, ev.FanID, ev.UserID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := r.fanRepo.Create(ctx, ev.UserID, ev.FanID); err != nil {
+			return err
+		}
+		return r.backfill(ctx, ev.FanID, ev.UserID)
+	}
+	if err := r.fanRepo.Delete(ctx, ev.UserID, ev.FanID); err != nil {
+		return err
+	}
+	return r.purge(ctx, ev.FanID, ev.UserID)
+}
+
+// WithTimeline 开启时间线同步：关注后把作者最近 backfillPosts 条帖子回填到关注者 inbox（0 表示不回填），
+// 取关后清理关注者 inbox 中该作者的条目。celebrityThreshold 需与 FanoutWorker 一致，大V的帖子读时拉取，不回填。
+func (r *FanReplicator) WithTimeline(inbox repository.InboxRepository, posts repository.PostRepository, backfillPosts int, celebrityThreshold int64) *FanReplicator {
+	r.inbox = inbox
+	r.posts = posts
+	r.backfillPosts = backfillPosts
+	r.celebrityThreshold = celebrityThreshold
+	return r
+}
+
+// isCelebrity 作者粉丝数是否达到阈值；配置了计数服务时读 relation_counts（带缓存），避免对大V的 fans 做 COUNT(*)
+func (r *FanReplicator) isCelebrity(ctx context.Context, authorID string) (bool, error) {
+	if r.counts == nil {
+		cnt, err := r.fanRepo.CountFans(ctx, authorID)
+		return cnt >= r.celebrityThreshold, err
+	}
+	c, err := r.counts.GetCounts(ctx, authorID)
+	if err != nil {
+		return false, err
+	}
+	return c != nil && c.FollowerCount >= r.celebrityThreshold, nil
+}
+
+// backfill 把 authorID 最近的帖子写入 followerID 的 inbox；score 与扇出一致取发布时间，重复写入忽略
+func (r *FanReplicator) backfill(ctx context.Context, followerID, authorID string) error {
+	if r.inbox == nil || r.backfillPosts <= 0 {
+		return nil
+	}
+	if r.celebrityThreshold > 0 {
+		celeb, err := r.isCelebrity(ctx, authorID)
+		if err != nil {
+			return err
+		}
+		if celeb {
+			return nil
+		}
+	}
+	posts, err := r.posts.ListRecentByAuthor(ctx, authorID, r.backfillPosts)
+	if err != nil || len(posts) == 0 {
+		return err
+	}
+	now := time.Now()
+	records := make([]model.Inbox, len(posts))
+	for i, p := range posts {
+		id, err := newRowID(r.ids)
+		if err != nil {
+			return err
+		}
+		records[i] = model.Inbox{ID: id, UserID: followerID, PostID: p.ID, Score: p.CreatedAt.UnixNano(), CreatedAt: now}
+	}
+	if _, err := r.inbox.Insert(ctx, records); err != nil {
+		return err
+	}
+	// inbox 已落库，写穿失败不重试事件：缓存过期或被重建后会从 inbox 恢复
+	if r.timelineCache != nil {
+		if err := r.timelineCache.Append(ctx, records); err != nil {
+			logger.Warn("timeline cache append failed", zap.String("user", followerID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// purge 分批删除 followerID 的 inbox 中 authorID 的帖子
+func (r *FanReplicator) purge(ctx context.Context, followerID, authorID string) error {
+	if r.inbox == nil {
+		return nil
+	}
+	for {
+		n, err := r.inbox.PurgeAuthor(ctx, followerID, authorID, replicatorPurgeBatch)
+		if err != nil {
+			return err
+		}
+		if n < replicatorPurgeBatch {
+			break
+		}
+	}
+	// 缓存的条目不含作者，无法定点删除，整体失效后读时重建；失效失败时旧条目至多保留到缓存过期
+	if r.timelineCache != nil {
+		if err := r.timelineCache.Invalidate(ctx, followerID); err != nil {
+			logger.Warn("timeline cache invalidate failed", zap.String("user", followerID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// WithRetention 设置已完成事件的保留时长（需在 Start 前调用），Start 后定期分批删除更早完成的事件；0 表示不清理
+func (r *FanReplicator) WithRetention(keep time.Duration) *FanReplicator {
+	r.doneRetention = keep
+	return r
+}
+
+func (r *FanReplicator) retentionLoop(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(replicatorRetentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if n, err := r.purgeDone(context.Background()); err != nil {
+			logger.Warn("replicator purge done events failed", zap.Int64("deleted", n), zap.Error(err))
+		} else if n > 0 {
+			logger.Info("replicator purged done events", zap.Int64("deleted", n))
+		}
+	}
+}
+
+// purgeDone 分批删除保留期之前完成的事件，返回删除行数
+func (r *FanReplicator) purgeDone(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-r.doneRetention)
+	var total int64
+	for {
+		n, err := r.events.PurgeDone(ctx, before, replicatorRetentionBatch)
+		total += n
+		if err != nil || n < replicatorRetentionBatch {
+			return total, err
+		}
+	}
+}
+
+// WithIDGenerator 回填的 inbox 行 ID 改用分布式 ID 生成器
+func (r *FanReplicator) WithIDGenerator(ids *idgen.Generator) *FanReplicator {
+	r.ids = ids
+	return r
+}
+
+// WithTimelineCache 设置时间线缓存：回填写穿到已缓存的时间线，取关清理后失效关注者的缓存
+func (r *FanReplicator) WithTimelineCache(cache *TimelineCache) *FanReplicator {
+	r.timelineCache = cache
+	return r
+}
+
+// WithCounts 设置计数服务，fans 落库后失效对应用户的计数缓存
+func (r *FanReplicator) WithCounts(counts RelationCountService) *FanReplicator {
+	r.counts = counts
+	return r
+}
+
+// replicatorBackoff 指数退避：1s, 2s, 4s ... 封顶 5 分钟
+func replicatorBackoff(attempts int) time.Duration {
+	return expBackoff(attempts, replicatorBaseBackoff, replicatorMaxBackoff)
+}
+
+// expBackoff 第 attempts 次失败后的等待时间：base * 2^(attempts-1)，封顶 maxDelay
+func expBackoff(attempts int, base, maxDelay time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxDelay {
+			return maxDelay
+		}
+	}
+	return d
+}
+
+// Notify 提示消费协程立即拉取（事件已在事务内落库，这里只是降低延迟，丢失也无妨）。
+func (r *FanReplicator) Notify() {
+	select {
+	case r.wakeCh <- struct{}{}:
+	default:
+	}
 }
 
 // Metrics 返回复制落地耗时的只读通道（每处理一条发送一次 duration）。
 func (r *FanReplicator) Metrics() <-chan time.Duration { return r.metricsCh }
 
-// QueueLen 返回当前队列长度（采样值）。
-func (r *FanReplicator) QueueLen() int { return len(r.ch) }
+// QueueLen 返回当前待处理事件数（采样值）。
+func (r *FanReplicator) QueueLen() int {
+	cnt, err := r.events.CountPending(context.Background())
+	if err != nil {
+		return 0
+	}
+	return int(cnt)
+}
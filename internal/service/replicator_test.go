@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	// 服务层会打日志，需要先初始化
+	if err := logger.Init("release"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// failingFanRepo 模拟 fans 写入持续失败
+type failingFanRepo struct {
+	repository.FanRepository
+}
+
+func (failingFanRepo) Create(context.Context, string, string) error {
+	return errors.New("fans unavailable")
+}
+
+func setupReplicatorDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Follow{}, &model.Block{}, &model.Fan{}, &model.RelationEvent{}, &model.RelationCount{}))
+	return db
+}
+
+func loadEvents(t *testing.T, db *gorm.DB) []*model.RelationEvent {
+	var evs []*model.RelationEvent
+	require.NoError(t, db.Order("created_at").Find(&evs).Error)
+	return evs
+}
+
+func TestReplicatorConvergesToFollows(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, fanRepo, 0, 0, 0)
+	ctx := context.Background()
+
+	// 关注 -> 取关 -> 再关注，共产生 3 条事件
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	require.NoError(t, followRepo.Delete(ctx, "a", "b"))
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	evs := loadEvents(t, db)
+	require.Len(t, evs, 3)
+
+	// 乱序处理：最后一条 add 先到，随后才是旧的 remove
+	r.handle(ctx, evs[2])
+	r.handle(ctx, evs[1])
+	r.handle(ctx, evs[0])
+
+	var cnt int64
+	db.Model(&model.Fan{}).Where("user_id = ? AND fan_id = ?", "b", "a").Count(&cnt)
+	assert.Equal(t, int64(1), cnt)
+	for _, ev := range loadEvents(t, db) {
+		assert.Equal(t, model.RelationEventDone, ev.Status)
+	}
+}
+
+// claimEvent 模拟 Claim 领取一条事件（sqlite 不支持 SKIP LOCKED）：attempts +1 并推后租约
+func claimEvent(t *testing.T, db *gorm.DB, id string) *model.RelationEvent {
+	require.NoError(t, db.Model(&model.RelationEvent{}).Where("id = ?", id).
+		Updates(map[string]any{"attempts": gorm.Expr("attempts + 1"), "next_attempt_at": time.Now().Add(time.Minute)}).Error)
+	var ev model.RelationEvent
+	require.NoError(t, db.First(&ev, "id = ?", id).Error)
+	return &ev
+}
+
+func TestReplicatorRetriesThenDeadLetters(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, failingFanRepo{}, 0, 3, 0)
+	ctx := context.Background()
+
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	id := loadEvents(t, db)[0].ID
+
+	before := time.Now()
+	r.handle(ctx, claimEvent(t, db, id))
+	ev := loadEvents(t, db)[0]
+	assert.Equal(t, model.RelationEventPending, ev.Status)
+	assert.Equal(t, 1, ev.Attempts)
+	assert.True(t, ev.NextAttemptAt.After(before))
+	assert.Equal(t, "fans unavailable", ev.LastError)
+
+	r.handle(ctx, claimEvent(t, db, id))
+	r.handle(ctx, claimEvent(t, db, id))
+	ev = loadEvents(t, db)[0]
+	assert.Equal(t, model.RelationEventDead, ev.Status)
+	assert.Equal(t, 3, ev.Attempts)
+}
+
+func TestReplicatorDeadLettersExpiredLeases(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, repository.NewFanRepository(db), 0, 3, 0)
+	ctx := context.Background()
+
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	id := loadEvents(t, db)[0].ID
+	// 处理者每次领取后都崩溃：租约到期被重新领取，次数照样累加，超过上限后不再处理
+	for i := 0; i < 3; i++ {
+		claimEvent(t, db, id)
+	}
+	r.handle(ctx, claimEvent(t, db, id))
+
+	ev := loadEvents(t, db)[0]
+	assert.Equal(t, model.RelationEventDead, ev.Status)
+	assert.Equal(t, 4, ev.Attempts)
+	var cnt int64
+	db.Model(&model.Fan{}).Count(&cnt)
+	assert.Zero(t, cnt)
+}
+
+func TestRelationEventStaleClaimCannotOverride(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	events := repository.NewRelationEventRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	id := loadEvents(t, db)[0].ID
+	stale := claimEvent(t, db, id)
+
+	// 租约过期后被另一个 worker 领取并完成，原 worker 迟到的结果不生效
+	fresh := claimEvent(t, db, id)
+	require.NoError(t, events.MarkDone(ctx, id, fresh.Attempts))
+	require.NoError(t, events.MarkDead(ctx, id, stale.Attempts, "stale"))
+	require.NoError(t, events.MarkRetry(ctx, id, stale.Attempts, time.Now(), "stale"))
+	require.NoError(t, events.MarkDead(ctx, id, fresh.Attempts, "late"))
+
+	ev := loadEvents(t, db)[0]
+	assert.Equal(t, model.RelationEventDone, ev.Status)
+	assert.Empty(t, ev.LastError)
+}
+
+func TestReplicatorPurgesOldDoneEvents(t *testing.T) {
+	db := setupReplicatorDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, repository.NewFanRepository(db), 0, 0, 0).
+		WithRetention(time.Hour)
+	ctx := context.Background()
+
+	for _, fan := range []string{"a", "c", "d"} {
+		require.NoError(t, followRepo.Create(ctx, fan, "b"))
+	}
+	evs := loadEvents(t, db)
+	require.Len(t, evs, 3)
+	for _, ev := range evs {
+		r.handle(ctx, claimEvent(t, db, ev.ID))
+	}
+
+	// 只删除保留期之前完成的事件；新完成的、死信与 pending 都保留
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, db.Model(&model.RelationEvent{}).Where("id = ?", evs[0].ID).UpdateColumn("updated_at", old).Error)
+	require.NoError(t, db.Model(&model.RelationEvent{}).Where("id = ?", evs[1].ID).
+		UpdateColumns(map[string]any{"status": model.RelationEventDead, "updated_at": old}).Error)
+	require.NoError(t, followRepo.Create(ctx, "e", "b"))
+
+	n, err := r.purgeDone(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	left := loadEvents(t, db)
+	require.Len(t, left, 3)
+	assert.Equal(t, evs[1].ID, left[0].ID)
+}
+
+func TestReplicatorBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, replicatorBackoff(1))
+	assert.Equal(t, 4*time.Second, replicatorBackoff(3))
+	assert.Equal(t, replicatorMaxBackoff, replicatorBackoff(30))
+}
+
+func TestReplicatorBackfillsAndPurgesTimeline(t *testing.T) {
+	db := setupTimelineDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, fanRepo, 0, 0, 0).
+		WithTimeline(repository.NewInboxRepository(db), repository.NewPostRepository(db), 2, 0)
+	ctx := context.Background()
+
+	base := time.Now().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		seedPost(t, db, fmt.Sprintf("b%d", i), "b", "", base.Add(time.Duration(i)*time.Second), false)
+	}
+	// 已删除的帖子不回填；其他作者的条目不受取关影响
+	seedPost(t, db, "b-deleted", "b", "", base.Add(time.Minute), false)
+	require.NoError(t, db.Delete(&model.Post{ID: "b-deleted"}).Error)
+	seedPost(t, db, "c0", "c", "a", base, true)
+
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	r.handle(ctx, loadEvents(t, db)[0])
+	assert.Equal(t, []string{"b2", "b1", "c0"}, inboxPosts(t, db, "a"))
+
+	require.NoError(t, followRepo.Delete(ctx, "a", "b"))
+	r.handle(ctx, loadEvents(t, db)[1])
+	assert.Equal(t, []string{"c0"}, inboxPosts(t, db, "a"))
+}
+
+func TestReplicatorIgnoresTimelineCacheOutage(t *testing.T) {
+	db := setupTimelineDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	mr := miniredis.RunT(t)
+	cache := NewTimelineCache(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}), 10, 0)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, fanRepo, 0, 1, 0).
+		WithTimeline(repository.NewInboxRepository(db), repository.NewPostRepository(db), 2, 0).
+		WithTimelineCache(cache)
+	ctx := context.Background()
+	seedPost(t, db, "b0", "b", "", time.Now().Truncate(time.Second), false)
+	mr.Close()
+
+	// Redis 不可用时 fans 与 inbox 已提交，事件照常完成，不进入重试或死信
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	r.handle(ctx, loadEvents(t, db)[0])
+	assert.Equal(t, []string{"b0"}, inboxPosts(t, db, "a"))
+	require.NoError(t, followRepo.Delete(ctx, "a", "b"))
+	r.handle(ctx, loadEvents(t, db)[1])
+	assert.Empty(t, inboxPosts(t, db, "a"))
+	for _, ev := range loadEvents(t, db) {
+		assert.Equal(t, model.RelationEventDone, ev.Status)
+	}
+}
+
+func TestReplicatorSkipsCelebrityBackfill(t *testing.T) {
+	db := setupTimelineDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	r := NewFanReplicator(repository.NewRelationEventRepository(db), followRepo, fanRepo, 0, 0, 0).
+		WithTimeline(repository.NewInboxRepository(db), repository.NewPostRepository(db), 2, 1)
+	ctx := context.Background()
+
+	// 大V的帖子读时拉取，关注后不回填
+	seedPost(t, db, "b0", "b", "", time.Now(), false)
+	require.NoError(t, followRepo.Create(ctx, "a", "b"))
+	r.handle(ctx, loadEvents(t, db)[0])
+	assert.Empty(t, inboxPosts(t, db, "a"))
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/d60-Lab/gin-template/config"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const (
+	defaultRetentionInterval  = time.Hour
+	defaultRetentionBatchSize = 1000
+)
+
+// RetentionPolicy inbox 保留策略，两项均为 0 表示不清理
+type RetentionPolicy struct {
+	// MaxPerUser 每个用户最多保留的最新条数
+	MaxPerUser int
+	// TTL 帖子发布时间（score）早于 now-TTL 的条目被删除
+	TTL time.Duration
+}
+
+// RetentionPolicyFromConfig 由配置生成保留策略
+func RetentionPolicyFromConfig(c config.RetentionConfig) RetentionPolicy {
+	return RetentionPolicy{MaxPerUser: c.MaxPerUser, TTL: time.Duration(c.TTLHours) * time.Hour}
+}
+
+// Enabled 是否配置了任一清理规则
+func (p RetentionPolicy) Enabled() bool { return p.MaxPerUser > 0 || p.TTL > 0 }
+
+// RetentionReport 一轮清理的结果（cmd 工具直接输出为 JSON）
+type RetentionReport struct {
+	MaxPerUser int       `json:"max_per_user"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+	Expired    int64     `json:"expired"`       // 超过 TTL 删除的行数
+	Users      int64     `json:"scanned_users"` // 按条数裁剪时扫描的用户数
+	Trimmed    int64     `json:"trimmed"`       // 超过 MaxPerUser 删除的行数
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// InboxRetention 按保留策略分批删除 inbox 行。每条 DELETE 至多 batchSize 行，
+// 配置限速时每秒删除的行数不超过上限，避免大批量删除挤占主库 IO 与复制带宽。
+type InboxRetention struct {
+	inbox     repository.InboxRepository
+	policy    RetentionPolicy
+	interval  time.Duration
+	batchSize int
+	limiter   *rate.Limiter // 为 nil 时不限速
+	cache     *TimelineCache
+}
+
+func NewInboxRetention(inbox repository.InboxRepository, policy RetentionPolicy, interval time.Duration, batchSize int) *InboxRetention {
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+	return &InboxRetention{inbox: inbox, policy: policy, interval: interval, batchSize: batchSize}
+}
+
+// WithRateLimit 限制每秒删除的行数，0 表示不限速
+func (r *InboxRetention) WithRateLimit(rowsPerSecond int) *InboxRetention {
+	if rowsPerSecond <= 0 {
+		r.limiter = nil
+		return r
+	}
+	// 每批最多 batchSize 行，桶容量至少为一批
+	burst := rowsPerSecond
+	if burst < r.batchSize {
+		burst = r.batchSize
+	}
+	r.limiter = rate.NewLimiter(rate.Limit(rowsPerSecond), burst)
+	return r
+}
+
+// WithTimelineCache 清理 inbox 后按同样的规则裁剪已缓存的时间线；缓存裁剪失败只记日志，缓存随 TTL 过期自愈
+func (r *InboxRetention) WithTimelineCache(cache *TimelineCache) *InboxRetention {
+	r.cache = cache
+	return r
+}
+
+// Start 启动后台清理；返回停止函数，会中断进行中的一轮（已删除的批次不受影响）
+func (r *InboxRetention) Start() func(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := r.RunOnce(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("inbox retention failed", zap.Error(err))
+					}
+					continue
+				}
+				if report.Expired+report.Trimmed > 0 {
+					logger.Info("inbox retention done",
+						zap.Int64("expired", report.Expired), zap.Int64("trimmed", report.Trimmed),
+						zap.Int64("duration_ms", report.DurationMs))
+				}
+			}
+		}
+	}()
+	return func(stopCtx context.Context) error {
+		cancel()
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}
+}
+
+// RunOnce 完整执行一轮：先按 TTL 删除过期条目，再逐个用户裁剪到 MaxPerUser；
+// 配置了时间线缓存时逐批裁剪这些用户的缓存（仅配置 TTL 时也会遍历用户）。
+// inbox 已全部过期的用户不在遍历范围内，其缓存由 key 的 TTL 兜底
+func (r *InboxRetention) RunOnce(ctx context.Context) (*RetentionReport, error) {
+	report := &RetentionReport{MaxPerUser: r.policy.MaxPerUser, TTLSeconds: int64(r.policy.TTL / time.Second), StartedAt: time.Now()}
+	defer func() { report.DurationMs = time.Since(report.StartedAt).Milliseconds() }()
+
+	var minScore int64
+	if r.policy.TTL > 0 {
+		cutoff := report.StartedAt.Add(-r.policy.TTL)
+		minScore = cutoff.UnixNano()
+		n, err := r.drain(ctx, func() (int64, error) { return r.inbox.DeleteOlderThan(ctx, cutoff, r.batchSize) })
+		report.Expired = n
+		if err != nil {
+			return report, err
+		}
+	}
+	if r.policy.MaxPerUser <= 0 && (r.cache == nil || minScore == 0) {
+		return report, nil
+	}
+
+	after := ""
+	for {
+		users, err := r.inbox.ListUsers(ctx, after, r.batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(users) == 0 {
+			return report, nil
+		}
+		after = users[len(users)-1]
+		for _, userID := range users {
+			report.Users++
+			if r.policy.MaxPerUser <= 0 {
+				continue
+			}
+			n, err := r.drain(ctx, func() (int64, error) {
+				return r.inbox.TrimUser(ctx, userID, r.policy.MaxPerUser, r.batchSize)
+			})
+			report.Trimmed += n
+			if err != nil {
+				return report, err
+			}
+		}
+		if r.cache != nil {
+			if err := r.cache.Trim(ctx, users, r.policy.MaxPerUser, minScore); err != nil {
+				logger.Warn("trim timeline cache failed", zap.Int("users", len(users)), zap.Error(err))
+			}
+		}
+	}
+}
+
+// drain 重复执行一次至多删除 batchSize 行的 del，直到删除行数不足一批；
+// 限速按实际删除的行数事后扣减令牌，没有可删数据的用户不占用配额
+func (r *InboxRetention) drain(ctx context.Context, del func() (int64, error)) (int64, error) {
+	var total int64
+	for {
+		n, err := del()
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if r.limiter != nil && n > 0 {
+			if err := r.limiter.WaitN(ctx, int(n)); err != nil {
+				return total, err
+			}
+		}
+		if n < int64(r.batchSize) {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func inboxPosts(t *testing.T, db *gorm.DB, userID string) []string {
+	var ids []string
+	require.NoError(t, db.Model(&model.Inbox{}).Where("user_id = ?", userID).Order("score DESC, post_id DESC").Pluck("post_id", &ids).Error)
+	return ids
+}
+
+func TestInboxRetentionTrimsAndExpires(t *testing.T) {
+	db := setupTimelineDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// r1 有 5 条新帖 + 2 条过期帖，r2 只有 2 条新帖
+	for i := 0; i < 5; i++ {
+		seedPost(t, db, fmt.Sprintf("r1-new%d", i), "a", "r1", now.Add(-time.Duration(i)*time.Minute), true)
+	}
+	for i := 0; i < 2; i++ {
+		seedPost(t, db, fmt.Sprintf("r1-old%d", i), "a", "r1", now.Add(-48*time.Hour-time.Duration(i)*time.Minute), true)
+		seedPost(t, db, fmt.Sprintf("r2-new%d", i), "a", "r2", now.Add(-time.Duration(i)*time.Minute), true)
+	}
+
+	// batch 为 2，迫使每条规则都要分多批删除
+	r := NewInboxRetention(repository.NewInboxRepository(db), RetentionPolicy{MaxPerUser: 3, TTL: 24 * time.Hour}, 0, 2).
+		WithRateLimit(1000)
+	report, err := r.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), report.Expired)
+	assert.Equal(t, int64(2), report.Trimmed)
+	assert.Equal(t, int64(2), report.Users)
+
+	assert.Equal(t, []string{"r1-new0", "r1-new1", "r1-new2"}, inboxPosts(t, db, "r1"))
+	assert.Equal(t, []string{"r2-new0", "r2-new1"}, inboxPosts(t, db, "r2"))
+
+	// 再执行一轮没有可删的数据
+	report, err = r.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Expired+report.Trimmed)
+}
+
+func TestInboxRetentionTrimsTimelineCache(t *testing.T) {
+	db := setupTimelineDB(t)
+	mr, cache := setupTimelineCache(t, 10)
+	svc := NewTimelineService(db, nil, nil, 0, nil, cache)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		seedPost(t, db, fmt.Sprintf("new%d", i), "a", "r1", now.Add(-time.Duration(i)*time.Minute), true)
+	}
+	seedPost(t, db, "old0", "a", "r1", now.Add(-48*time.Hour), true)
+	// 缓存整条时间线（含结束标记）
+	assert.Equal(t, []string{"new0", "new1", "new2", "new3", "new4", "old0"}, readAll(t, svc, "r1", 10))
+
+	r := NewInboxRetention(repository.NewInboxRepository(db), RetentionPolicy{MaxPerUser: 3, TTL: 24 * time.Hour}, 0, 2).
+		WithTimelineCache(cache)
+	_, err := r.RunOnce(ctx)
+	require.NoError(t, err)
+
+	members, err := mr.ZMembers(timelineCacheKey("r1"))
+	require.NoError(t, err)
+	assert.Len(t, members, 4)
+	assert.Contains(t, members, timelineEndMarker)
+	assert.Equal(t, []string{"new0", "new1", "new2"}, readAll(t, svc, "r1", 10))
+
+	// 只配置 TTL 时同样裁剪缓存中的过期条目
+	seedPost(t, db, "old1", "a", "r1", now.Add(-48*time.Hour), true)
+	require.NoError(t, cache.Append(ctx, []model.Inbox{{UserID: "r1", PostID: "old1", Score: now.Add(-48 * time.Hour).UnixNano()}}))
+	r = NewInboxRetention(repository.NewInboxRepository(db), RetentionPolicy{TTL: 24 * time.Hour}, 0, 2).WithTimelineCache(cache)
+	_, err = r.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new0", "new1", "new2"}, readAll(t, svc, "r1", 10))
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/dto"
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+var (
+	// ErrInvalidCursor 与仓储层共用，便于 handler 统一识别
+	ErrInvalidCursor = repository.ErrInvalidCursor
+)
+
+const (
+	defaultTimelineLimit = 20
+	maxTimelineLimit     = 100
+
+	// maxPullFollowings 拉模式下最多检查的最近关注数，避免超大关注列表拖慢读请求
+	maxPullFollowings = 2000
+)
+
+// TimelineService 时间线读取服务（读 inbox，回填 post 内容；推拉结合时合并大V帖子）
+type TimelineService interface {
+	// GetTimeline 按 (score, post_id) 倒序读取时间线；cursor 为空表示第一页
+	GetTimeline(ctx context.Context, userID, cursor string, limit int) (*dto.TimelineResponse, error)
+}
+
+type timelineService struct {
+	db                 *gorm.DB
+	followRepo         repository.FollowRepository
+	countRepo          repository.RelationCountRepository
+	celebrityThreshold int64
+	muteRepo           repository.MuteRepository
+	cache              *TimelineCache
+}
+
+// NewTimelineService 创建时间线服务实例。
+// celebrityThreshold 需与 FanoutWorker 保持一致：粉丝数（relation_counts.follower_count）达到阈值的作者不写 inbox，
+// 由这里读时拉取；0 表示纯推模式。
+// muteRepo 可为 nil；非空时过滤读者屏蔽的作者（屏蔽之前已写入 inbox 的帖子同样被过滤）。
+// cache 可为 nil；非空时推模式部分先读 Redis 时间线缓存，未缓存时从数据库重建。
+func NewTimelineService(db *gorm.DB, followRepo repository.FollowRepository, countRepo repository.RelationCountRepository, celebrityThreshold int64, muteRepo repository.MuteRepository, cache *TimelineCache) TimelineService {
+	return &timelineService{db: db, followRepo: followRepo, countRepo: countRepo, celebrityThreshold: celebrityThreshold, muteRepo: muteRepo, cache: cache}
+}
+
+// timelineEntry 合并排序用的条目
+type timelineEntry struct {
+	score  int64
+	postID string
+}
+
+func (s *timelineService) GetTimeline(ctx context.Context, userID, cursor string, limit int) (*dto.TimelineResponse, error) {
+	if limit < 1 {
+		limit = defaultTimelineLimit
+	}
+	if limit > maxTimelineLimit {
+		limit = maxTimelineLimit
+	}
+
+	var after *timelineCursor
+	if cursor != "" {
+		c, err := decodeTimelineCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	muted, err := s.mutedAuthors(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 两路各多取一条，合并后用于判断是否还有下一页
+	rows, err := s.readInbox(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	pulled, err := s.readCelebrityPosts(ctx, userID, muted, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := s.loadPosts(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]timelineEntry, 0, len(rows)+len(pulled))
+	for _, r := range rows {
+		entries = append(entries, timelineEntry{score: r.Score, postID: r.PostID})
+	}
+	for _, p := range pulled {
+		posts[p.ID] = p
+		entries = append(entries, timelineEntry{score: p.CreatedAt.UnixNano(), postID: p.ID})
+	}
+	entries = mergeTimelineEntries(entries)
+
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	resp := &dto.TimelineResponse{List: make([]*dto.TimelineItem, 0, len(entries)), HasMore: hasMore}
+	for _, e := range entries {
+		// post 已不存在或作者被屏蔽时跳过，但游标仍按条目推进
+		p, ok := posts[e.postID]
+		if !ok {
+			continue
+		}
+		if _, m := muted[p.AuthorID]; m {
+			continue
+		}
+		resp.List = append(resp.List, &dto.TimelineItem{
+			PostID:    p.ID,
+			AuthorID:  p.AuthorID,
+			Payload:   p.Payload,
+			Score:     e.score,
+			CreatedAt: p.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	if hasMore {
+		last := entries[len(entries)-1]
+		resp.NextCursor = encodeTimelineCursor(timelineCursor{score: last.score, id: last.postID})
+	}
+	return resp, nil
+}
+
+// readInbox 推模式部分：优先读缓存，未缓存时重建，超出缓存范围时回源
+func (s *timelineService) readInbox(ctx context.Context, userID string, after *timelineCursor, n int) ([]model.Inbox, error) {
+	if s.cache == nil {
+		return s.queryInbox(ctx, userID, after, n)
+	}
+	rows, state, err := s.cache.Page(ctx, userID, after, n)
+	if err != nil {
+		logger.Warn("timeline cache read failed", zap.String("user", userID), zap.Error(err))
+		return s.queryInbox(ctx, userID, after, n)
+	}
+	switch state {
+	case timelineCacheHit:
+		return rows, nil
+	case timelineCacheMiss:
+		return s.rebuildCache(ctx, userID, after, n)
+	default:
+		return s.queryInbox(ctx, userID, after, n)
+	}
+}
+
+// rebuildCache 从数据库读取最新的 size 条写入缓存，并直接用读出的结果回答本页
+func (s *timelineService) rebuildCache(ctx context.Context, userID string, after *timelineCursor, n int) ([]model.Inbox, error) {
+	started, err := s.cache.BeginFill(ctx, userID)
+	if err != nil || !started {
+		// 其他请求正在重建（或 Redis 异常），本次直接回源
+		return s.queryInbox(ctx, userID, after, n)
+	}
+	latest, err := s.queryInbox(ctx, userID, nil, s.cache.size)
+	if err != nil {
+		return nil, err
+	}
+	complete := len(latest) < s.cache.size
+	if err := s.cache.Fill(ctx, userID, latest, complete); err != nil {
+		logger.Warn("timeline cache fill failed", zap.String("user", userID), zap.Error(err))
+	}
+
+	rows := make([]model.Inbox, 0, n)
+	for _, r := range latest {
+		if after != nil && (r.Score > after.score || (r.Score == after.score && r.PostID >= after.id)) {
+			continue
+		}
+		rows = append(rows, r)
+		if len(rows) == n {
+			return rows, nil
+		}
+	}
+	if complete {
+		return rows, nil
+	}
+	return s.queryInbox(ctx, userID, after, n)
+}
+
+// queryInbox seek 读取 inbox 表
+func (s *timelineService) queryInbox(ctx context.Context, userID string, after *timelineCursor, n int) ([]model.Inbox, error) {
+	q := s.db.WithContext(ctx).Where("user_id = ?", userID)
+	if after != nil {
+		q = q.Where("(score, post_id) < (?, ?)", after.score, after.id)
+	}
+	var rows []model.Inbox
+	err := q.Order("score DESC, post_id DESC").Limit(n).Find(&rows).Error
+	return rows, err
+}
+
+// mutedAuthors 读者屏蔽的作者集合
+func (s *timelineService) mutedAuthors(ctx context.Context, userID string) (map[string]struct{}, error) {
+	if s.muteRepo == nil {
+		return nil, nil
+	}
+	ids, err := s.muteRepo.ListMuted(ctx, userID)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	res := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		res[id] = struct{}{}
+	}
+	return res, nil
+}
+
+// readCelebrityPosts 拉模式部分：从关注的大V直接读 posts（不拉取被屏蔽的作者）
+func (s *timelineService) readCelebrityPosts(ctx context.Context, userID string, muted map[string]struct{}, after *timelineCursor, n int) ([]*model.Post, error) {
+	if s.celebrityThreshold <= 0 || s.followRepo == nil || s.countRepo == nil {
+		return nil, nil
+	}
+	celebs, err := s.celebrityFollowings(ctx, userID)
+	if err != nil || len(celebs) == 0 {
+		return nil, err
+	}
+	authors := celebs[:0]
+	for _, id := range celebs {
+		if _, ok := muted[id]; !ok {
+			authors = append(authors, id)
+		}
+	}
+	if len(authors) == 0 {
+		return nil, nil
+	}
+
+	q := s.db.WithContext(ctx).Where("author_id IN ?", authors)
+	if after != nil {
+		t := time.Unix(0, after.score)
+		q = q.Where("(created_at, id) < (?, ?)", t, after.id)
+	}
+	var posts []*model.Post
+	err = q.Order("created_at DESC, id DESC").Limit(n).Find(&posts).Error
+	return posts, err
+}
+
+// celebrityFollowings 找出 userID 最近关注的 maxPullFollowings 个人中粉丝数达到阈值的大V
+func (s *timelineService) celebrityFollowings(ctx context.Context, userID string) ([]string, error) {
+	ids, err := s.followRepo.ListRecentFollowees(ctx, userID, maxPullFollowings)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return filterCelebrities(ctx, s.countRepo, s.celebrityThreshold, ids)
+}
+
+// filterCelebrities 返回 ids 中粉丝数达到 threshold 的用户。粉丝数取 relation_counts（随 fans 同事务维护、
+// 由对账任务校正），只按主键点查，不对 fans 做 COUNT(*)
+func filterCelebrities(ctx context.Context, countRepo repository.RelationCountRepository, threshold int64, ids []string) ([]string, error) {
+	counts, err := countRepo.BatchGet(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0)
+	for _, id := range ids {
+		if c, ok := counts[id]; ok && c.FollowerCount >= threshold {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// loadPosts 批量回填 post 内容
+func (s *timelineService) loadPosts(ctx context.Context, rows []model.Inbox) (map[string]*model.Post, error) {
+	res := make(map[string]*model.Post, len(rows))
+	if len(rows) == 0 {
+		return res, nil
+	}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.PostID
+	}
+	var posts []*model.Post
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		res[p.ID] = p
+	}
+	return res, nil
+}
+
+// mergeTimelineEntries 按 (score, post_id) 倒序排序并按 post 去重
+// （作者成为大V之前推送过的帖子可能同时出现在 inbox 与拉取结果中）
+func mergeTimelineEntries(entries []timelineEntry) []timelineEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].score != entries[j].score {
+			return entries[i].score > entries[j].score
+		}
+		return entries[i].postID > entries[j].postID
+	})
+	seen := make(map[string]struct{}, len(entries))
+	out := entries[:0]
+	for _, e := range entries {
+		if _, ok := seen[e.postID]; ok {
+			continue
+		}
+		seen[e.postID] = struct{}{}
+		out = append(out, e)
+	}
+	return out
+}
+
+// timelineCursor 不透明 seek 游标，编码最后一条的 (score, post_id)
+type timelineCursor struct {
+	score int64
+	id    string
+}
+
+func encodeTimelineCursor(c timelineCursor) string {
+	raw := strconv.FormatInt(c.score, 10) + ":" + c.id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTimelineCursor(s string) (timelineCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return timelineCursor{}, ErrInvalidCursor
+	}
+	scoreStr, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return timelineCursor{}, ErrInvalidCursor
+	}
+	score, err := strconv.ParseInt(scoreStr, 10, 64)
+	if err != nil {
+		return timelineCursor{}, ErrInvalidCursor
+	}
+	return timelineCursor{score: score, id: id}, nil
+}
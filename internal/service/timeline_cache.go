@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+)
+
+const (
+	defaultTimelineCacheSize = 800
+	defaultTimelineCacheTTL  = 24 * time.Hour
+	// timelineFillTTL 重建占位的存活时间，重建中途失败时占位自动过期
+	timelineFillTTL = 30 * time.Second
+	// timelinePageSlack 按分数定位游标时多取的条数（分数为 float64，相邻的 score 可能落在同一个值上）
+	timelinePageSlack = 8
+
+	// 成员以 "$" 开头的是标记，真实条目以数字开头；标记的分数为 -inf，排在最后且最先被裁剪
+	timelineEndMarker  = "$end"  // 缓存包含该用户的全部 inbox，读到底即为时间线结束
+	timelineFillMarker = "$fill" // 正在从数据库重建，期间的写穿照常写入
+)
+
+// timelineAppendScript 写穿：只写入已存在的时间线（活跃读者或正在重建），写入后裁剪到容量
+// KEYS[1] 时间线 key；ARGV[1] 容量；ARGV[2..] score, member 交替
+var timelineAppendScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+for i = 2, #ARGV, 2 do redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1]) end
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -tonumber(ARGV[1]) - 1)
+return 1
+`)
+
+// timelineBeginFillScript key 不存在时写入重建占位，返回是否由本次调用开始重建
+var timelineBeginFillScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return 0 end
+redis.call('ZADD', KEYS[1], '-inf', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// timelineTrimScript 按 inbox 保留策略裁剪已缓存的时间线，不动标记（分数为 -inf）
+// KEYS[1] 时间线 key；ARGV[1] 保留的最新条数，0 表示不限；ARGV[2] 保留的最小分数，0 表示不限
+var timelineTrimScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local markers = redis.call('ZCOUNT', KEYS[1], '-inf', '-inf')
+local n = 0
+if tonumber(ARGV[2]) > 0 then
+	local expired = redis.call('ZCOUNT', KEYS[1], '-inf', '(' .. ARGV[2]) - markers
+	if expired > 0 then n = n + redis.call('ZREMRANGEBYRANK', KEYS[1], markers, markers + expired - 1) end
+end
+if tonumber(ARGV[1]) > 0 then
+	n = n + redis.call('ZREMRANGEBYRANK', KEYS[1], markers, -tonumber(ARGV[1]) - 1)
+end
+return n
+`)
+
+// timelineCacheState Page 的结果
+type timelineCacheState int
+
+const (
+	timelineCacheHit     timelineCacheState = iota
+	timelineCacheMiss                       // 未缓存，需要重建
+	timelineCachePartial                    // 已缓存，但这一页超出了缓存的范围（或正在重建），需回源
+)
+
+// TimelineCache 每个用户一个 ZSET 的时间线缓存：score 为 Inbox.Score，member 为 "score:post_id"，
+// 同分时按 member 字典序即 (score, post_id) 排序，与数据库的 seek 顺序完全一致。
+// 只保留最新的 size 条；扇出写穿到已缓存的用户，未缓存的用户在读时从数据库重建。
+// inbox 保留策略清理数据库后由 InboxRetention 调用 Trim 同步裁剪缓存。
+type TimelineCache struct {
+	rdb  *redis.Client
+	size int
+	ttl  time.Duration
+}
+
+func NewTimelineCache(rdb *redis.Client, size int, ttl time.Duration) *TimelineCache {
+	if size <= 0 {
+		size = defaultTimelineCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultTimelineCacheTTL
+	}
+	return &TimelineCache{rdb: rdb, size: size, ttl: ttl}
+}
+
+func timelineCacheKey(userID string) string { return fmt.Sprintf("timeline:%s", userID) }
+
+// score 为正的纳秒时间戳，定宽补零后字典序与数值序一致
+func encodeTimelineMember(score int64, postID string) string {
+	return fmt.Sprintf("%019d:%s", score, postID)
+}
+
+func decodeTimelineMember(member string) (int64, string, bool) {
+	scoreStr, postID, ok := strings.Cut(member, ":")
+	if !ok {
+		return 0, "", false
+	}
+	score, err := strconv.ParseInt(scoreStr, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return score, postID, true
+}
+
+// Append 写穿一批 inbox 行；未缓存的用户跳过
+func (c *TimelineCache) Append(ctx context.Context, records []model.Inbox) error {
+	if len(records) == 0 {
+		return nil
+	}
+	byUser := make(map[string][]interface{})
+	for _, r := range records {
+		byUser[r.UserID] = append(byUser[r.UserID], r.Score, encodeTimelineMember(r.Score, r.PostID))
+	}
+	pipe := c.rdb.Pipeline()
+	for userID, args := range byUser {
+		timelineAppendScript.Eval(ctx, pipe, []string{timelineCacheKey(userID)}, append([]interface{}{c.size}, args...)...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Invalidate 删除用户的时间线缓存（条目无法按作者定位时使用，如取关）
+func (c *TimelineCache) Invalidate(ctx context.Context, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = timelineCacheKey(id)
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
+
+// Trim 按 inbox 保留策略裁剪这批用户已缓存的时间线：只留最新的 keep 条、删除分数小于 minScore 的条目（0 表示不限）。
+// 数据库按同样的规则清理，结束标记仍然成立
+func (c *TimelineCache) Trim(ctx context.Context, userIDs []string, keep int, minScore int64) error {
+	if len(userIDs) == 0 || (keep <= 0 && minScore <= 0) {
+		return nil
+	}
+	pipe := c.rdb.Pipeline()
+	for _, id := range userIDs {
+		timelineTrimScript.Eval(ctx, pipe, []string{timelineCacheKey(id)}, keep, minScore)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// BeginFill 开始重建：写入占位，使重建期间的扇出写穿不被跳过。返回 false 表示已有缓存或他人正在重建
+func (c *TimelineCache) BeginFill(ctx context.Context, userID string) (bool, error) {
+	n, err := timelineBeginFillScript.Run(ctx, c.rdb, []string{timelineCacheKey(userID)},
+		timelineFillMarker, timelineFillTTL.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Fill 把数据库读出的最新条目合并进缓存并移除占位；complete 表示 rows 已是该用户的全部 inbox
+func (c *TimelineCache) Fill(ctx context.Context, userID string, rows []model.Inbox, complete bool) error {
+	key := timelineCacheKey(userID)
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members := make([]redis.Z, 0, len(rows)+1)
+		for _, r := range rows {
+			members = append(members, redis.Z{Score: float64(r.Score), Member: encodeTimelineMember(r.Score, r.PostID)})
+		}
+		if complete {
+			members = append(members, redis.Z{Score: math.Inf(-1), Member: timelineEndMarker})
+		}
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+		}
+		pipe.ZRem(ctx, key, timelineFillMarker)
+		pipe.ZRemRangeByRank(ctx, key, 0, -int64(c.size)-1)
+		pipe.Expire(ctx, key, c.ttl)
+		return nil
+	})
+	return err
+}
+
+// Page 按 (score, post_id) 倒序读取游标之后的 n 条
+func (c *TimelineCache) Page(ctx context.Context, userID string, after *timelineCursor, n int) ([]model.Inbox, timelineCacheState, error) {
+	key := timelineCacheKey(userID)
+	maxScore := "+inf"
+	if after != nil {
+		maxScore = strconv.FormatFloat(float64(after.score), 'f', -1, 64)
+	}
+	rows := make([]model.Inbox, 0, n)
+	count := int64(n + timelinePageSlack)
+	for offset := int64(0); ; offset += count {
+		pipe := c.rdb.Pipeline()
+		exists := pipe.Exists(ctx, key)
+		// Rev 时 go-redis 会自行交换 Start/Stop，这里仍按 min, max 传入
+		members := pipe.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key: key, Start: "-inf", Stop: maxScore, ByScore: true, Rev: true, Offset: offset, Count: count,
+		})
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, timelineCacheMiss, err
+		}
+		if exists.Val() == 0 {
+			return nil, timelineCacheMiss, nil
+		}
+		page := members.Val()
+		for _, m := range page {
+			switch m {
+			case timelineEndMarker:
+				return rows, timelineCacheHit, nil
+			case timelineFillMarker:
+				return nil, timelineCachePartial, nil
+			}
+			score, postID, ok := decodeTimelineMember(m)
+			if !ok {
+				continue
+			}
+			// float 分数只能粗定位，精确比较跳过游标及之前的条目
+			if after != nil && (score > after.score || (score == after.score && postID >= after.id)) {
+				continue
+			}
+			rows = append(rows, model.Inbox{UserID: userID, PostID: postID, Score: score})
+			if len(rows) == n {
+				return rows, timelineCacheHit, nil
+			}
+		}
+		if int64(len(page)) < count {
+			// 读到底却没有结束标记：更早的条目已被裁剪，需回源
+			return nil, timelineCachePartial, nil
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func setupTimelineCache(t *testing.T, size int) (*miniredis.Miniredis, *TimelineCache) {
+	mr := miniredis.RunT(t)
+	return mr, NewTimelineCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), size, 0)
+}
+
+// readAll 翻页读完整条时间线
+func readAll(t *testing.T, svc TimelineService, userID string, limit int) []string {
+	var got []string
+	cursor := ""
+	for {
+		page, err := svc.GetTimeline(context.Background(), userID, cursor, limit)
+		require.NoError(t, err)
+		for _, it := range page.List {
+			got = append(got, it.PostID)
+		}
+		if !page.HasMore {
+			return got
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func TestTimelineCacheRebuildAndWriteThrough(t *testing.T) {
+	db := setupTimelineDB(t)
+	mr, cache := setupTimelineCache(t, 10)
+	svc := NewTimelineService(db, nil, nil, 0, nil, cache)
+	ctx := context.Background()
+
+	// 同一时刻的帖子按 post_id 倒序，与数据库顺序一致
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 4; i++ {
+		seedPost(t, db, fmt.Sprintf("p%d", i), "author", "reader", base.Add(time.Duration(i/2)*time.Second), true)
+	}
+	want := []string{"p3", "p2", "p1", "p0"}
+
+	// 未缓存：从数据库重建，全部条目都在缓存中，带结束标记
+	assert.Equal(t, want, readAll(t, svc, "reader", 3))
+	members, err := mr.ZMembers(timelineCacheKey("reader"))
+	require.NoError(t, err)
+	assert.Len(t, members, 5)
+	assert.Contains(t, members, timelineEndMarker)
+
+	// 之后的读取只走缓存：删掉 inbox 行结果不变
+	require.NoError(t, db.Where("user_id = ?", "reader").Delete(&model.Inbox{}).Error)
+	assert.Equal(t, want, readAll(t, svc, "reader", 3))
+
+	// 扇出写穿到已缓存的时间线；没有缓存的用户不创建 key
+	require.NoError(t, db.Create(&model.Fan{ID: "f1", UserID: "author", FanID: "reader", CreatedAt: base, UpdatedAt: base}).Error)
+	require.NoError(t, db.Create(&model.Fan{ID: "f2", UserID: "author", FanID: "cold", CreatedAt: base.Add(time.Second), UpdatedAt: base}).Error)
+	postID, err := NewPublisher(db).Publish(ctx, "author", "new")
+	require.NoError(t, err)
+	w := NewFanoutWorker(db, repository.NewFanRepository(db), 1, 10, 0, 0).WithTimelineCache(cache)
+	w.handle(ctx, claimOutbox(t, db, loadOutboxByKind(t, db, postID, model.OutboxKindPublish).ID))
+
+	assert.Equal(t, append([]string{postID}, want...), readAll(t, svc, "reader", 3))
+	assert.False(t, mr.Exists(timelineCacheKey("cold")))
+}
+
+func TestTimelineCacheCappedFallsBackToDB(t *testing.T) {
+	db := setupTimelineDB(t)
+	mr, cache := setupTimelineCache(t, 3)
+	svc := NewTimelineService(db, nil, nil, 0, nil, cache)
+
+	base := time.Now().Truncate(time.Second)
+	for i := 0; i < 6; i++ {
+		seedPost(t, db, fmt.Sprintf("p%d", i), "author", "reader", base.Add(time.Duration(i)*time.Second), true)
+	}
+
+	// 只缓存最新 3 条且没有结束标记，更深的页回源数据库
+	assert.Equal(t, []string{"p5", "p4", "p3", "p2", "p1", "p0"}, readAll(t, svc, "reader", 2))
+	members, err := mr.ZMembers(timelineCacheKey("reader"))
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+	assert.NotContains(t, members, timelineEndMarker)
+
+	// 写穿后仍裁剪到容量
+	require.NoError(t, cache.Append(context.Background(), []model.Inbox{{UserID: "reader", PostID: "p6", Score: base.Add(time.Minute).UnixNano()}}))
+	members, err = mr.ZMembers(timelineCacheKey("reader"))
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+	assert.NotContains(t, members, encodeTimelineMember(base.Add(3*time.Second).UnixNano(), "p3"))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/d60-Lab/gin-template/internal/model"
+	"github.com/d60-Lab/gin-template/internal/repository"
+)
+
+func setupTimelineDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Follow{}, &model.Block{}, &model.Fan{}, &model.RelationEvent{}, &model.RelationCount{}, &model.Post{}, &model.Inbox{}, &model.Mute{}, &model.Outbox{}))
+	return db
+}
+
+// seedPost 写入一条帖子；push 为 true 时同时写入 reader 的 inbox
+func seedPost(t *testing.T, db *gorm.DB, id, author, reader string, at time.Time, push bool) {
+	require.NoError(t, db.Create(&model.Post{ID: id, AuthorID: author, Payload: "p-" + id, CreatedAt: at, UpdatedAt: at}).Error)
+	if push {
+		require.NoError(t, db.Create(&model.Inbox{ID: "ib-" + id, UserID: reader, PostID: id, Score: at.UnixNano(), CreatedAt: at}).Error)
+	}
+}
+
+func TestTimelineCursorPaging(t *testing.T) {
+	db := setupTimelineDB(t)
+	svc := NewTimelineService(db, nil, nil, 0, nil, nil)
+	ctx := context.Background()
+
+	base := time.Now().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		seedPost(t, db, fmt.Sprintf("p%d", i), "author", "reader", base.Add(time.Duration(i)*time.Second), true)
+	}
+
+	first, err := svc.GetTimeline(ctx, "reader", "", 2)
+	require.NoError(t, err)
+	require.Len(t, first.List, 2)
+	assert.Equal(t, "p4", first.List[0].PostID)
+	assert.Equal(t, "p3", first.List[1].PostID)
+	assert.True(t, first.HasMore)
+
+	second, err := svc.GetTimeline(ctx, "reader", first.NextCursor, 2)
+	require.NoError(t, err)
+	require.Len(t, second.List, 2)
+	assert.Equal(t, "p2", second.List[0].PostID)
+
+	third, err := svc.GetTimeline(ctx, "reader", second.NextCursor, 2)
+	require.NoError(t, err)
+	require.Len(t, third.List, 1)
+	assert.False(t, third.HasMore)
+	assert.Empty(t, third.NextCursor)
+
+	_, err = svc.GetTimeline(ctx, "reader", "not-a-cursor", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestTimelineMergesCelebrityPosts(t *testing.T) {
+	db := setupTimelineDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	svc := NewTimelineService(db, followRepo, repository.NewRelationCountRepository(db), 2, nil, nil)
+	ctx := context.Background()
+
+	// reader 关注 normal（1 个粉丝，推模式）和 celeb（2 个粉丝，拉模式）
+	require.NoError(t, followRepo.Create(ctx, "reader", "normal"))
+	require.NoError(t, followRepo.Create(ctx, "reader", "celeb"))
+	require.NoError(t, fanRepo.Create(ctx, "normal", "reader"))
+	require.NoError(t, fanRepo.Create(ctx, "celeb", "reader"))
+	require.NoError(t, fanRepo.Create(ctx, "celeb", "other"))
+
+	base := time.Now().Truncate(time.Second)
+	seedPost(t, db, "n1", "normal", "reader", base.Add(1*time.Second), true)
+	seedPost(t, db, "c1", "celeb", "reader", base.Add(2*time.Second), false)
+	seedPost(t, db, "n2", "normal", "reader", base.Add(3*time.Second), true)
+	seedPost(t, db, "c2", "celeb", "reader", base.Add(4*time.Second), false)
+
+	var got []string
+	cursor := ""
+	for {
+		page, err := svc.GetTimeline(ctx, "reader", cursor, 3)
+		require.NoError(t, err)
+		for _, it := range page.List {
+			got = append(got, it.PostID)
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"c2", "n2", "c1", "n1"}, got)
+}
+
+func TestTimelineSkipsMutedAuthors(t *testing.T) {
+	db := setupTimelineDB(t)
+	followRepo := repository.NewFollowRepository(db)
+	fanRepo := repository.NewFanRepository(db)
+	muteRepo := repository.NewMuteRepository(db)
+	svc := NewTimelineService(db, followRepo, repository.NewRelationCountRepository(db), 2, muteRepo, nil)
+	ctx := context.Background()
+
+	require.NoError(t, followRepo.Create(ctx, "reader", "normal"))
+	require.NoError(t, followRepo.Create(ctx, "reader", "celeb"))
+	require.NoError(t, fanRepo.Create(ctx, "normal", "reader"))
+	require.NoError(t, fanRepo.Create(ctx, "celeb", "reader"))
+	require.NoError(t, fanRepo.Create(ctx, "celeb", "other"))
+
+	base := time.Now().Truncate(time.Second)
+	seedPost(t, db, "n1", "normal", "reader", base.Add(1*time.Second), true)
+	seedPost(t, db, "c1", "celeb", "reader", base.Add(2*time.Second), false)
+
+	// 屏蔽推模式与拉模式作者各一个，两路都应被过滤
+	require.NoError(t, muteRepo.Create(ctx, "reader", "normal"))
+	page, err := svc.GetTimeline(ctx, "reader", "", 10)
+	require.NoError(t, err)
+	require.Len(t, page.List, 1)
+	assert.Equal(t, "c1", page.List[0].PostID)
+
+	require.NoError(t, muteRepo.Create(ctx, "reader", "celeb"))
+	page, err = svc.GetTimeline(ctx, "reader", "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.List)
+}
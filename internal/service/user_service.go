@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/d60-Lab/gin-template/config"
@@ -12,6 +13,7 @@ import (
 	"github.com/d60-Lab/gin-template/internal/model"
 	"github.com/d60-Lab/gin-template/internal/repository"
 	"github.com/d60-Lab/gin-template/pkg/jwt"
+	"github.com/d60-Lab/gin-template/pkg/logger"
 )
 
 var (
@@ -31,15 +33,20 @@ type UserService interface {
 }
 
 type userService struct {
-	userRepo repository.UserRepository
-	cfg      *config.Config
+	userRepo  repository.UserRepository
+	counts    RelationCountService
+	cfg       *config.Config
+	followers FollowerCache
 }
 
-// NewUserService 创建用户服务实例
-func NewUserService(userRepo repository.UserRepository, cfg *config.Config) UserService {
+// NewUserService 创建用户服务实例；counts 为 nil 时响应中不填充关注数/粉丝数，
+// followers 非 nil 时资料变更与删除会失效粉丝列表缓存中的用户快照
+func NewUserService(userRepo repository.UserRepository, counts RelationCountService, cfg *config.Config, followers FollowerCache) UserService {
 	return &userService{
-		userRepo: userRepo,
-		cfg:      cfg,
+		userRepo:  userRepo,
+		counts:    counts,
+		cfg:       cfg,
+		followers: followers,
 	}
 }
 
@@ -92,7 +99,9 @@ func (s *userService) GetByID(ctx context.Context, id string) (*dto.UserResponse
 	if user == nil {
 		return nil, ErrUserNotFound
 	}
-	return s.toUserResponse(user), nil
+	resp := s.toUserResponse(user)
+	s.fillCounts(ctx, resp)
+	return resp, nil
 }
 
 func (s *userService) Update(ctx context.Context, id string, req *dto.UpdateUserRequest) (*dto.UserResponse, error) {
@@ -118,8 +127,11 @@ func (s *userService) Update(ctx context.Context, id string, req *dto.UpdateUser
 	if err := s.userRepo.Update(ctx, user); err != nil {
 		return nil, err
 	}
+	s.invalidateFollowerCache(ctx, id, false)
 
-	return s.toUserResponse(user), nil
+	resp := s.toUserResponse(user)
+	s.fillCounts(ctx, resp)
+	return resp, nil
 }
 
 func (s *userService) Delete(ctx context.Context, id string) error {
@@ -131,7 +143,26 @@ func (s *userService) Delete(ctx context.Context, id string) error {
 		return ErrUserNotFound
 	}
 
-	return s.userRepo.Delete(ctx, id)
+	if err := s.userRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidateFollowerCache(ctx, id, true)
+	return nil
+}
+
+// invalidateFollowerCache 删除用户快照；用户被删除时连同其粉丝列表索引一起删除
+func (s *userService) invalidateFollowerCache(ctx context.Context, id string, deleted bool) {
+	if s.followers == nil {
+		return
+	}
+	if err := s.followers.InvalidateUser(ctx, id); err != nil {
+		logger.Warn("invalidate user snapshot failed", zap.String("user", id), zap.Error(err))
+	}
+	if deleted {
+		if err := s.followers.InvalidateFollowers(ctx, id); err != nil {
+			logger.Warn("invalidate follower index failed", zap.String("user", id), zap.Error(err))
+		}
+	}
 }
 
 func (s *userService) Login(ctx context.Context, req *dto.LoginRequest) (*dto.LoginResponse, error) {
@@ -172,10 +203,33 @@ func (s *userService) List(ctx context.Context, page, pageSize int) ([]*dto.User
 	for i, user := range users {
 		responses[i] = s.toUserResponse(user)
 	}
+	s.fillCounts(ctx, responses...)
 
 	return responses, nil
 }
 
+// fillCounts 批量填充关注数/粉丝数；计数读取失败不影响用户信息返回
+func (s *userService) fillCounts(ctx context.Context, users ...*dto.UserResponse) {
+	if s.counts == nil || len(users) == 0 {
+		return
+	}
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	counts, err := s.counts.BatchGetCounts(ctx, ids)
+	if err != nil {
+		logger.Warn("load relation counts failed", zap.Error(err))
+		return
+	}
+	for _, u := range users {
+		if c, ok := counts[u.ID]; ok {
+			u.FollowingCount = c.FollowingCount
+			u.FollowerCount = c.FollowerCount
+		}
+	}
+}
+
 func (s *userService) toUserResponse(user *model.User) *dto.UserResponse {
 	return &dto.UserResponse{
 		ID:        user.ID,
@@ -12,25 +12,30 @@ import (
 	"github.com/d60-Lab/gin-template/internal/model"
 )
 
-// InitDB 初始化数据库连接
-func InitDB(cfg *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+// DSN 根据配置生成 Postgres 连接串
+func DSN(cfg *config.Config) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		cfg.Database.Host,
 		cfg.Database.Port,
 		cfg.Database.Username,
 		cfg.Database.Password,
 		cfg.Database.Database,
 	)
+}
 
-	var logLevel logger.LogLevel
+func logLevel(cfg *config.Config) logger.LogLevel {
 	if cfg.Server.Mode == "release" {
-		logLevel = logger.Error
-	} else {
-		logLevel = logger.Info
+		return logger.Error
 	}
+	return logger.Info
+}
+
+// InitDB 初始化数据库连接
+func InitDB(cfg *config.Config) (*gorm.DB, error) {
+	dsn := DSN(cfg)
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: logger.Default.LogMode(logLevel(cfg)),
 	})
 	if err != nil {
 		return nil, err
@@ -47,9 +52,68 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Second)
 
     // 自动迁移
-    if err := db.AutoMigrate(&model.User{}, &model.Follow{}, &model.Fan{}, &model.Post{}, &model.Outbox{}, &model.Inbox{}); err != nil {
+    if err := db.AutoMigrate(&model.User{}, &model.Follow{}, &model.Fan{}, &model.Post{}, &model.Outbox{}, &model.Inbox{}, &model.RelationEvent{}, &model.RelationCount{}, &model.Block{}, &model.Mute{}, &model.FanoutShard{}); err != nil {
 		return nil, err
 	}
+	// next_attempt_at 列加入前写入的 outbox 行迁移后为 NULL，Claim 的 next_attempt_at <= now 匹配不到，按创建时间补齐
+	if err := db.Model(&model.Outbox{}).Where("next_attempt_at IS NULL").
+		Update("next_attempt_at", gorm.Expr("created_at")).Error; err != nil {
+		return nil, err
+	}
+	// inbox 原 idx_inbox_user_score 为 (score, created_at)，不含 user_id，已由 idx_inbox_user_score_post 取代
+	if db.Migrator().HasIndex(&model.Inbox{}, "idx_inbox_user_score") {
+		if err := db.Migrator().DropIndex(&model.Inbox{}, "idx_inbox_user_score"); err != nil {
+			return nil, err
+		}
+	}
+	// outbox.post_id 原为唯一索引，edit / retract 事件需要同一帖子多行
+	if db.Migrator().HasIndex(&model.Outbox{}, "idx_outbox_post_id") {
+		if err := db.Migrator().DropIndex(&model.Outbox{}, "idx_outbox_post_id"); err != nil {
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
+
+// InitShards 按 sharding.dsns 的顺序连接各分库，返回值下标即库序号；分表由各分片仓储的 InitSchema 创建
+func InitShards(cfg *config.Config) ([]*gorm.DB, error) {
+	if err := cfg.Sharding.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.Sharding.Enabled() {
+		return nil, fmt.Errorf("sharding.dsns is empty")
+	}
+
+	dbs := make([]*gorm.DB, 0, len(cfg.Sharding.DSNs))
+	closeAll := func() {
+		for _, db := range dbs {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		}
+	}
+	for i, dsn := range cfg.Sharding.DSNs {
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logLevel(cfg)),
+		})
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to connect shard %d: %w", i, err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to connect shard %d: %w", i, err)
+		}
+		if cfg.Sharding.MaxOpenConns > 0 {
+			sqlDB.SetMaxOpenConns(cfg.Sharding.MaxOpenConns)
+		}
+		if cfg.Sharding.MaxIdleConns > 0 {
+			sqlDB.SetMaxIdleConns(cfg.Sharding.MaxIdleConns)
+		}
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Second)
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const listenRetryInterval = time.Second
+
+// Listen 在独立连接上 LISTEN channel，每收到一条通知调用一次 onNotify，阻塞直到 ctx 结束。
+// 连接断开后自动重连；每次连上后先调用一次 onNotify("")，补偿断线期间错过的通知。
+func Listen(ctx context.Context, dsn, channel string, onNotify func(payload string)) {
+	for {
+		err := listenOnce(ctx, dsn, channel, onNotify)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("postgres listener disconnected", zap.String("channel", channel), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func listenOnce(ctx context.Context, dsn, channel string, onNotify func(payload string)) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	onNotify("")
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onNotify(n.Payload)
+	}
+}
@@ -0,0 +1,31 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed 事件总线已关闭
+var ErrClosed = errors.New("eventbus closed")
+
+// Message 一条事件；Key 用于日志与分区，Payload 由生产者与消费者自行约定编码
+type Message struct {
+	ID      string // 由总线分配（Redis 为 stream entry id），Publish 时忽略
+	Topic   string
+	Key     string
+	Payload []byte
+}
+
+// Handler 处理一条消息；返回 nil 才确认（ack），否则稍后重新投递
+type Handler func(ctx context.Context, msg *Message) error
+
+// EventBus 至少一次投递的发布/订阅总线。
+// 同一 topic 的每个消费组都会收到全部消息，组内多个消费者竞争消费；消费者需幂等。
+type EventBus interface {
+	// Publish 批量发布消息，返回 nil 表示已被总线持久化
+	Publish(ctx context.Context, topic string, msgs ...Message) error
+	// Subscribe 以 group 身份消费 topic，阻塞直到 ctx 结束或总线关闭。
+	// 新建的消费组从 topic 的最早消息开始消费。
+	Subscribe(ctx context.Context, topic, group string, h Handler) error
+	Close() error
+}
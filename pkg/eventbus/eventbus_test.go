@@ -0,0 +1,110 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+func init() {
+	if err := logger.Init("release"); err != nil {
+		panic(err)
+	}
+}
+
+// collector 记录每个消费组收到的 payload；fail 中的 payload 第一次处理时返回错误
+type collector struct {
+	mu     sync.Mutex
+	got    map[string][]string
+	failed map[string]bool
+	fail   string
+}
+
+func newCollector(fail string) *collector {
+	return &collector{got: make(map[string][]string), failed: make(map[string]bool), fail: fail}
+}
+
+func (c *collector) handler(group string) Handler {
+	return func(_ context.Context, msg *Message) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		p := string(msg.Payload)
+		if p == c.fail && !c.failed[group] {
+			c.failed[group] = true
+			return errors.New("transient")
+		}
+		c.got[group] = append(c.got[group], p)
+		return nil
+	}
+}
+
+func (c *collector) count(group string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.got[group])
+}
+
+// testBus 两个消费组都应收到全部消息，处理失败的消息会被重新投递
+func testBus(t *testing.T, bus EventBus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const n = 5
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = Message{Key: "k", Payload: []byte(fmt.Sprintf("m%d", i))}
+	}
+	// 先发布后订阅：新消费组从最早的消息开始消费
+	require.NoError(t, bus.Publish(ctx, "topic", msgs[:2]...))
+
+	c := newCollector("m1")
+	var wg sync.WaitGroup
+	for _, g := range []string{"g1", "g1", "g2"} {
+		wg.Add(1)
+		go func(g string) {
+			defer wg.Done()
+			assert.NoError(t, bus.Subscribe(ctx, "topic", g, c.handler(g)))
+		}(g)
+	}
+	require.NoError(t, bus.Publish(ctx, "topic", msgs[2:]...))
+
+	require.Eventually(t, func() bool { return c.count("g1") == n && c.count("g2") == n }, 3*time.Second, 10*time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.ElementsMatch(t, []string{"m0", "m1", "m2", "m3", "m4"}, c.got["g1"])
+	assert.ElementsMatch(t, []string{"m0", "m1", "m2", "m3", "m4"}, c.got["g2"])
+}
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemory()
+	testBus(t, bus)
+	assert.Equal(t, 0, bus.Pending("topic", "g1"))
+
+	require.NoError(t, bus.Close())
+	assert.ErrorIs(t, bus.Publish(context.Background(), "topic", Message{}), ErrClosed)
+}
+
+func TestRedisStreamsBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	bus := NewRedisStreams(rdb, "test").WithRedelivery(50 * time.Millisecond)
+	bus.block = 20 * time.Millisecond
+	testBus(t, bus)
+
+	// 全部 ack 后两个组都没有待确认的消息
+	for _, g := range []string{"g1", "g2"} {
+		pending, err := rdb.XPending(context.Background(), "topic", g).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), pending.Count)
+	}
+}
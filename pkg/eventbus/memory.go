@@ -0,0 +1,136 @@
+package eventbus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Memory 进程内实现，用于测试：消息保存在内存中，失败的消息放回组内重试队列
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	closed bool
+	done   chan struct{}
+}
+
+type memoryTopic struct {
+	log    []Message
+	groups map[string]*memoryGroup
+	// wake 有新消息时关闭并替换，唤醒等待中的消费者
+	wake chan struct{}
+}
+
+type memoryGroup struct {
+	next  int       // 下一条未投递的 log 下标
+	retry []Message // 处理失败待重投的消息
+}
+
+func NewMemory() *Memory {
+	return &Memory{topics: make(map[string]*memoryTopic), done: make(chan struct{})}
+}
+
+func (m *Memory) topic(name string) *memoryTopic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*memoryGroup), wake: make(chan struct{})}
+		m.topics[name] = t
+	}
+	return t
+}
+
+func (m *Memory) Publish(_ context.Context, topic string, msgs ...Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	t := m.topic(topic)
+	for _, msg := range msgs {
+		msg.Topic = topic
+		msg.ID = strconv.Itoa(len(t.log) + 1)
+		t.log = append(t.log, msg)
+	}
+	close(t.wake)
+	t.wake = make(chan struct{})
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	for {
+		msg, wake, err := m.take(topic, group)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-m.done:
+				return nil
+			case <-wake:
+			}
+			continue
+		}
+		if err := h(ctx, msg); err != nil {
+			m.mu.Lock()
+			t := m.topic(topic)
+			g := t.groups[group]
+			g.retry = append(g.retry, *msg)
+			close(t.wake)
+			t.wake = make(chan struct{})
+			m.mu.Unlock()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// take 取出组内下一条消息（优先重试队列）；没有消息时返回用于等待的 wake 通道
+func (m *Memory) take(topic, group string) (*Message, <-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, nil, ErrClosed
+	}
+	t := m.topic(topic)
+	g, ok := t.groups[group]
+	if !ok {
+		g = &memoryGroup{}
+		t.groups[group] = g
+	}
+	if len(g.retry) > 0 {
+		msg := g.retry[0]
+		g.retry = g.retry[1:]
+		return &msg, nil, nil
+	}
+	if g.next < len(t.log) {
+		msg := t.log[g.next]
+		g.next++
+		return &msg, nil, nil
+	}
+	return nil, t.wake, nil
+}
+
+// Pending 返回组内尚未成功处理的消息数（未投递 + 待重试），测试用
+func (m *Memory) Pending(topic, group string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.topic(topic)
+	g, ok := t.groups[group]
+	if !ok {
+		return len(t.log)
+	}
+	return len(t.log) - g.next + len(g.retry)
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
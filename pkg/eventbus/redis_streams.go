@@ -0,0 +1,177 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/d60-Lab/gin-template/pkg/logger"
+)
+
+const (
+	defaultStreamMaxLen = 1000000
+	defaultStreamBatch  = 64
+	defaultStreamBlock  = 2 * time.Second
+	// defaultStreamMinIdle 已投递但超过该时长未 ack 的消息（消费者崩溃或处理失败）会被重新认领
+	defaultStreamMinIdle = 30 * time.Second
+)
+
+// RedisStreams 基于 Redis Streams 与消费组的实现：topic 即 stream key，
+// Publish 为 XADD（MAXLEN ~ 近似裁剪），Subscribe 为 XREADGROUP + XACK，
+// 未 ack 的消息由 XAUTOCLAIM 在空闲超过 minIdle 后重新认领。
+type RedisStreams struct {
+	rdb      *redis.Client
+	consumer string
+	maxLen   int64
+	batch    int64
+	block    time.Duration
+	minIdle  time.Duration
+}
+
+// NewRedisStreams 创建 Redis Streams 总线；consumer 为空时使用 hostname-pid
+func NewRedisStreams(rdb *redis.Client, consumer string) *RedisStreams {
+	if consumer == "" {
+		host, _ := os.Hostname()
+		consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return &RedisStreams{
+		rdb: rdb, consumer: consumer,
+		maxLen: defaultStreamMaxLen, batch: defaultStreamBatch, block: defaultStreamBlock, minIdle: defaultStreamMinIdle,
+	}
+}
+
+// WithMaxLen 设置 stream 近似最大长度，非正数保持默认值。
+// 裁剪只丢弃最旧的消息，需保证其远大于消费积压，否则未消费的消息会丢失（outbox 租约到期后会重新发布）。
+func (b *RedisStreams) WithMaxLen(n int64) *RedisStreams {
+	if n > 0 {
+		b.maxLen = n
+	}
+	return b
+}
+
+// WithRedelivery 设置未 ack 消息重新认领的空闲时长，非正数保持默认值。
+func (b *RedisStreams) WithRedelivery(minIdle time.Duration) *RedisStreams {
+	if minIdle > 0 {
+		b.minIdle = minIdle
+	}
+	return b
+}
+
+func (b *RedisStreams) Publish(ctx context.Context, topic string, msgs ...Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	pipe := b.rdb.Pipeline()
+	for _, m := range msgs {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: topic,
+			MaxLen: b.maxLen,
+			Approx: true,
+			Values: map[string]any{"key": m.Key, "payload": m.Payload},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisStreams) Subscribe(ctx context.Context, topic, group string, h Handler) error {
+	// 从 0 建组：新消费组消费 stream 中已有的全部消息
+	err := b.rdb.XGroupCreateMkStream(ctx, topic, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= b.minIdle/2 {
+			b.reclaim(ctx, topic, group, h)
+			lastClaim = time.Now()
+		}
+		streams, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.consumer,
+			Streams:  []string{topic, ">"},
+			Count:    b.batch,
+			Block:    b.block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			if errors.Is(err, redis.ErrClosed) {
+				return ErrClosed
+			}
+			logger.Warn("eventbus xreadgroup failed", zap.String("topic", topic), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, s := range streams {
+			b.dispatch(ctx, topic, group, s.Messages, h)
+		}
+	}
+	return nil
+}
+
+// reclaim 认领空闲超过 minIdle 的未 ack 消息并重新处理
+func (b *RedisStreams) reclaim(ctx context.Context, topic, group string, h Handler) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		msgs, next, err := b.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   topic,
+			Group:    group,
+			Consumer: b.consumer,
+			MinIdle:  b.minIdle,
+			Start:    start,
+			Count:    b.batch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("eventbus xautoclaim failed", zap.String("topic", topic), zap.Error(err))
+			}
+			return
+		}
+		b.dispatch(ctx, topic, group, msgs, h)
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// dispatch 逐条处理并 ack 成功的消息；失败的保留在 PEL 中等待重新认领
+func (b *RedisStreams) dispatch(ctx context.Context, topic, group string, msgs []redis.XMessage, h Handler) {
+	acks := make([]string, 0, len(msgs))
+	for _, xm := range msgs {
+		m := &Message{ID: xm.ID, Topic: topic}
+		if v, ok := xm.Values["key"].(string); ok {
+			m.Key = v
+		}
+		if v, ok := xm.Values["payload"].(string); ok {
+			m.Payload = []byte(v)
+		}
+		if err := h(ctx, m); err != nil {
+			logger.Warn("eventbus handler failed", zap.String("topic", topic), zap.String("id", xm.ID), zap.Error(err))
+			continue
+		}
+		acks = append(acks, xm.ID)
+	}
+	if len(acks) == 0 {
+		return
+	}
+	// ack 不随 ctx 取消，避免已处理的消息在停机时被重复投递
+	if err := b.rdb.XAck(context.Background(), topic, group, acks...).Err(); err != nil {
+		logger.Warn("eventbus xack failed", zap.String("topic", topic), zap.Error(err))
+	}
+}
+
+// Close 不关闭传入的 Redis 客户端，由调用方负责
+func (b *RedisStreams) Close() error { return nil }
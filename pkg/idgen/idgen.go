@@ -0,0 +1,177 @@
+// Package idgen 生成按时间递增的 64 位分布式 ID（snowflake 风格）。
+//
+// 布局从高到低：1 位符号 | 41 位毫秒时间戳 | WorkerBits 位 worker ID | 序号 | ShardBits 位分片基因。
+// 时间戳之外的 22 位由 worker ID、序号与分片基因分摊，序号位数随其余两项调整。
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	timestampBits = 41
+	// lowBits 时间戳以下的位数
+	lowBits = 63 - timestampBits
+
+	// DefaultWorkerBits 默认 worker ID 位数，最多 32 个进程同时生成
+	DefaultWorkerBits = 5
+	// DefaultMaxBackward 默认容忍的时钟回拨，回拨不超过该时长时等待时钟追上，超过则报错
+	DefaultMaxBackward = 10 * time.Millisecond
+)
+
+// Epoch 时间戳起点，41 位毫秒可用约 69 年
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrClockBackwards 时钟回拨超过容忍范围，继续生成可能与回拨前的 ID 重复
+	ErrClockBackwards = errors.New("idgen: clock moved backwards")
+	// ErrTimestampOverflow 时间戳超出 41 位
+	ErrTimestampOverflow = errors.New("idgen: timestamp overflows 41 bits")
+)
+
+// DefaultLayout 不带分片基因的布局，序号 17 位
+var DefaultLayout = Layout{WorkerBits: DefaultWorkerBits}
+
+// Layout 时间戳以下各段的位数，同一种 ID 的生成与解码必须使用相同的布局
+type Layout struct {
+	WorkerBits uint
+	ShardBits  uint
+}
+
+// SequenceBits 每毫秒序号的位数
+func (l Layout) SequenceBits() uint {
+	return lowBits - l.WorkerBits - l.ShardBits
+}
+
+// Validate 至少保留 1 位序号
+func (l Layout) Validate() error {
+	if l.WorkerBits+l.ShardBits >= lowBits {
+		return fmt.Errorf("idgen: worker bits %d + shard bits %d leave no sequence bits", l.WorkerBits, l.ShardBits)
+	}
+	return nil
+}
+
+// Parts ID 解码后的各段
+type Parts struct {
+	Time     time.Time
+	WorkerID int64
+	Sequence int64
+	Shard    int64
+}
+
+// Decode 按布局拆解 ID，用于排查问题
+func (l Layout) Decode(id int64) Parts {
+	seqBits := l.SequenceBits()
+	return Parts{
+		Time:     Epoch.Add(time.Duration(id>>lowBits) * time.Millisecond),
+		WorkerID: id >> (seqBits + l.ShardBits) & (1<<l.WorkerBits - 1),
+		Sequence: id >> l.ShardBits & (1<<seqBits - 1),
+		Shard:    id & (1<<l.ShardBits - 1),
+	}
+}
+
+// Generator 单个进程内的 ID 生成器，并发安全。不同进程须使用不同的 worker ID
+type Generator struct {
+	layout      Layout
+	workerID    int64
+	maxBackward time.Duration
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// New 创建生成器，workerID 须在 [0, 2^WorkerBits) 内
+func New(layout Layout, workerID int64) (*Generator, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	if workerID < 0 || workerID >= 1<<layout.WorkerBits {
+		return nil, fmt.Errorf("idgen: worker id %d out of range [0, %d)", workerID, int64(1)<<layout.WorkerBits)
+	}
+	return &Generator{
+		layout:      layout,
+		workerID:    workerID,
+		maxBackward: DefaultMaxBackward,
+		lastMs:      -1,
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}, nil
+}
+
+// WithMaxBackward 设置容忍的时钟回拨（需在使用前调用），0 表示回拨即报错
+func (g *Generator) WithMaxBackward(d time.Duration) *Generator {
+	g.maxBackward = d
+	return g
+}
+
+// Layout 生成器使用的布局
+func (g *Generator) Layout() Layout {
+	return g.layout
+}
+
+// Next 生成 ID，shard 取低 ShardBits 位嵌入 ID（布局不含分片基因时忽略）。
+// 同一毫秒序号用完时等待下一毫秒；时钟回拨不超过 maxBackward 时等待时钟追上，否则返回 ErrClockBackwards
+func (g *Generator) Next(shard int64) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.millis()
+	if ms < g.lastMs {
+		back := time.Duration(g.lastMs-ms) * time.Millisecond
+		if back > g.maxBackward {
+			return 0, fmt.Errorf("%w by %v", ErrClockBackwards, back)
+		}
+		for ms < g.lastMs {
+			g.sleep(time.Duration(g.lastMs-ms) * time.Millisecond)
+			ms = g.millis()
+		}
+	}
+	seqBits := g.layout.SequenceBits()
+	if ms == g.lastMs {
+		g.seq = (g.seq + 1) & (1<<seqBits - 1)
+		for g.seq == 0 && ms <= g.lastMs {
+			g.sleep(100 * time.Microsecond)
+			ms = g.millis()
+		}
+	} else {
+		g.seq = 0
+	}
+	if ms >= 1<<timestampBits {
+		return 0, ErrTimestampOverflow
+	}
+	g.lastMs = ms
+
+	shardBits := g.layout.ShardBits
+	return ms<<lowBits |
+		g.workerID<<(seqBits+shardBits) |
+		g.seq<<shardBits |
+		shard&(1<<shardBits-1), nil
+}
+
+func (g *Generator) millis() int64 {
+	return g.now().Sub(Epoch).Milliseconds()
+}
+
+// idDigits int64 最大值的十进制位数
+const idDigits = 19
+
+// Format 把 ID 格式化为定长十进制字符串，字符串按字典序排序即按时间排序，可直接用作 varchar 主键
+func Format(id int64) string {
+	return fmt.Sprintf("%0*d", idDigits, id)
+}
+
+// Parse 解析 Format 生成的字符串
+func Parse(s string) (int64, error) {
+	if len(s) != idDigits {
+		return 0, fmt.Errorf("idgen: %q is not a %d-digit id", s, idDigits)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,131 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock 测试用时钟，sleep 直接拨快
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestGenerator(t *testing.T, layout Layout, workerID int64) (*Generator, *fakeClock) {
+	g, err := New(layout, workerID)
+	require.NoError(t, err)
+	clock := &fakeClock{now: Epoch.Add(time.Hour)}
+	g.now, g.sleep = clock.Now, clock.Advance
+	return g, clock
+}
+
+func TestNewValidatesLayout(t *testing.T) {
+	_, err := New(Layout{WorkerBits: 12, ShardBits: 10}, 0)
+	assert.Error(t, err)
+	_, err = New(DefaultLayout, 32)
+	assert.Error(t, err)
+	_, err = New(DefaultLayout, -1)
+	assert.Error(t, err)
+	g, err := New(DefaultLayout, 31)
+	require.NoError(t, err)
+	assert.Equal(t, uint(17), g.Layout().SequenceBits())
+}
+
+func TestGeneratorSequenceAndDecode(t *testing.T) {
+	layout := Layout{WorkerBits: 5, ShardBits: 10}
+	g, clock := newTestGenerator(t, layout, 9)
+
+	// 序号 7 位，同一毫秒第 129 个 ID 等到下一毫秒
+	var last int64
+	for i := int64(0); i <= 128; i++ {
+		id, err := g.Next(1024 + i)
+		require.NoError(t, err)
+		assert.Greater(t, id, last)
+		last = id
+
+		parts := layout.Decode(id)
+		assert.Equal(t, int64(9), parts.WorkerID)
+		assert.Equal(t, i%1024, parts.Shard)
+		if i < 128 {
+			assert.Equal(t, i, parts.Sequence)
+			assert.Equal(t, Epoch.Add(time.Hour), parts.Time)
+		} else {
+			assert.Zero(t, parts.Sequence)
+			assert.Equal(t, clock.Now().Truncate(time.Millisecond), parts.Time)
+			assert.True(t, parts.Time.After(Epoch.Add(time.Hour)))
+		}
+	}
+}
+
+func TestGeneratorClockBackwards(t *testing.T) {
+	g, clock := newTestGenerator(t, DefaultLayout, 0)
+	first, err := g.Next(0)
+	require.NoError(t, err)
+
+	// 小幅回拨：等待时钟追上后继续递增
+	clock.Advance(-5 * time.Millisecond)
+	id, err := g.Next(0)
+	require.NoError(t, err)
+	assert.Greater(t, id, first)
+	assert.False(t, clock.Now().Before(Epoch.Add(time.Hour)))
+
+	// 超过容忍范围直接报错
+	clock.Advance(-time.Second)
+	_, err = g.Next(0)
+	assert.ErrorIs(t, err, ErrClockBackwards)
+}
+
+func TestGeneratorConcurrentUnique(t *testing.T) {
+	g, err := New(DefaultLayout, 1)
+	require.NoError(t, err)
+	const workers, perWorker = 8, 2000
+	var (
+		mu   sync.Mutex
+		seen = make(map[int64]struct{}, workers*perWorker)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := g.Next(0)
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				seen[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, workers*perWorker)
+}
+
+func TestFormatSortsByTime(t *testing.T) {
+	small, big := int64(1)<<lowBits, int64(1)<<62
+	assert.Len(t, Format(small), 19)
+	assert.Less(t, Format(small), Format(big))
+	id, err := Parse(Format(small))
+	require.NoError(t, err)
+	assert.Equal(t, small, id)
+	_, err = Parse("42")
+	assert.Error(t, err)
+}